@@ -3,15 +3,21 @@ package archiver
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"log"
 	"path"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf16"
 
 	"github.com/bodgit/sevenzip"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 func init() {
@@ -22,15 +28,36 @@ func init() {
 }
 
 type SevenZip struct {
+	// The method for compressing files when creating
+	// archives. The default is LZMA2.
+	Compression SevenZipMethod
+
+	// If true, files are compressed together as a single
+	// stream when creating archives, which usually makes
+	// the archive smaller, but means that reading a file
+	// requires decompressing all of the files before it.
+	Solid bool
+
 	// If true, errors encountered during reading or writing
 	// a file within an archive will be logged and the
 	// operation will continue on remaining files.
 	ContinueOnError bool
 
 	// The password, if dealing with an encrypted archive.
+	// Encrypted archives can only be read, not created.
 	Password string
 }
 
+// SevenZipMethod is a method by which files
+// in 7z archives are compressed.
+type SevenZipMethod int
+
+// Methods for compressing files in 7z archives.
+const (
+	SevenZipLZMA2 SevenZipMethod = iota
+	SevenZipCopy                 // no compression
+)
+
 func (z SevenZip) Extension() string { return ".7z" }
 
 func (z SevenZip) Match(_ context.Context, filename string, stream io.Reader) (MatchResult, error) {
@@ -51,7 +78,69 @@ func (z SevenZip) Match(_ context.Context, filename string, stream io.Reader) (M
 	return mr, nil
 }
 
-// Archive is not implemented for 7z because I do not know of a pure-Go 7z writer.
+// Archive writes files to a 7z archive. Because the header that lists the files
+// is written last, but located by a header at the start, output must be an
+// io.WriteSeeker, and seeking must work.
+func (z SevenZip) Archive(ctx context.Context, output io.Writer, files []FileInfo) error {
+	w, err := z.newWriter(output)
+	if err != nil {
+		return err
+	}
+
+	for i, file := range files {
+		if err := w.writeFile(ctx, i, file); err != nil {
+			// files can only be skipped if none of their contents were written
+			if z.ContinueOnError && ctx.Err() == nil && w.err == nil {
+				log.Printf("[ERROR] %v", err)
+				continue
+			}
+			return err
+		}
+	}
+
+	return w.close()
+}
+
+// ArchiveAsync is like Archive, but writes the files received from jobs
+// until the channel is closed.
+func (z SevenZip) ArchiveAsync(ctx context.Context, output io.Writer, jobs <-chan ArchiveAsyncJob) error {
+	w, err := z.newWriter(output)
+	if err != nil {
+		return err
+	}
+
+	var i int
+	for job := range jobs {
+		job.Result <- w.writeFile(ctx, i, job.File)
+		i++
+	}
+
+	return w.close()
+}
+
+func (z SevenZip) newWriter(output io.Writer) (*sevenZipWriter, error) {
+	if z.Password != "" {
+		return nil, fmt.Errorf("creating encrypted 7z archives is not supported")
+	}
+	if z.Compression != SevenZipLZMA2 && z.Compression != SevenZipCopy {
+		return nil, fmt.Errorf("unsupported 7z compression method: %d", z.Compression)
+	}
+	ws, ok := output.(io.WriteSeeker)
+	if !ok {
+		return nil, fmt.Errorf("output type must be an io.WriteSeeker because of 7z format constraints")
+	}
+	start, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("output must be seekable: %w", err)
+	}
+
+	// the signature header is filled in once the rest is written
+	if _, err := ws.Write(make([]byte, sevenZipSignatureHeaderLen)); err != nil {
+		return nil, err
+	}
+
+	return &sevenZipWriter{z: z, ws: ws, start: start}, nil
+}
 
 // Extract extracts files from z, implementing the Extractor interface. Uniquely, however,
 // sourceArchive must be an io.ReaderAt and io.Seeker, which are oddly disjoint interfaces
@@ -102,6 +191,14 @@ func (z SevenZip) Extract(ctx context.Context, sourceArchive io.Reader, handleFi
 			},
 		}
 
+		// 7z stores the target of a symlink as its file contents
+		if isSymlink(fi) {
+			file.LinkTarget, err = readSevenZipLinkTarget(f)
+			if err != nil {
+				return fmt.Errorf("reading link target of file %d: %s: %w", i, f.Name, err)
+			}
+		}
+
 		err := handleFile(ctx, file)
 		if errors.Is(err, fs.SkipDir) {
 			// if a directory, skip this path; if a file, skip the folder path
@@ -122,8 +219,478 @@ func (z SevenZip) Extract(ctx context.Context, sourceArchive io.Reader, handleFi
 	return nil
 }
 
+func readSevenZipLinkTarget(f *sevenzip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return linkTargetFromBody(rc)
+}
+
+// sevenZipWriter writes a 7z archive. The contents of the files are
+// written as they come, in folders (compressed streams) of their own,
+// or all in one folder if the archive is solid. The header describing
+// the folders and files is written after them, when the writer is closed.
+type sevenZipWriter struct {
+	z     SevenZip
+	ws    io.WriteSeeker
+	start int64 // offset of the archive in ws
+
+	entries []sevenZipEntry
+	folders []sevenZipFolder
+
+	// the folder being written, if any
+	folder      io.WriteCloser
+	folderStart int64 // offset of its packed stream
+	folderInfo  sevenZipFolder
+
+	// size of the file being written, used to pick a
+	// dictionary size for its folder if not solid
+	sizeHint int64
+
+	// an error after which the archive can't be completed
+	err error
+}
+
+// sevenZipEntry describes a file in the archive.
+type sevenZipEntry struct {
+	name        string
+	modTime     time.Time
+	attributes  uint32
+	emptyStream bool // no contents (a directory or empty file)
+	emptyFile   bool // an empty stream that is not a directory
+	size        uint64
+	crc         uint32
+}
+
+// sevenZipFolder describes a folder in the archive.
+type sevenZipFolder struct {
+	packSize   uint64
+	unpackSize uint64
+	streams    uint64 // number of files in the folder
+	dictCap    byte   // encoded LZMA2 dictionary size
+}
+
+func (w *sevenZipWriter) writeFile(ctx context.Context, idx int, file FileInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+	if w.err != nil {
+		return w.err
+	}
+
+	name := file.NameInArchive
+	if name == "" {
+		name = file.Name()
+	}
+	entry := sevenZipEntry{
+		name:       strings.TrimSuffix(name, "/"),
+		modTime:    file.ModTime(),
+		attributes: sevenZipAttributes(file.Mode()),
+	}
+
+	// only regular files and symlinks have contents
+	if !file.Mode().IsRegular() && !isSymlink(file) {
+		entry.emptyStream = true
+		entry.emptyFile = !file.IsDir()
+		w.entries = append(w.entries, entry)
+		return nil
+	}
+
+	// 7z stores the target of a symlink as its file contents
+	var body io.Reader
+	if isSymlink(file) && file.LinkTarget != "" {
+		body = strings.NewReader(file.LinkTarget)
+	} else {
+		f, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("opening file %d: %s: %w", idx, file.Name(), err)
+		}
+		defer f.Close()
+		body = f
+	}
+
+	w.sizeHint = file.Size()
+	checksum := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(w, checksum), body)
+	if err != nil {
+		err = fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), err)
+		if n > 0 || w.err != nil {
+			// the folder has part of the file, so the archive can't go on without it
+			w.err = err
+		}
+		return err
+	}
+
+	entry.size, entry.crc = uint64(n), checksum.Sum32()
+	if n == 0 {
+		entry.emptyStream, entry.emptyFile = true, true
+	} else {
+		w.folderInfo.streams++
+	}
+	w.entries = append(w.entries, entry)
+
+	if !w.z.Solid {
+		if err := w.closeFolder(); err != nil {
+			w.err = fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), err)
+			return w.err
+		}
+	}
+
+	return nil
+}
+
+// Write writes the contents of a file to the current folder,
+// starting a new folder if there isn't one.
+func (w *sevenZipWriter) Write(p []byte) (int, error) {
+	if w.folder == nil {
+		if err := w.openFolder(); err != nil {
+			w.err = err
+			return 0, err
+		}
+	}
+	n, err := w.folder.Write(p)
+	w.folderInfo.unpackSize += uint64(n)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *sevenZipWriter) openFolder() error {
+	start, err := w.ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	w.folderStart = start
+	w.folderInfo = sevenZipFolder{}
+
+	switch w.z.Compression {
+	case SevenZipCopy:
+		w.folder = nopWriteCloser{w.ws}
+	case SevenZipLZMA2:
+		// like 7-Zip, don't allocate a dictionary larger than the file
+		dictCap := sevenZipDictCap
+		if !w.z.Solid {
+			dictCap = int(min(int64(dictCap), max(w.sizeHint, lzma.MinDictCap)))
+		}
+		w.folderInfo.dictCap = lzma.EncodeDictCap(int64(dictCap))
+		w.folder, err = lzma.Writer2Config{DictCap: dictCap}.NewWriter2(w.ws)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *sevenZipWriter) closeFolder() error {
+	if w.folder == nil {
+		return nil
+	}
+	if err := w.folder.Close(); err != nil {
+		return err
+	}
+	end, err := w.ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	w.folderInfo.packSize = uint64(end - w.folderStart)
+	w.folders = append(w.folders, w.folderInfo)
+	w.folder = nil
+	return nil
+}
+
+// close finishes the archive by writing the header, then the
+// signature header at the start, which points to the header.
+func (w *sevenZipWriter) close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.closeFolder(); err != nil {
+		return err
+	}
+
+	headerOffset, err := w.ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	header := w.header()
+	if _, err := w.ws.Write(header); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	sig := make([]byte, sevenZipSignatureHeaderLen)
+	copy(sig, sevenZipHeader)
+	sig[6], sig[7] = 0, 4 // format version
+	binary.LittleEndian.PutUint64(sig[12:], uint64(headerOffset-w.start-sevenZipSignatureHeaderLen))
+	binary.LittleEndian.PutUint64(sig[20:], uint64(len(header)))
+	binary.LittleEndian.PutUint32(sig[28:], crc32.ChecksumIEEE(header))
+	binary.LittleEndian.PutUint32(sig[8:], crc32.ChecksumIEEE(sig[12:]))
+
+	if _, err := w.ws.Seek(w.start, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.ws.Write(sig); err != nil {
+		return fmt.Errorf("writing signature header: %w", err)
+	}
+	_, err = w.ws.Seek(headerOffset+int64(len(header)), io.SeekStart)
+	return err
+}
+
+// header encodes the header of the archive. An archive without
+// files still has a header, since some readers require one.
+func (w *sevenZipWriter) header() []byte {
+	var h sevenZipBuffer
+	h.WriteByte(sevenZipIDHeader)
+
+	if len(w.folders) > 0 {
+		h.WriteByte(sevenZipIDMainStreamsInfo)
+
+		h.WriteByte(sevenZipIDPackInfo)
+		h.number(0) // the packed streams start right after the signature header
+		h.number(uint64(len(w.folders)))
+		h.WriteByte(sevenZipIDSize)
+		for _, f := range w.folders {
+			h.number(f.packSize)
+		}
+		h.WriteByte(sevenZipIDEnd)
+
+		h.WriteByte(sevenZipIDUnpackInfo)
+		h.WriteByte(sevenZipIDFolder)
+		h.number(uint64(len(w.folders)))
+		h.WriteByte(0) // not external
+		for _, f := range w.folders {
+			h.number(1) // one coder, with one input and one output
+			switch w.z.Compression {
+			case SevenZipCopy:
+				h.Write([]byte{0x01, sevenZipMethodCopy})
+			case SevenZipLZMA2:
+				h.Write([]byte{0x21, sevenZipMethodLZMA2, 1, f.dictCap}) // has 1 byte of properties
+			}
+		}
+		h.WriteByte(sevenZipIDCodersUnpackSize)
+		for _, f := range w.folders {
+			h.number(f.unpackSize)
+		}
+		h.WriteByte(sevenZipIDEnd)
+
+		// the files in the folders, in order, are the non-empty streams
+		h.WriteByte(sevenZipIDSubStreamsInfo)
+		var sizes []uint64
+		if w.z.Solid {
+			h.WriteByte(sevenZipIDNumUnpackStream)
+			for _, f := range w.folders {
+				h.number(f.streams)
+			}
+			var i uint64
+			for _, e := range w.entries {
+				if e.emptyStream {
+					continue
+				}
+				// the size of the last file in the folder is implied
+				if i++; i < w.folders[0].streams {
+					sizes = append(sizes, e.size)
+				}
+			}
+		}
+		if len(sizes) > 0 {
+			h.WriteByte(sevenZipIDSize)
+			for _, size := range sizes {
+				h.number(size)
+			}
+		}
+		h.WriteByte(sevenZipIDCRC)
+		h.WriteByte(1) // all defined
+		for _, e := range w.entries {
+			if !e.emptyStream {
+				h.Write(binary.LittleEndian.AppendUint32(nil, e.crc))
+			}
+		}
+		h.WriteByte(sevenZipIDEnd)
+
+		h.WriteByte(sevenZipIDEnd)
+	}
+
+	if len(w.entries) > 0 {
+		h.WriteByte(sevenZipIDFilesInfo)
+		h.number(uint64(len(w.entries)))
+
+		var emptyStreams, emptyFiles, mtimeDefined []bool
+		var names, mtimes, attributes sevenZipBuffer
+		names.WriteByte(0)      // not external
+		attributes.WriteByte(1) // all defined
+		attributes.WriteByte(0) // not external
+		for _, e := range w.entries {
+			emptyStreams = append(emptyStreams, e.emptyStream)
+			if e.emptyStream {
+				emptyFiles = append(emptyFiles, e.emptyFile)
+			}
+			for _, c := range utf16.Encode([]rune(e.name + "\x00")) {
+				names.Write(binary.LittleEndian.AppendUint16(nil, c))
+			}
+			mtimeDefined = append(mtimeDefined, !e.modTime.IsZero())
+			if !e.modTime.IsZero() {
+				mtimes.Write(binary.LittleEndian.AppendUint64(nil, timeToFiletime(e.modTime)))
+			}
+			attributes.Write(binary.LittleEndian.AppendUint32(nil, e.attributes))
+		}
+
+		if slices.Contains(emptyStreams, true) {
+			var prop sevenZipBuffer
+			prop.bools(emptyStreams)
+			h.property(sevenZipIDEmptyStream, prop.Bytes())
+		}
+		if slices.Contains(emptyFiles, true) {
+			var prop sevenZipBuffer
+			prop.bools(emptyFiles)
+			h.property(sevenZipIDEmptyFile, prop.Bytes())
+		}
+		h.property(sevenZipIDName, names.Bytes())
+		if slices.Contains(mtimeDefined, true) {
+			var prop sevenZipBuffer
+			if slices.Contains(mtimeDefined, false) {
+				prop.WriteByte(0) // not all defined
+				prop.bools(mtimeDefined)
+			} else {
+				prop.WriteByte(1) // all defined
+			}
+			prop.WriteByte(0) // not external
+			prop.Write(mtimes.Bytes())
+			h.property(sevenZipIDMTime, prop.Bytes())
+		}
+		h.property(sevenZipIDWinAttributes, attributes.Bytes())
+
+		h.WriteByte(sevenZipIDEnd)
+	}
+
+	h.WriteByte(sevenZipIDEnd)
+	return h.Bytes()
+}
+
+// sevenZipBuffer is a buffer with methods for
+// writing the data types of 7z headers.
+type sevenZipBuffer struct {
+	bytes.Buffer
+}
+
+// number writes n as a 7z NUMBER: the number of leading ones
+// in the first byte is the number of bytes that follow, which
+// hold the low bytes of n in little-endian order; the rest of
+// the first byte holds the high bits.
+func (b *sevenZipBuffer) number(n uint64) {
+	var first byte
+	mask := byte(0x80)
+	i := 0
+	for ; i < 8; i++ {
+		if n < 1<<(7*(i+1)) {
+			first |= byte(n >> (8 * i))
+			break
+		}
+		first |= mask
+		mask >>= 1
+	}
+	b.WriteByte(first)
+	for ; i > 0; i-- {
+		b.WriteByte(byte(n))
+		n >>= 8
+	}
+}
+
+// bools writes v as a bit vector, most significant bit first.
+func (b *sevenZipBuffer) bools(v []bool) {
+	var cur byte
+	for i, set := range v {
+		if set {
+			cur |= 0x80 >> (i % 8)
+		}
+		if i%8 == 7 || i == len(v)-1 {
+			b.WriteByte(cur)
+			cur = 0
+		}
+	}
+}
+
+// property writes a property of the files in the archive.
+func (b *sevenZipBuffer) property(id byte, data []byte) {
+	b.WriteByte(id)
+	b.number(uint64(len(data)))
+	b.Write(data)
+}
+
+// sevenZipAttributes returns the attributes of a file with the given
+// mode, as 7-Zip writes them: Windows attributes in the low 16 bits,
+// and, flagged by 0x8000, the Unix mode in the high 16 bits.
+func sevenZipAttributes(mode fs.FileMode) uint32 {
+	const (
+		readOnly      = 0x1
+		directory     = 0x10
+		archive       = 0x20
+		unixExtension = 0x8000
+	)
+
+	attributes := uint32(archive)
+	if mode.IsDir() {
+		attributes = directory
+	}
+	if mode&0200 == 0 {
+		attributes |= readOnly
+	}
+
+	return attributes | unixExtension | unixMode(mode)<<16
+}
+
+// timeToFiletime returns t as a Windows FILETIME,
+// the number of 100ns intervals since 1601.
+func timeToFiletime(t time.Time) uint64 {
+	const epochDiff = 116444736000000000 // between 1601 and 1970
+	return uint64(t.UnixNano()/100 + epochDiff)
+}
+
 // https://py7zr.readthedocs.io/en/latest/archive_format.html#signature
 var sevenZipHeader = []byte("7z\xBC\xAF\x27\x1C")
 
-// Interface guard
-var _ Extractor = SevenZip{}
+// The signature header is the magic bytes, version, and the
+// location of the header (at the end of the archive) with CRCs.
+const sevenZipSignatureHeaderLen = 32
+
+// The dictionary size for LZMA2, which is 7-Zip's default
+// for its normal compression level.
+const sevenZipDictCap = 16 << 20
+
+// IDs of the properties in 7z headers.
+// https://py7zr.readthedocs.io/en/latest/archive_format.html#property-ids
+const (
+	sevenZipIDEnd              = 0x00
+	sevenZipIDHeader           = 0x01
+	sevenZipIDMainStreamsInfo  = 0x04
+	sevenZipIDFilesInfo        = 0x05
+	sevenZipIDPackInfo         = 0x06
+	sevenZipIDUnpackInfo       = 0x07
+	sevenZipIDSubStreamsInfo   = 0x08
+	sevenZipIDSize             = 0x09
+	sevenZipIDCRC              = 0x0a
+	sevenZipIDFolder           = 0x0b
+	sevenZipIDCodersUnpackSize = 0x0c
+	sevenZipIDNumUnpackStream  = 0x0d
+	sevenZipIDEmptyStream      = 0x0e
+	sevenZipIDEmptyFile        = 0x0f
+	sevenZipIDName             = 0x11
+	sevenZipIDMTime            = 0x14
+	sevenZipIDWinAttributes    = 0x15
+)
+
+// IDs of the coders used to write 7z archives.
+const (
+	sevenZipMethodCopy  = 0x00
+	sevenZipMethodLZMA2 = 0x21
+)
+
+// Interface guards
+var (
+	_ Archiver      = SevenZip{}
+	_ ArchiverAsync = SevenZip{}
+	_ Extractor     = SevenZip{}
+)
@@ -0,0 +1,76 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+)
+
+func TestSevenZipArchive(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dir":           {Mode: fs.ModeDir | 0755, ModTime: modTime},
+		"dir/a.txt":     {Data: bytes.Repeat([]byte("compressible "), 10000), Mode: 0644, ModTime: modTime},
+		"dir/empty.txt": {Mode: 0600, ModTime: modTime},
+		"dir/link":      {Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777, ModTime: modTime},
+		"dir/sub":       {Mode: fs.ModeDir | 0700, ModTime: modTime},
+		"dir/sub/b.txt": {Data: []byte("read only"), Mode: 0444, ModTime: modTime},
+		"ünïcode.txt":   {Data: []byte("no time"), Mode: 0644},
+	}
+	files := filesFromMapFS(t, fsys)
+
+	for _, tc := range []struct {
+		name    string
+		format  SevenZip
+		folders int
+	}{
+		{name: "lzma2", format: SevenZip{}, folders: 4},
+		{name: "copy", format: SevenZip{Compression: SevenZipCopy}, folders: 4},
+		{name: "solid lzma2", format: SevenZip{Solid: true}, folders: 1},
+		{name: "solid copy", format: SevenZip{Compression: SevenZipCopy, Solid: true}, folders: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			archive, got := roundTrip(t, tc.format, files)
+			checkExtractedFiles(t, got, fsys)
+
+			// only non-empty files and links have streams in folders
+			zr, err := sevenzip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+			checkErr(t, err, "reading archive")
+			folders := make(map[int]bool)
+			for _, zf := range zr.File {
+				if zf.UncompressedSize > 0 {
+					folders[zf.Stream] = true
+				}
+			}
+			if len(folders) != tc.folders {
+				t.Errorf("expected %d folders but got %d", tc.folders, len(folders))
+			}
+		})
+	}
+}
+
+func TestSevenZipArchiveEmpty(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "empty.7z"))
+	checkErr(t, err, "creating archive")
+	defer f.Close()
+	checkErr(t, SevenZip{}.Archive(context.Background(), f, nil), "writing archive")
+
+	if contents := archiveContents(t, SevenZip{}, f); len(contents) != 0 {
+		t.Errorf("expected no files but got %v", contents)
+	}
+}
+
+func TestSevenZipArchiveNotSeekable(t *testing.T) {
+	var buf bytes.Buffer
+	err := SevenZip{}.Archive(context.Background(), &buf, nil)
+	if err == nil {
+		t.Error("expected an error writing to an io.Writer that can't seek")
+	}
+}
@@ -0,0 +1,494 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterFormat(Ar{})
+}
+
+// Ar can read and write Unix ar archives, as used for static libraries
+// (.a files) and Debian packages (see Deb). Names longer than 16 bytes
+// can be read in both the GNU and BSD variants of the format; which of
+// them is written is set by Format.
+//
+// Ar archives can only contain regular files, and have no directories;
+// directories are skipped when writing, and files in them are stored
+// with their full names in the archive. Symbol tables of libraries are
+// skipped when reading.
+type Ar struct {
+	// How to write names that don't fit in the header.
+	// The default is ArGNU.
+	Format ArFormat
+
+	// If true, errors encountered during reading or writing
+	// a file within an archive will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+}
+
+// ArFormat is a variant of the ar format, which differ
+// in how they store long file names.
+type ArFormat int
+
+const (
+	// The format of GNU and System V ar: names end with a slash,
+	// and long names are stored in a table at the start of the
+	// archive.
+	ArGNU ArFormat = iota
+
+	// The format of BSD (and macOS) ar: long names are stored
+	// at the start of the contents of their files.
+	ArBSD
+)
+
+func (Ar) Extension() string { return ".a" }
+
+func (a Ar) Match(_ context.Context, filename string, stream io.Reader) (MatchResult, error) {
+	var mr MatchResult
+
+	// match filename
+	if filepath.Ext(strings.ToLower(filename)) == a.Extension() {
+		mr.ByName = true
+	}
+
+	// match file header; Debian packages are ar archives
+	// too, but they're matched as Deb so they can be read
+	// as such
+	buf, err := readAtMost(stream, len(arHeader)+len(debFirstMember))
+	if err != nil {
+		return mr, err
+	}
+	mr.ByStream = bytes.HasPrefix(buf, arHeader) && !isDeb(buf)
+
+	return mr, nil
+}
+
+func (a Ar) Archive(ctx context.Context, output io.Writer, files []FileInfo) error {
+	if a.Format != ArGNU && a.Format != ArBSD {
+		return fmt.Errorf("unsupported ar format: %d", a.Format)
+	}
+	aw := &arWriter{w: output, format: a.Format}
+	if _, err := output.Write(arHeader); err != nil {
+		return err
+	}
+
+	// the GNU format has all the long names in a table before the files
+	if a.Format == ArGNU {
+		var table []byte
+		aw.names = make(map[string]int)
+		for _, file := range files {
+			name := arName(file)
+			if _, ok := aw.names[name]; ok || file.IsDir() || !arNeedsLongName(name, a.Format) {
+				continue
+			}
+			aw.names[name] = len(table)
+			table = append(table, name+"/\n"...)
+		}
+		if len(table) > 0 {
+			if err := aw.writeHeader("//", new(ArHeader), int64(len(table))); err != nil {
+				return err
+			}
+			if _, err := output.Write(table); err != nil {
+				return err
+			}
+			if err := aw.pad(int64(len(table))); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, file := range files {
+		if err := aw.writeFile(ctx, i, file); err != nil {
+			// files can only be skipped if none of them was written
+			if a.ContinueOnError && ctx.Err() == nil && aw.err == nil {
+				log.Printf("[ERROR] %v", err)
+				continue
+			}
+			return err
+		}
+	}
+
+	return aw.err
+}
+
+// Extract extracts the files in the ar archive, which may use either
+// of the GNU or BSD formats.
+func (a Ar) Extract(ctx context.Context, sourceArchive io.Reader, handleFile FileHandler) error {
+	ar, err := newArReader(sourceArchive)
+	if err != nil {
+		return err
+	}
+
+	// important to initialize to non-nil, empty value due to how fileIsIncluded works
+	skipDirs := skipList{}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err // honor context cancellation
+		}
+
+		hdr, err := ar.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the next header can't be found without this one,
+			// so there's no continuing on from here
+			return err
+		}
+		if fileIsIncluded(skipDirs, hdr.Name) {
+			continue
+		}
+
+		info := arFileInfo{hdr}
+		file := FileInfo{
+			FileInfo:      info,
+			Header:        hdr,
+			NameInArchive: hdr.Name,
+			Open: func() (fs.File, error) {
+				return fileInArchive{io.NopCloser(ar), info}, nil
+			},
+		}
+
+		err = handleFile(ctx, file)
+		if errors.Is(err, fs.SkipAll) {
+			break
+		} else if errors.Is(err, fs.SkipDir) {
+			// there are only files, so skip the folder path
+			skipDirs.add(path.Dir(hdr.Name) + "/")
+		} else if err != nil {
+			return fmt.Errorf("handling file: %s: %w", hdr.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ArHeader is the header of a file in an ar archive. It is
+// the Header of files extracted from ar archives; when writing
+// such files to an ar archive, their owner is kept.
+type ArHeader struct {
+	Name    string
+	ModTime time.Time
+	Uid     int
+	Gid     int
+	Mode    uint32 // Unix file mode, including the file type
+	Size    int64
+}
+
+// arFileInfo satisfies the fs.FileInfo interface for ar entries.
+type arFileInfo struct {
+	hdr *ArHeader
+}
+
+func (afi arFileInfo) Name() string       { return path.Base(afi.hdr.Name) }
+func (afi arFileInfo) Size() int64        { return afi.hdr.Size }
+func (afi arFileInfo) Mode() fs.FileMode  { return fileModeFromUnix(afi.hdr.Mode) }
+func (afi arFileInfo) ModTime() time.Time { return afi.hdr.ModTime }
+func (afi arFileInfo) IsDir() bool        { return false }
+func (afi arFileInfo) Sys() any           { return afi.hdr }
+
+// arReader reads the headers of an ar archive, and
+// the contents of the current file.
+type arReader struct {
+	r         io.Reader
+	remaining int64  // unread contents of the current file
+	padding   int64  // after the contents of the current file
+	names     []byte // table of long names, in the GNU format
+}
+
+// newArReader returns a reader of the archive read from r,
+// after checking that it starts with the ar header.
+func newArReader(r io.Reader) (*arReader, error) {
+	buf := make([]byte, len(arHeader))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("reading ar header: %w", noEOF(err))
+	}
+	if !bytes.Equal(buf, arHeader) {
+		return nil, fmt.Errorf("not an ar archive: header %q", buf)
+	}
+	return &arReader{r: r}, nil
+}
+
+// next advances to the next file in the archive, skipping the rest of
+// the current one, and returns its header. Symbol tables and the table
+// of long names are skipped. At the end of the archive, it returns io.EOF.
+func (ar *arReader) next() (*ArHeader, error) {
+	for {
+		if _, err := io.CopyN(io.Discard, ar.r, ar.remaining+ar.padding); err != nil {
+			return nil, noEOF(err)
+		}
+		ar.remaining, ar.padding = 0, 0
+
+		buf := make([]byte, arFileHeaderLen)
+		if _, err := io.ReadFull(ar.r, buf); err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(buf[58:60], []byte("`\n")) {
+			return nil, fmt.Errorf("invalid ar file header: %q", buf)
+		}
+
+		hdr := new(ArHeader)
+		modTime, err1 := arField(buf[16:28], 10)
+		uid, err2 := arField(buf[28:34], 10)
+		gid, err3 := arField(buf[34:40], 10)
+		mode, err4 := arField(buf[40:48], 8)
+		size, err5 := arField(buf[48:58], 10)
+		if err := errors.Join(err1, err2, err3, err4, err5); err != nil {
+			return nil, fmt.Errorf("invalid ar file header: %w", err)
+		}
+		hdr.ModTime = time.Unix(modTime, 0)
+		hdr.Uid, hdr.Gid = int(uid), int(gid)
+		hdr.Mode, hdr.Size = uint32(mode), size
+		if hdr.Mode&unixModeType == 0 {
+			hdr.Mode |= unixModeRegular
+		}
+		ar.remaining, ar.padding = size, size&1
+
+		name := strings.TrimRight(string(buf[:16]), " ")
+		switch {
+		case name == "/" || name == "/SYM64/":
+			continue // symbol table of the GNU format
+
+		case name == "//":
+			if size > arMaxNamesSize {
+				return nil, fmt.Errorf("table of long names is too large: %d bytes", size)
+			}
+			ar.names = make([]byte, size)
+			if _, err := io.ReadFull(ar, ar.names); err != nil {
+				return nil, fmt.Errorf("reading table of long names: %w", err)
+			}
+			continue
+
+		case strings.HasPrefix(name, "#1/"):
+			// in the BSD format, the length of the name, which comes first
+			n, err := strconv.ParseInt(name[3:], 10, 64)
+			if err != nil || n < 0 || n > size || n > arMaxNamesSize {
+				return nil, fmt.Errorf("invalid ar file header: name %q", name)
+			}
+			longName := make([]byte, n)
+			if _, err := io.ReadFull(ar, longName); err != nil {
+				return nil, fmt.Errorf("reading name: %w", err)
+			}
+			hdr.Name = string(bytes.TrimRight(longName, "\x00"))
+			hdr.Size -= n
+
+		case len(name) > 1 && name[0] == '/':
+			// in the GNU format, the offset of the name in the table
+			offset, err := strconv.Atoi(name[1:])
+			if err != nil || offset < 0 || offset >= len(ar.names) {
+				return nil, fmt.Errorf("invalid ar file header: name %q", name)
+			}
+			longName, _, _ := bytes.Cut(ar.names[offset:], []byte("\n"))
+			hdr.Name = strings.TrimSuffix(string(longName), "/")
+
+		default:
+			hdr.Name = strings.TrimSuffix(name, "/")
+		}
+
+		if strings.HasPrefix(hdr.Name, "__.SYMDEF") {
+			continue // symbol table of the BSD format
+		}
+		return hdr, nil
+	}
+}
+
+// Read reads the contents of the current file.
+func (ar *arReader) Read(p []byte) (int, error) {
+	if ar.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > ar.remaining {
+		p = p[:ar.remaining]
+	}
+	n, err := ar.r.Read(p)
+	ar.remaining -= int64(n)
+	if ar.remaining > 0 {
+		err = noEOF(err)
+	}
+	return n, err
+}
+
+// arField parses a numeric field of a file header, which
+// is padded with spaces; blank fields are zero.
+func arField(field []byte, base int) (int64, error) {
+	s := strings.TrimRight(string(field), " ")
+	if s == "" {
+		return 0, nil
+	}
+	v, err := strconv.ParseInt(s, base, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("field %q", field)
+	}
+	return v, nil
+}
+
+// arWriter writes files to an ar archive.
+type arWriter struct {
+	w      io.Writer
+	format ArFormat
+	names  map[string]int // offsets of long names in the table, in the GNU format
+
+	// the archive can't go on after an error
+	// while writing the contents of a file
+	err error
+}
+
+func (aw *arWriter) writeFile(ctx context.Context, idx int, file FileInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+	if aw.err != nil {
+		return aw.err
+	}
+	if file.IsDir() {
+		return nil // ar archives have no directories
+	}
+	if !file.Mode().IsRegular() || file.LinkTarget != "" {
+		return fmt.Errorf("writing file %d: %s: ar archives can only contain regular files", idx, file.Name())
+	}
+
+	name := arName(file)
+	hdr := &ArHeader{
+		Name:    name,
+		ModTime: file.ModTime(),
+		Mode:    unixMode(file.Mode()),
+		Size:    file.Size(),
+	}
+	switch h := file.Header.(type) {
+	case ArHeader:
+		hdr.Uid, hdr.Gid = h.Uid, h.Gid
+	case *ArHeader:
+		hdr.Uid, hdr.Gid = h.Uid, h.Gid
+	default:
+		// tar's header has the owner from the
+		// file info of the platform, if it has it
+		if th, err := tar.FileInfoHeader(file, ""); err == nil {
+			hdr.Uid, hdr.Gid = th.Uid, th.Gid
+		}
+	}
+
+	// the name as written in the header
+	nameField := name + "/"
+	var longName string
+	if arNeedsLongName(name, aw.format) {
+		if aw.format == ArBSD {
+			nameField, longName = "#1/"+strconv.Itoa(len(name)), name
+		} else {
+			nameField = "/" + strconv.Itoa(aw.names[name])
+		}
+	} else if aw.format == ArBSD {
+		nameField = name
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("opening file %d: %s: %w", idx, file.Name(), err)
+	}
+	defer f.Close()
+
+	size := hdr.Size + int64(len(longName))
+	if err := aw.writeHeader(nameField, hdr, size); err != nil {
+		return fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), err)
+	}
+	if _, err := io.WriteString(aw.w, longName); err != nil {
+		aw.err = fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), err)
+		return aw.err
+	}
+	if _, err := io.CopyN(aw.w, f, hdr.Size); err != nil {
+		aw.err = fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), noEOF(err))
+		return aw.err
+	}
+	return aw.pad(size)
+}
+
+// writeHeader writes the header of a file, with the name
+// and size fields as given, and the others from hdr.
+func (aw *arWriter) writeHeader(name string, hdr *ArHeader, size int64) error {
+	buf := make([]byte, 0, arFileHeaderLen)
+	for _, field := range []struct {
+		value string
+		width int
+	}{
+		{name, 16},
+		{strconv.FormatInt(max(hdr.ModTime.Unix(), 0), 10), 12},
+		{strconv.Itoa(hdr.Uid), 6},
+		{strconv.Itoa(hdr.Gid), 6},
+		{strconv.FormatUint(uint64(hdr.Mode), 8), 8},
+		{strconv.FormatInt(size, 10), 10},
+	} {
+		if len(field.value) > field.width || strings.HasPrefix(field.value, "-") {
+			return fmt.Errorf("value %s does not fit in an ar header field of %d characters", field.value, field.width)
+		}
+		buf = append(buf, field.value...)
+		buf = append(buf, strings.Repeat(" ", field.width-len(field.value))...)
+	}
+	buf = append(buf, "`\n"...)
+	if _, err := aw.w.Write(buf); err != nil {
+		aw.err = err
+		return err
+	}
+	return nil
+}
+
+// pad writes the padding after n bytes of contents,
+// which aligns the next header to 2 bytes.
+func (aw *arWriter) pad(n int64) error {
+	if n&1 == 0 {
+		return nil
+	}
+	if _, err := aw.w.Write([]byte("\n")); err != nil {
+		aw.err = err
+		return err
+	}
+	return nil
+}
+
+// arName returns the name of file in an ar archive.
+func arName(file FileInfo) string {
+	name := file.NameInArchive
+	if name == "" {
+		name = file.Name()
+	}
+	return strings.TrimSuffix(name, "/")
+}
+
+// arNeedsLongName returns true if name doesn't fit in
+// the name field of a header in the given format.
+func arNeedsLongName(name string, format ArFormat) bool {
+	if format == ArBSD {
+		return len(name) > 16 || strings.Contains(name, " ") || strings.HasPrefix(name, "#1/")
+	}
+	// the GNU format ends names with a slash
+	return len(name) > 15 || strings.Contains(name, "/")
+}
+
+var arHeader = []byte("!<arch>\n")
+
+const (
+	arFileHeaderLen = 60
+
+	// Long names are limited to keep them
+	// from taking a lot of memory.
+	arMaxNamesSize = 16 << 20
+)
+
+// Interface guards
+var (
+	_ Archiver  = (*Ar)(nil)
+	_ Extractor = (*Ar)(nil)
+)
@@ -0,0 +1,77 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"maps"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestArArchive(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"a.o":                            {Data: []byte("even"), Mode: 0644, ModTime: modTime},
+		"odd.o":                          {Data: []byte("odd"), Mode: 0600, ModTime: modTime},
+		"a_very_long_object_name.o":      {Data: []byte("long name"), Mode: 0644, ModTime: modTime},
+		"with space.o":                   {Data: []byte("space"), Mode: 0644, ModTime: modTime},
+		"dir":                            {Mode: fs.ModeDir | 0755, ModTime: modTime},
+		"dir/in_dir.o":                   {Data: []byte("in a directory"), Mode: 0755, ModTime: modTime},
+		"dir/another_long_object_name.o": {Data: nil, Mode: 0644, ModTime: modTime},
+	}
+	files := filesFromMapFS(t, fsys)
+
+	// ar archives have no directories
+	want := maps.Clone(fsys)
+	delete(want, "dir")
+
+	for _, tc := range []struct {
+		name     string
+		format   ArFormat
+		longName string
+	}{
+		{name: "gnu", format: ArGNU, longName: "//"},
+		{name: "bsd", format: ArBSD, longName: "#1/"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			archive, got := roundTrip(t, Ar{Format: tc.format}, files)
+			if !bytes.Contains(archive, []byte(tc.longName)) {
+				t.Errorf("expected long names to be stored with %s", tc.longName)
+			}
+			checkExtractedFiles(t, got, want)
+		})
+	}
+}
+
+func TestArArchiveNotRegular(t *testing.T) {
+	files := filesFromMapFS(t, fstest.MapFS{
+		"link": {Mode: fs.ModeSymlink | 0777},
+	})
+	err := Ar{}.Archive(context.Background(), io.Discard, files)
+	if err == nil {
+		t.Error("expected an error writing a symbolic link to an ar archive")
+	}
+}
+
+func TestArExtractSymbolTables(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write(arHeader)
+	aw := &arWriter{w: &buf}
+	for _, member := range []struct{ name, data string }{
+		{"/", "\x00\x00\x00\x01\x00\x00\x00\x4ef\x00"},
+		{"__.SYMDEF SORTED", "symbols"},
+		{"f.o/", "object"},
+	} {
+		checkErr(t, aw.writeHeader(member.name, &ArHeader{Mode: 0644}, int64(len(member.data))), "writing header")
+		buf.WriteString(member.data)
+		checkErr(t, aw.pad(int64(len(member.data))), "writing padding")
+	}
+
+	contents := archiveContents(t, Ar{}, bytes.NewReader(buf.Bytes()))
+	if len(contents) != 1 || contents["f.o"] != "object" {
+		t.Errorf("expected only f.o in archive, but got %v", contents)
+	}
+}
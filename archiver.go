@@ -8,6 +8,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 )
@@ -42,6 +43,11 @@ type FileInfo struct {
 	// Not supported by all archive formats.
 	LinkTarget string
 
+	// Whether the file's contents are encrypted in the archive,
+	// in which case they can only be read with the password.
+	// Not supported by all archive formats.
+	Encrypted bool
+
 	// A callback function that opens the file to read its
 	// contents. The file must be closed when reading is
 	// complete.
@@ -239,6 +245,22 @@ func openAndCopyFile(file FileInfo, w io.Writer) error {
 	return nil
 }
 
+// linkTargetFromBody reads the target of a symbolic link from r,
+// which should be the body of the link's entry. Some formats
+// (for example, zip, 7z, rar, and cpio) store link targets this way
+// rather than in a header field.
+func linkTargetFromBody(r io.Reader) (string, error) {
+	const maxLinkTarget = 4096 // PATH_MAX on most systems
+	target, err := io.ReadAll(io.LimitReader(r, maxLinkTarget+1))
+	if err != nil {
+		return "", err
+	}
+	if len(target) > maxLinkTarget {
+		return "", fmt.Errorf("link target exceeds %d bytes", maxLinkTarget)
+	}
+	return string(target), nil
+}
+
 // fileIsIncluded returns true if filename is included according to
 // filenameList; meaning it is in the list, its parent folder/path
 // is in the list, or the list is nil.
@@ -260,10 +282,364 @@ func fileIsIncluded(filenameList []string, filename string) bool {
 	return false
 }
 
+// deletionList matches file names against a list of names to delete,
+// with the same semantics as fileIsIncluded, and keeps track of which
+// of the names have matched a file.
+type deletionList struct {
+	names []string
+	found []bool
+}
+
+func newDeletionList(names []string) deletionList {
+	d := deletionList{found: make([]bool, len(names))}
+	for _, name := range names {
+		d.names = append(d.names, strings.TrimSuffix(name, "/"))
+	}
+	return d
+}
+
+// includes returns true if filename should be deleted.
+func (d deletionList) includes(filename string) bool {
+	filename = strings.TrimSuffix(filename, "/")
+	var included bool
+	for i, name := range d.names {
+		if fileIsIncluded([]string{name}, filename) {
+			d.found[i] = true
+			included = true
+		}
+	}
+	return included
+}
+
+// notFound returns an error wrapping fs.ErrNotExist if any
+// of the names did not match a file.
+func (d deletionList) notFound() error {
+	var missing []string
+	for i, found := range d.found {
+		if !found {
+			missing = append(missing, d.names[i])
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: %w", strings.Join(missing, ", "), fs.ErrNotExist)
+	}
+	return nil
+}
+
+// moveData copies n bytes within rws from offset src to offset dst,
+// using buf as the intermediate buffer. The ranges may overlap.
+func moveData(rws io.ReadWriteSeeker, dst, src, n int64, buf []byte) error {
+	backward := dst > src // copy from the end so the source isn't overwritten first
+	for n > 0 {
+		chunk := buf[:min(n, int64(len(buf)))]
+		from, to := src, dst
+		if backward {
+			from, to = src+n-int64(len(chunk)), dst+n-int64(len(chunk))
+		}
+		if _, err := rws.Seek(from, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(rws, chunk); err != nil {
+			return err
+		}
+		if _, err := rws.Seek(to, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := rws.Write(chunk); err != nil {
+			return err
+		}
+		if !backward {
+			src += int64(len(chunk))
+			dst += int64(len(chunk))
+		}
+		n -= int64(len(chunk))
+	}
+	return nil
+}
+
+// segment is a part of an archive being rearranged in place: a header,
+// which is written at offset, followed by data moved from dataFrom.
+type segment struct {
+	header   []byte
+	offset   int64
+	dataFrom int64
+	dataLen  int64
+}
+
+// rearrange moves the data of the segments to follow their headers and
+// writes the headers. The segments must be in order of their offsets,
+// and must not overlap once rearranged. Data moving toward the start
+// of the archive is moved first, in order, followed by data moving
+// toward the end, in reverse order, so that no data is overwritten
+// before it is moved.
+func rearrange(rws io.ReadWriteSeeker, segments []segment) error {
+	buf := make([]byte, 32*1024)
+	move := func(seg segment) error {
+		dst := seg.offset + int64(len(seg.header))
+		if err := moveData(rws, dst, seg.dataFrom, seg.dataLen, buf); err != nil {
+			return fmt.Errorf("moving data from offset %d to %d: %w", seg.dataFrom, dst, err)
+		}
+		return nil
+	}
+	for _, seg := range segments {
+		if seg.offset+int64(len(seg.header)) < seg.dataFrom {
+			if err := move(seg); err != nil {
+				return err
+			}
+		}
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		if seg := segments[i]; seg.offset+int64(len(seg.header)) > seg.dataFrom {
+			if err := move(seg); err != nil {
+				return err
+			}
+		}
+	}
+	for _, seg := range segments {
+		if _, err := rws.Seek(seg.offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := rws.Write(seg.header); err != nil {
+			return fmt.Errorf("writing header at offset %d: %w", seg.offset, err)
+		}
+	}
+	return nil
+}
+
+// renameList maps file names to new names, where renaming a directory
+// renames everything in it, and keeps track of which of the names have
+// matched a file.
+type renameList struct {
+	deletionList
+	to []string
+}
+
+func newRenameList(renames map[string]string) renameList {
+	from := make([]string, 0, len(renames))
+	for name := range renames {
+		from = append(from, name)
+	}
+	slices.Sort(from)
+	r := renameList{deletionList: newDeletionList(from)}
+	for _, name := range from {
+		r.to = append(r.to, strings.Trim(path.Clean("/"+renames[name]), "/"))
+	}
+	return r
+}
+
+// rename returns the new name of filename, which is empty if the file
+// was moved to the root of the archive, and whether it was renamed.
+// Directory names keep their trailing slash.
+func (r renameList) rename(filename string) (string, bool) {
+	newName, i := r.lookup(filename)
+	if i < 0 {
+		return filename, false
+	}
+	r.found[i] = true
+	return newName, true
+}
+
+// lookup is like rename, but returns the index of the name that
+// matched, or -1, without recording that it was found.
+func (r renameList) lookup(filename string) (string, int) {
+	trimmed := strings.TrimSuffix(filename, "/")
+	match := -1
+	for i, name := range r.names {
+		// the most specific name wins
+		if fileIsIncluded([]string{name}, trimmed) && (match < 0 || len(name) > len(r.names[match])) {
+			match = i
+		}
+	}
+	if match < 0 {
+		return filename, -1
+	}
+	newName := strings.TrimPrefix(path.Join(r.to[match], strings.TrimPrefix(trimmed, r.names[match])), "/")
+	if newName != "" && strings.HasSuffix(filename, "/") {
+		newName += "/"
+	}
+	return newName, match
+}
+
+// zeroData overwrites the bytes of ws from offset start up to end with zeros.
+func zeroData(ws io.WriteSeeker, start, end int64) error {
+	if start >= end {
+		return nil
+	}
+	if _, err := ws.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := io.CopyN(ws, zeroReader{}, end-start)
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// truncater is implemented by files that can be truncated, like *os.File.
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// seekerReaderAt adapts an io.ReadSeeker to an io.ReaderAt.
+// It is not safe for concurrent use.
+type seekerReaderAt struct {
+	io.ReadSeeker
+}
+
+func (s seekerReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := s.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// seekerWriter writes sequentially to an io.WriteSeeker starting at
+// offset, seeking before each write so that its writes can be
+// interleaved with reads of the same stream.
+type seekerWriter struct {
+	ws     io.WriteSeeker
+	offset int64
+}
+
+func (s *seekerWriter) Write(p []byte) (int, error) {
+	if _, err := s.ws.Seek(s.offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := s.ws.Write(p)
+	s.offset += int64(n)
+	return n, err
+}
+
+// readCounter counts the bytes read from the underlying reader.
+type readCounter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *readCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// writeCounter counts the bytes written to the underlying writer.
+type writeCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *writeCounter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// nopWriteCloser is an io.WriteCloser
+// whose Close method does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// concatenator is implemented by compression formats whose compressed
+// streams can be concatenated, such that the result decompresses to the
+// concatenation of their contents. Each compressed stream in such a
+// sequence is called a member (or frame) and can also be decompressed
+// on its own.
+type concatenator interface {
+	Compression
+
+	// members returns the offsets at which the members of the
+	// compressed data, which is size bytes long, begin.
+	members(ra io.ReaderAt, size int64) ([]int64, error)
+}
+
 func isSymlink(info fs.FileInfo) bool {
 	return info.Mode()&os.ModeSymlink != 0
 }
 
+// unixMode returns mode as a Unix file mode (st_mode),
+// as stored by archive formats such as 7z and cpio.
+func unixMode(mode fs.FileMode) uint32 {
+	m := uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		m |= unixModeDir
+	case mode&fs.ModeSymlink != 0:
+		m |= unixModeSymlink
+	case mode&fs.ModeNamedPipe != 0:
+		m |= unixModeFIFO
+	case mode&fs.ModeSocket != 0:
+		m |= unixModeSocket
+	case mode&fs.ModeCharDevice != 0:
+		m |= unixModeCharDevice
+	case mode&fs.ModeDevice != 0:
+		m |= unixModeBlockDevice
+	default:
+		m |= unixModeRegular
+	}
+	if mode&fs.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 01000
+	}
+	return m
+}
+
+// fileModeFromUnix is the inverse of unixMode.
+func fileModeFromUnix(m uint32) fs.FileMode {
+	mode := fs.FileMode(m & 0777)
+	switch m & unixModeType {
+	case unixModeDir:
+		mode |= fs.ModeDir
+	case unixModeSymlink:
+		mode |= fs.ModeSymlink
+	case unixModeFIFO:
+		mode |= fs.ModeNamedPipe
+	case unixModeSocket:
+		mode |= fs.ModeSocket
+	case unixModeCharDevice:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case unixModeBlockDevice:
+		mode |= fs.ModeDevice
+	}
+	if m&04000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// The file type bits of a Unix file mode.
+const (
+	unixModeType        = 0170000
+	unixModeSocket      = 0140000
+	unixModeSymlink     = 0120000
+	unixModeRegular     = 0100000
+	unixModeBlockDevice = 0060000
+	unixModeDir         = 0040000
+	unixModeCharDevice  = 0020000
+	unixModeFIFO        = 0010000
+)
+
 // streamSizeBySeeking determines the size of the stream by
 // seeking to the end, then back again, so the resulting
 // seek position upon returning is the same as when called
@@ -1,10 +1,20 @@
 package archiver
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestTrimTopDir(t *testing.T) {
@@ -264,3 +274,378 @@ func TestNameOnDiskToNameInArchive(t *testing.T) {
 		}
 	}
 }
+
+// filesFromMapFS returns the files in fsys, in lexical order,
+// as FileInfos for archiving. The targets of symbolic links are
+// their Data, as with fstest.MapFS.ReadLink in newer versions of Go.
+func filesFromMapFS(t *testing.T, fsys fstest.MapFS) []FileInfo {
+	t.Helper()
+	var files []FileInfo
+	err := fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil || fpath == "." {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		name := fpath
+		file := FileInfo{
+			FileInfo:      info,
+			NameInArchive: name,
+			Open:          func() (fs.File, error) { return fsys.Open(name) },
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			file.LinkTarget = string(fsys[name].Data)
+		}
+		files = append(files, file)
+		return nil
+	})
+	checkErr(t, err, "walking files")
+	return files
+}
+
+// extractedFile is a file extracted from an archive, with its contents.
+type extractedFile struct {
+	FileInfo
+	contents []byte
+}
+
+// extractFiles extracts the archive from its start and returns its
+// files by their names, with the names of directories ending in a
+// slash. The contents of all files but directories are read.
+func extractFiles(t *testing.T, ex Extractor, archive io.ReadSeeker) map[string]extractedFile {
+	t.Helper()
+	_, err := archive.Seek(0, io.SeekStart)
+	checkErr(t, err, "seeking to start of archive")
+	files := make(map[string]extractedFile)
+	err = ex.Extract(context.Background(), archive, func(_ context.Context, f FileInfo) error {
+		if f.IsDir() {
+			files[strings.TrimSuffix(f.NameInArchive, "/")+"/"] = extractedFile{FileInfo: f}
+			return nil
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		files[f.NameInArchive] = extractedFile{FileInfo: f, contents: data}
+		return err
+	})
+	checkErr(t, err, "extracting archive")
+	return files
+}
+
+// archiveContents returns the contents of the files in the archive
+// by their names, with directories having empty contents and names
+// ending in a slash.
+func archiveContents(t *testing.T, ex Extractor, archive io.ReadSeeker) map[string]string {
+	t.Helper()
+	contents := make(map[string]string)
+	for name, f := range extractFiles(t, ex, archive) {
+		contents[name] = string(f.contents)
+	}
+	return contents
+}
+
+// roundTrip archives files with format, then extracts them again. It
+// returns the archive and the extracted files, as from extractFiles.
+func roundTrip(t *testing.T, format interface {
+	Archiver
+	Extractor
+}, files []FileInfo) ([]byte, map[string]extractedFile) {
+	t.Helper()
+	// some formats can only be written to files that can seek
+	f, err := os.Create(filepath.Join(t.TempDir(), "archive"))
+	checkErr(t, err, "creating archive")
+	defer f.Close()
+	checkErr(t, format.Archive(context.Background(), f, files), "writing archive")
+	got := extractFiles(t, format, f)
+	_, err = f.Seek(0, io.SeekStart)
+	checkErr(t, err, "seeking to start of archive")
+	archive, err := io.ReadAll(f)
+	checkErr(t, err, "reading archive")
+	return archive, got
+}
+
+// checkExtractedFiles checks that the files extracted from an archive
+// are the files in want, with the same modes, modification times,
+// contents of regular files, and targets of symbolic links.
+func checkExtractedFiles(t *testing.T, got map[string]extractedFile, want fstest.MapFS) {
+	t.Helper()
+	if len(got) != len(want) {
+		var names []string
+		for name := range got {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		t.Errorf("expected %d files but got %d: %v", len(want), len(got), names)
+	}
+	for name, w := range want {
+		if w.Mode.IsDir() {
+			name += "/"
+		}
+		f, ok := got[name]
+		if !ok {
+			t.Errorf("expected %s in archive, but it was not", name)
+			continue
+		}
+		if f.Mode() != w.Mode {
+			t.Errorf("%s: expected mode %s but got %s", name, w.Mode, f.Mode())
+		}
+		if !f.ModTime().Equal(w.ModTime) {
+			t.Errorf("%s: expected modification time %s but got %s", name, w.ModTime, f.ModTime())
+		}
+		switch {
+		case w.Mode.IsRegular() && !bytes.Equal(f.contents, w.Data):
+			t.Errorf("%s: expected %d bytes of contents but got %d", name, len(w.Data), len(f.contents))
+		case w.Mode&fs.ModeSymlink != 0 && f.LinkTarget != string(w.Data):
+			t.Errorf("%s: expected link target %q but got %q", name, w.Data, f.LinkTarget)
+		}
+	}
+}
+
+// testDelete checks that deleting from an archive created by format
+// removes the named files and keeps all the others intact.
+func testDelete(t *testing.T, format interface {
+	Format
+	Archiver
+	Extractor
+	Deleter
+}) {
+	fsys := fstest.MapFS{
+		"a.txt":         {Data: []byte("first file"), Mode: 0644},
+		"secret.txt":    {Data: bytes.Repeat([]byte("secret"), 1000), Mode: 0600},
+		"dir":           {Mode: fs.ModeDir | 0755},
+		"dir/b.txt":     {Data: []byte("in a directory"), Mode: 0644},
+		"dir/sub":       {Mode: fs.ModeDir | 0755},
+		"dir/sub/c.txt": {Data: []byte("in a subdirectory"), Mode: 0644},
+		"z.txt":         {Data: []byte("last file"), Mode: 0644},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		delete   []string
+		expect   []string
+		truncate bool
+	}{
+		{name: "file", delete: []string{"secret.txt"}, expect: []string{"a.txt", "dir/", "dir/b.txt", "dir/sub/", "dir/sub/c.txt", "z.txt"}, truncate: true},
+		{name: "directory", delete: []string{"dir/"}, expect: []string{"a.txt", "secret.txt", "z.txt"}, truncate: true},
+		{name: "first and last", delete: []string{"a.txt", "z.txt"}, expect: []string{"secret.txt", "dir/", "dir/b.txt", "dir/sub/", "dir/sub/c.txt"}, truncate: true},
+		{name: "without truncating", delete: []string{"secret.txt", "dir/sub"}, expect: []string{"a.txt", "dir/", "dir/b.txt", "z.txt"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "archive"+format.Extension()))
+			checkErr(t, err, "creating archive")
+			defer f.Close()
+			err = format.Archive(context.Background(), f, filesFromMapFS(t, fsys))
+			checkErr(t, err, "writing archive")
+			before := archiveContents(t, format, f)
+			sizeBefore, err := f.Seek(0, io.SeekEnd)
+			checkErr(t, err, "getting size")
+
+			var archive io.ReadWriteSeeker = f
+			if !tc.truncate {
+				archive = struct{ io.ReadWriteSeeker }{f} // hide Truncate method
+			}
+			_, err = f.Seek(0, io.SeekStart)
+			checkErr(t, err, "seeking to start of archive")
+			err = format.Delete(context.Background(), archive, tc.delete)
+			checkErr(t, err, "deleting %v", tc.delete)
+
+			after := archiveContents(t, format, f)
+			if len(after) != len(tc.expect) {
+				t.Errorf("expected %d files after deleting %v, but got %d: %v", len(tc.expect), tc.delete, len(after), after)
+			}
+			for _, name := range tc.expect {
+				if after[name] != before[name] {
+					t.Errorf("expected %s to contain '%s' after deleting, but got '%s'", name, before[name], after[name])
+				}
+			}
+
+			sizeAfter, err := f.Seek(0, io.SeekEnd)
+			checkErr(t, err, "getting size")
+			if tc.truncate && sizeAfter >= sizeBefore {
+				t.Errorf("expected archive to shrink from %d bytes, but it is %d bytes", sizeBefore, sizeAfter)
+			}
+			if !tc.truncate && sizeAfter != sizeBefore {
+				t.Errorf("expected archive to stay %d bytes, but it is %d bytes", sizeBefore, sizeAfter)
+			}
+			_, err = f.Seek(0, io.SeekStart)
+			checkErr(t, err, "seeking to start of archive")
+			contents, err := io.ReadAll(f)
+			checkErr(t, err, "reading archive")
+			if bytes.Contains(contents, []byte("secretsecret")) && !slices.Contains(tc.expect, "secret.txt") {
+				t.Errorf("expected deleted file contents to be gone from the archive")
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		f, err := os.Create(filepath.Join(t.TempDir(), "archive"+format.Extension()))
+		checkErr(t, err, "creating archive")
+		defer f.Close()
+		err = format.Archive(context.Background(), f, filesFromMapFS(t, fsys))
+		checkErr(t, err, "writing archive")
+		_, err = f.Seek(0, io.SeekStart)
+		checkErr(t, err, "seeking to start of archive")
+
+		err = format.Delete(context.Background(), f, []string{"a.txt", "missing.txt"})
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected error wrapping fs.ErrNotExist, but got: %v", err)
+		}
+		if contents := archiveContents(t, format, f); len(contents) != len(fsys) {
+			t.Errorf("expected archive to be unchanged, but it has %d files: %v", len(contents), contents)
+		}
+	})
+}
+
+// createArchive writes an archive of the files in fsys to a temporary
+// file, which is returned seeked to the start.
+func createArchive(t *testing.T, format Archiver, fsys fstest.MapFS) *os.File {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "archive"))
+	checkErr(t, err, "creating archive")
+	t.Cleanup(func() { f.Close() })
+	err = format.Archive(context.Background(), f, filesFromMapFS(t, fsys))
+	checkErr(t, err, "writing archive")
+	_, err = f.Seek(0, io.SeekStart)
+	checkErr(t, err, "seeking to start of archive")
+	return f
+}
+
+// testRename checks that renaming files in an archive created by
+// format gives them their new names and keeps their contents.
+func testRename(t *testing.T, format interface {
+	Archiver
+	Extractor
+	Renamer
+}) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"pkg-1.2.3":              {Mode: fs.ModeDir | 0755, ModTime: modTime},
+		"pkg-1.2.3/README":       {Data: []byte("read me"), Mode: 0644, ModTime: modTime},
+		"pkg-1.2.3/src":          {Mode: fs.ModeDir | 0755, ModTime: modTime},
+		"pkg-1.2.3/src/main.go":  {Data: bytes.Repeat([]byte("package main\n"), 500), Mode: 0644, ModTime: modTime},
+		"pkg-1.2.3/src/util.go":  {Data: []byte("package util\n"), Mode: 0600, ModTime: modTime},
+		"pkg-1.2.3/zz_last.data": {Data: []byte("last"), Mode: 0644, ModTime: modTime},
+	}
+	longName := strings.Repeat("very-long-directory-name/", 8) + "main.go"
+
+	for _, tc := range []struct {
+		name     string
+		renames  map[string]string
+		expect   map[string]string // new name to old name
+		truncate bool
+	}{
+		{
+			name:    "strip prefix",
+			renames: map[string]string{"pkg-1.2.3": ""},
+			expect: map[string]string{
+				"README": "pkg-1.2.3/README", "src/": "pkg-1.2.3/src/", "src/main.go": "pkg-1.2.3/src/main.go",
+				"src/util.go": "pkg-1.2.3/src/util.go", "zz_last.data": "pkg-1.2.3/zz_last.data",
+			},
+			truncate: true,
+		},
+		{
+			name:    "longer names",
+			renames: map[string]string{"pkg-1.2.3/src/main.go": longName, "pkg-1.2.3/README": "pkg-1.2.3/README.ünïcode"},
+			expect: map[string]string{
+				"pkg-1.2.3/": "pkg-1.2.3/", "pkg-1.2.3/README.ünïcode": "pkg-1.2.3/README", "pkg-1.2.3/src/": "pkg-1.2.3/src/",
+				longName: "pkg-1.2.3/src/main.go", "pkg-1.2.3/src/util.go": "pkg-1.2.3/src/util.go", "pkg-1.2.3/zz_last.data": "pkg-1.2.3/zz_last.data",
+			},
+			truncate: true,
+		},
+		{
+			name:    "most specific wins",
+			renames: map[string]string{"pkg-1.2.3": "pkg", "pkg-1.2.3/src": "source/"},
+			expect: map[string]string{
+				"pkg/": "pkg-1.2.3/", "pkg/README": "pkg-1.2.3/README", "source/": "pkg-1.2.3/src/", "source/main.go": "pkg-1.2.3/src/main.go",
+				"source/util.go": "pkg-1.2.3/src/util.go", "pkg/zz_last.data": "pkg-1.2.3/zz_last.data",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := createArchive(t, format, fsys)
+			before := archiveContents(t, format, f)
+
+			var archive io.ReadWriteSeeker = f
+			if !tc.truncate {
+				archive = struct{ io.ReadWriteSeeker }{f} // hide Truncate method
+			}
+			_, err := f.Seek(0, io.SeekStart)
+			checkErr(t, err, "seeking to start of archive")
+			err = format.Rename(context.Background(), archive, tc.renames)
+			checkErr(t, err, "renaming %v", tc.renames)
+
+			after := archiveContents(t, format, f)
+			if len(after) != len(tc.expect) {
+				t.Errorf("expected %d files after renaming, but got %d: %v", len(tc.expect), len(after), after)
+			}
+			for newName, oldName := range tc.expect {
+				if content, ok := after[newName]; !ok {
+					t.Errorf("expected %s in archive after renaming, but it was not", newName)
+				} else if content != before[oldName] {
+					t.Errorf("expected %s to contain '%s' after renaming, but got '%s'", newName, before[oldName], content)
+				}
+			}
+
+			_, err = f.Seek(0, io.SeekStart)
+			checkErr(t, err, "seeking to start of archive")
+			err = format.Extract(context.Background(), f, func(_ context.Context, fi FileInfo) error {
+				if !fi.ModTime().Equal(modTime) {
+					t.Errorf("%s: expected modification time %s after renaming, but got %s", fi.NameInArchive, modTime, fi.ModTime())
+				}
+				return nil
+			})
+			checkErr(t, err, "extracting archive")
+		})
+	}
+
+	for _, tc := range []struct {
+		name    string
+		renames map[string]string
+		err     error
+	}{
+		{name: "not found", renames: map[string]string{"pkg-1.2.3/README": "README", "missing": "found"}, err: fs.ErrNotExist},
+		{name: "already exists", renames: map[string]string{"pkg-1.2.3/README": "pkg-1.2.3/zz_last.data"}, err: fs.ErrExist},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			f := createArchive(t, format, fsys)
+			before := archiveContents(t, format, f)
+			_, err := f.Seek(0, io.SeekStart)
+			checkErr(t, err, "seeking to start of archive")
+
+			err = format.Rename(context.Background(), f, tc.renames)
+			if !errors.Is(err, tc.err) {
+				t.Errorf("expected error wrapping %v, but got: %v", tc.err, err)
+			}
+			if after := archiveContents(t, format, f); !reflect.DeepEqual(before, after) {
+				t.Errorf("expected archive to be unchanged, but it has: %v", after)
+			}
+		})
+	}
+}
+
+// copyArchive copies the entries of the archive read from src by ex into
+// a new archive written to dst by to, as they are extracted. If modify is
+// not nil, it is called on each entry before it is written.
+func copyArchive(t *testing.T, ex Extractor, src io.Reader, to ArchiverAsync, dst io.Writer, modify func(*FileInfo)) {
+	t.Helper()
+	ctx := context.Background()
+	jobs := make(chan ArchiveAsyncJob)
+	done := make(chan error, 1)
+	go func() { done <- to.ArchiveAsync(ctx, dst, jobs) }()
+	err := ex.Extract(ctx, src, func(_ context.Context, f FileInfo) error {
+		if modify != nil {
+			modify(&f)
+		}
+		result := make(chan error)
+		jobs <- ArchiveAsyncJob{File: f, Result: result}
+		return <-result
+	})
+	close(jobs)
+	checkErr(t, err, "copying entries")
+	checkErr(t, <-done, "writing archive")
+}
@@ -30,11 +30,15 @@ func (br Brotli) Match(_ context.Context, filename string, stream io.Reader) (Ma
 	// brotli does not have well-defined file headers or a magic number;
 	// the best way to match the stream is probably to try decoding part
 	// of it, but we'll just have to guess a large-enough size that is
-	// still small enough for the smallest streams we'll encounter
-	r := brotli.NewReader(stream)
-	buf := make([]byte, 16)
-	if _, err := io.ReadFull(r, buf); err == nil {
-		mr.ByStream = true
+	// still small enough for the smallest streams we'll encounter;
+	// there is no stream when matching by name alone, and the brotli
+	// reader panics when reading from a nil reader
+	if stream != nil {
+		r := brotli.NewReader(stream)
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(r, buf); err == nil {
+			mr.ByStream = true
+		}
 	}
 
 	return mr, nil
@@ -48,4 +48,45 @@ func (Bz2) OpenReader(r io.Reader) (io.ReadCloser, error) {
 	return bzip2.NewReader(r, nil)
 }
 
+// members finds the bzip2 streams in ra by looking for their headers.
+// Since the end of a stream is not byte-aligned, a stream is taken to
+// begin wherever a stream header is immediately followed by the magic
+// number of a block or of the end of a stream, which is unlikely enough
+// to occur by chance in compressed data.
+func (Bz2) members(ra io.ReaderAt, size int64) ([]int64, error) {
+	const headerLen = 10 // "BZh", block size, then 6 bytes of magic
+	offsets := []int64{0}
+	buf := make([]byte, 64*1024)
+	for pos := int64(0); pos < size; {
+		n, err := ra.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		chunk := buf[:n]
+		for i := 0; i+headerLen <= len(chunk); i++ {
+			j := bytes.Index(chunk[i:], bzip2Header)
+			if j < 0 || i+j+headerLen > len(chunk) {
+				break // any header cut off is found in the next chunk
+			}
+			i += j
+			header := chunk[i : i+headerLen]
+			if pos+int64(i) > 0 && header[3] >= '1' && header[3] <= '9' &&
+				(bytes.Equal(header[4:], bzip2BlockMagic) || bytes.Equal(header[4:], bzip2EndMagic)) {
+				offsets = append(offsets, pos+int64(i))
+			}
+		}
+		if pos+int64(n) >= size || n < headerLen {
+			break
+		}
+		pos += int64(n - headerLen + 1)
+	}
+	return offsets, nil
+}
+
 var bzip2Header = []byte("BZh")
+
+// magic numbers at the beginning of a bzip2 block and at the end of a stream
+var (
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zip"
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "archive",
+		usage: "[flags] <output> <files...>",
+		short: "Create an archive from files on disk",
+		run:   cmdArchive,
+	})
+}
+
+func cmdArchive(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var options archiver.FromDiskOptions
+	fl.BoolVar(&options.FollowSymlinks, "follow-symlinks", false, "Add the files that symbolic links point to instead of the links")
+	fl.BoolVar(&options.ClearAttributes, "clear-attributes", false, "Do not preserve file attributes other than name, size, type, and permissions")
+	formatName := fl.String("format", "", "Archive format, as a file extension (e.g. tar.gz); by default, the output file's extension is used")
+	overwrite := fl.Bool("overwrite", false, "Replace the output file if it already exists")
+	password := fl.String("password", "", "Encrypt the files with this password (zip)")
+	method := fl.String("method", "deflate", "Compression method for zip archives: store, deflate, bzip2, zstd, or xz")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 2 {
+		return usageError("an output file and at least one input file are required")
+	}
+	output, inputs := fl.Arg(0), fl.Args()[1:]
+
+	formatFrom := output
+	if *formatName != "" {
+		formatFrom = "." + *formatName
+	} else if output == "-" {
+		return usageError("-format is required when writing to standard output")
+	}
+	format, err := formatByExtension(ctx, formatFrom)
+	if err != nil {
+		return err
+	}
+	format = formatOptions{password: *password}.apply(format)
+	format, err = withZipMethod(format, *method)
+	if err != nil {
+		return err
+	}
+	archival, ok := format.(archiver.Archiver)
+	if !ok {
+		return fmt.Errorf("cannot create %s archives", format.Extension())
+	}
+
+	// map each input to the root of the archive; FilesFromDisk
+	// handles trailing separators and the like
+	filenames := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		filenames[input] = ""
+	}
+	files, err := archiver.FilesFromDisk(&options, filenames)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(output, *overwrite, func(w io.Writer) error {
+		return archival.Archive(ctx, w, files)
+	})
+}
+
+// zipMethods are the compression methods of zip archives by name.
+var zipMethods = map[string]uint16{
+	"store":   zip.Store,
+	"deflate": zip.Deflate,
+	"bzip2":   archiver.ZipMethodBzip2,
+	"zstd":    archiver.ZipMethodZstd,
+	"xz":      archiver.ZipMethodXz,
+}
+
+// withZipMethod returns format configured to compress files with the
+// named method if it is a zip format; other formats are returned as
+// they are. The registered zip format stores files uncompressed, so
+// archives should always be created with a method from the flag.
+func withZipMethod(format archiver.Format, method string) (archiver.Format, error) {
+	switch f := format.(type) {
+	case archiver.Archive:
+		if z, ok := f.Archival.(archiver.Zip); ok {
+			zf, err := withZipMethod(z, method)
+			if err != nil {
+				return nil, err
+			}
+			f.Archival = zf.(archiver.Zip)
+		}
+		return f, nil
+	case archiver.Zip:
+		m, ok := zipMethods[strings.ToLower(method)]
+		if !ok {
+			return nil, usageError("unknown zip compression method: %s", method)
+		}
+		f.Compression = m
+		return f, nil
+	}
+	return format, nil
+}
+
+// writeOutput creates the output file, or uses standard output if the
+// name is "-", and calls write to write to it. If write fails, the
+// partially-written output file is removed.
+func writeOutput(output string, overwrite bool, write func(w io.Writer) error) error {
+	if output == "-" {
+		return write(os.Stdout)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !overwrite {
+		flags |= os.O_EXCL
+	}
+	out, err := os.OpenFile(output, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if err := write(out); err != nil {
+		out.Close()
+		os.Remove(output)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(output)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+	"github.com/mholt/archiver/v4"
+)
+
+func TestWithZipMethod(t *testing.T) {
+	for _, tc := range []struct {
+		filename string
+		method   string
+		want     uint16
+	}{
+		{filename: "out.zip", method: "deflate", want: zip.Deflate},
+		{filename: "out.zip", method: "store", want: zip.Store},
+		{filename: "out.zip", method: "ZSTD", want: archiver.ZipMethodZstd},
+	} {
+		format, err := formatByExtension(context.Background(), tc.filename)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.filename, err)
+		}
+		format, err = withZipMethod(format, tc.method)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.method, err)
+		}
+		z, ok := format.(archiver.Archive).Archival.(archiver.Zip)
+		if !ok || z.Compression != tc.want {
+			t.Errorf("%s: expected zip format with method %d but got %#v", tc.method, tc.want, format)
+		}
+	}
+
+	if _, err := withZipMethod(archiver.Zip{}, "unknown"); err == nil {
+		t.Error("expected an error for an unknown method")
+	}
+	if format, err := withZipMethod(archiver.Tar{}, "unknown"); err != nil || format != (archiver.Tar{}) {
+		t.Errorf("expected other formats to be returned as they are, but got %#v, %v", format, err)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "cat",
+		usage: "[flags] <archive> <paths...>\n       arc cat [flags] <compressed file>",
+		short: "Write files from an archive, or a decompressed file, to standard output",
+		run:   cmdCat,
+	})
+}
+
+func cmdCat(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var fo formatOptions
+	fo.register(fl)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 1 {
+		return usageError("an input file is required")
+	}
+	name, paths := fl.Arg(0), fl.Args()[1:]
+
+	in, err := openInput(ctx, name, fo)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	var fsys fs.FS
+	switch format := in.format.(type) {
+	case archiver.Extractor:
+		if len(paths) == 0 {
+			return usageError("at least one path within the archive is required")
+		}
+		fsys, err = in.archiveFS(ctx, format)
+		if err != nil {
+			return err
+		}
+	case archiver.Compression:
+		if len(paths) > 0 {
+			return usageError("%s is a compressed file, not an archive; paths are not allowed", in.name)
+		}
+		if in.file == nil {
+			// standard input can be decompressed as it streams in
+			return decompressTo(format, in.stream, os.Stdout)
+		}
+		fsys, paths = archiver.FileFS{Path: name, Compression: format}, []string{"."}
+	default:
+		return fmt.Errorf("%s: %s is neither an archive nor a compressed file", in.name, in.format.Extension())
+	}
+
+	for _, p := range paths {
+		if err := catFile(fsys, p, os.Stdout); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// catFile copies the contents of the named file in fsys to w.
+func catFile(fsys fs.FS, name string, w io.Writer) error {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.IsDir() {
+		return fmt.Errorf("%s: is a directory", name)
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// decompressTo writes the decompressed contents of r to w.
+func decompressTo(format archiver.Decompressor, r io.Reader, w io.Writer) error {
+	rc, err := format.OpenReader(r)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(w, rc)
+	return err
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mholt/archiver/v4"
+	"github.com/pierrec/lz4/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "compress",
+		usage: "[flags] [files...]",
+		short: "Compress files, or standard input, like gzip(1)",
+		run:   cmdCompress,
+	})
+	registerCommand(command{
+		name:  "decompress",
+		usage: "[flags] [files...]",
+		short: "Decompress files, or standard input, of any compression format",
+		run:   cmdDecompress,
+	})
+}
+
+// streamOptions are the options common to compress and decompress,
+// which behave like gzip(1): each file is replaced by its compressed
+// (or decompressed) counterpart unless -k or -c is given, and
+// standard input is used if there are no files or a file is "-".
+type streamOptions struct {
+	keep, force, stdout bool
+	output              string
+}
+
+func (so *streamOptions) register(fl *flag.FlagSet) {
+	fl.BoolVar(&so.keep, "k", false, "Keep (don't delete) input files")
+	fl.BoolVar(&so.force, "f", false, "Overwrite existing output files")
+	fl.BoolVar(&so.stdout, "c", false, "Write to standard output and keep input files")
+	fl.StringVar(&so.output, "o", "", "Output file name (only with a single input)")
+}
+
+// inputs returns the input files named by args, defaulting to standard input.
+func (so streamOptions) inputs(args []string) ([]string, error) {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	if so.output != "" && len(args) > 1 {
+		return nil, usageError("-o can only be used with a single input")
+	}
+	if so.output != "" && so.stdout {
+		return nil, usageError("-o and -c are mutually exclusive")
+	}
+	return args, nil
+}
+
+func cmdCompress(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var so streamOptions
+	so.register(fl)
+	formatName := fl.String("format", "", "Compression format, as a file extension (e.g. zst); by default, the extension of -o is used, or else gz")
+	level := fl.Int("level", 0, "Compression level; the range depends on the format (0 means the format's default)")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	inputs, err := so.inputs(fl.Args())
+	if err != nil {
+		return err
+	}
+
+	formatFrom := ".gz"
+	if *formatName != "" {
+		formatFrom = "." + strings.TrimPrefix(*formatName, ".")
+	} else if so.output != "" {
+		formatFrom = so.output
+	}
+	format, err := formatByExtension(ctx, formatFrom)
+	if err != nil {
+		return err
+	}
+	comp, ok := format.(archiver.Compression)
+	if _, isArchive := format.(archiver.Archive); isArchive || !ok {
+		return fmt.Errorf("%s is not a compression format", format.Extension())
+	}
+	comp, err = withLevel(comp, *level)
+	if err != nil {
+		return err
+	}
+
+	for _, input := range inputs {
+		output := so.output
+		if output == "" && input != "-" && !so.stdout {
+			if strings.HasSuffix(strings.ToLower(input), comp.Extension()) && !so.force {
+				fmt.Fprintf(os.Stderr, "arc compress: %s already has %s suffix -- unchanged\n", input, comp.Extension())
+				continue
+			}
+			output = input + comp.Extension()
+		}
+		in, err := openRaw(input)
+		if err != nil {
+			return err
+		}
+		err = so.convert(in, output, func(w io.Writer, r io.Reader) error {
+			wc, err := comp.OpenWriter(w)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(wc, r); err != nil {
+				wc.Close()
+				return err
+			}
+			return wc.Close()
+		})
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cmdDecompress(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var so streamOptions
+	so.register(fl)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	inputs, err := so.inputs(fl.Args())
+	if err != nil {
+		return err
+	}
+
+	for _, input := range inputs {
+		in, err := openRaw(input)
+		if err != nil {
+			return err
+		}
+		err = so.decompress(ctx, in, input)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// decompress decompresses the opened input file named input.
+func (so streamOptions) decompress(ctx context.Context, in *input, input string) error {
+	format, stream, err := archiver.Identify(ctx, "", in.stream)
+	if err != nil {
+		return fmt.Errorf("%s: identifying format: %w", in.name, err)
+	}
+	in.stream = stream
+
+	// a compressed archive is decompressed to the archive
+	comp, ok := format.(archiver.Compression)
+	if ar, isArchive := format.(archiver.Archive); isArchive {
+		comp, ok = ar.Compression, ar.Compression != nil
+	}
+	if !ok {
+		return fmt.Errorf("%s: not compressed (format is %s)", in.name, format.Extension())
+	}
+
+	output := so.output
+	if output == "" && input != "-" && !so.stdout {
+		ext := comp.Extension()
+		if !strings.HasSuffix(strings.ToLower(input), ext) {
+			return fmt.Errorf("%s: unknown suffix (expected %s); use -o or -c", input, ext)
+		}
+		output = input[:len(input)-len(ext)]
+	}
+
+	return so.convert(in, output, func(w io.Writer, r io.Reader) error {
+		return decompressTo(comp, r, w)
+	})
+}
+
+// convert reads the input and writes the output file with the
+// conversion function. If output is empty, the result is written to
+// standard output. When converting a file to a file, the output gets
+// the permissions and modification time of the input, which is then
+// removed unless it should be kept.
+func (so streamOptions) convert(in *input, output string, conv func(w io.Writer, r io.Reader) error) error {
+	if output == "" {
+		output = "-"
+	}
+
+	var info os.FileInfo
+	if in.file != nil {
+		var err error
+		info, err = in.file.Stat()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("%s: not a regular file", in.name)
+		}
+	}
+
+	err := writeOutput(output, so.force, func(w io.Writer) error {
+		return conv(w, in.stream)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", in.name, err)
+	}
+	if info == nil || output == "-" {
+		return nil
+	}
+
+	if err := os.Chmod(output, info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(output, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if !so.keep && !so.stdout {
+		in.Close()
+		return os.Remove(in.name)
+	}
+	return nil
+}
+
+// withLevel returns comp configured to compress at the given level,
+// or an error if the level is not valid for the format. A level of 0
+// leaves the format's default level unchanged.
+func withLevel(comp archiver.Compression, level int) (archiver.Compression, error) {
+	if level == 0 {
+		return comp, nil
+	}
+	outOfRange := func(min, max int) error {
+		return usageError("%s compression level must be between %d and %d", comp.Extension(), min, max)
+	}
+	switch c := comp.(type) {
+	case archiver.Gz:
+		if level < 1 || level > 9 {
+			return nil, outOfRange(1, 9)
+		}
+		c.CompressionLevel = level
+		return c, nil
+	case archiver.Bz2:
+		if level < 1 || level > 9 {
+			return nil, outOfRange(1, 9)
+		}
+		c.CompressionLevel = level
+		return c, nil
+	case archiver.Zlib:
+		if level < 1 || level > 9 {
+			return nil, outOfRange(1, 9)
+		}
+		c.CompressionLevel = level
+		return c, nil
+	case archiver.Lz4:
+		if level < 1 || level > 9 {
+			return nil, outOfRange(1, 9)
+		}
+		c.CompressionLevel = int(lz4.Level1) << (level - 1)
+		return c, nil
+	case archiver.Brotli:
+		if level < 1 || level > 11 {
+			return nil, outOfRange(1, 11)
+		}
+		c.Quality = level
+		return c, nil
+	case archiver.Zstd:
+		if level < 1 || level > 22 {
+			return nil, outOfRange(1, 22)
+		}
+		c.EncoderOptions = append(c.EncoderOptions, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		return c, nil
+	case archiver.Sz:
+		if level < 1 || level > 3 {
+			return nil, outOfRange(1, 3)
+		}
+		c.S2.Compression = archiver.S2Level(level)
+		return c, nil
+	}
+	return nil, usageError("%s does not support compression levels", comp.Extension())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "convert",
+		usage: "[flags] <input> <output>",
+		short: "Convert an archive or compressed file to another format",
+		run:   cmdConvert,
+	})
+}
+
+func cmdConvert(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var fo formatOptions
+	fo.register(fl)
+	formatName := fl.String("format", "", "Output format, as a file extension (e.g. tar.zst); by default, the output file's extension is used")
+	overwrite := fl.Bool("overwrite", false, "Replace the output file if it already exists")
+	method := fl.String("method", "deflate", "Compression method for zip archives: store, deflate, bzip2, zstd, or xz")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() != 2 {
+		return usageError("an input file and an output file are required")
+	}
+	inputName, output := fl.Arg(0), fl.Arg(1)
+
+	formatFrom := output
+	if *formatName != "" {
+		formatFrom = "." + *formatName
+	} else if output == "-" {
+		return usageError("-format is required when writing to standard output")
+	}
+	outFormat, err := formatByExtension(ctx, formatFrom)
+	if err != nil {
+		return err
+	}
+	outFormat, err = withZipMethod(outFormat, *method)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(ctx, inputName, fo)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// archives are converted entry by entry; compressed
+	// files are simply decompressed and recompressed
+	if ex, ok := in.format.(archiver.Extractor); ok {
+		to, ok := outFormat.(archiver.ArchiverAsync)
+		if !ok {
+			return fmt.Errorf("cannot convert to %s: it is not a format that archives can be streamed into", outFormat.Extension())
+		}
+		return writeOutput(output, *overwrite, func(w io.Writer) error {
+			return transcode(ctx, ex, in.stream, to, w, nil, nil)
+		})
+	}
+
+	decomp, ok := in.format.(archiver.Decompressor)
+	if !ok {
+		return fmt.Errorf("%s: cannot convert %s files", in.name, in.format.Extension())
+	}
+	// an Archive is also a Compression, since it embeds one
+	comp, ok := outFormat.(archiver.Compression)
+	if _, isArchive := outFormat.(archiver.Archive); isArchive || !ok {
+		return fmt.Errorf("cannot convert a compressed file to %s: it is not a compression format", outFormat.Extension())
+	}
+	return writeOutput(output, *overwrite, func(w io.Writer) error {
+		wc, err := comp.OpenWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := decompressTo(decomp, in.stream, wc); err != nil {
+			wc.Close()
+			return err
+		}
+		return wc.Close()
+	})
+}
+
+// transcode streams the entries of the archive read from src into a new
+// archive written to w, without writing them to disk. If filter is not
+// nil, it is called for each entry and may modify it; entries for which
+// filter returns false are omitted from the new archive. The extra files,
+// if any, are added to the end of the new archive.
+func transcode(ctx context.Context, from archiver.Extractor, src io.Reader, to archiver.ArchiverAsync, w io.Writer, filter func(*archiver.FileInfo) bool, extra []archiver.FileInfo) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan archiver.ArchiveAsyncJob)
+	archiveErr := make(chan error, 1)
+	go func() {
+		archiveErr <- to.ArchiveAsync(ctx, w, jobs)
+	}()
+
+	// an entry can only be read while its handler is running,
+	// so wait for each one to be archived before moving on
+	result := make(chan error)
+	archiveFile := func(f archiver.FileInfo) error {
+		select {
+		case jobs <- archiver.ArchiveAsyncJob{File: f, Result: result}:
+		case err := <-archiveErr:
+			archiveErr <- err // keep it for below
+			return fmt.Errorf("writing archive: %w", err)
+		}
+		if err := <-result; err != nil {
+			return fmt.Errorf("archiving %s: %w", f.NameInArchive, err)
+		}
+		return nil
+	}
+	extractErr := from.Extract(ctx, src, func(ctx context.Context, f archiver.FileInfo) error {
+		if filter != nil && !filter(&f) {
+			return nil
+		}
+		return archiveFile(f)
+	})
+	for i := 0; extractErr == nil && i < len(extra); i++ {
+		extractErr = archiveFile(extra[i])
+	}
+	close(jobs)
+	if extractErr != nil {
+		cancel()
+		<-archiveErr
+		return extractErr
+	}
+	return <-archiveErr
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "diff",
+		usage: "[flags] <archive or directory> <archive or directory>",
+		short: "Compare the contents of archives and directories",
+		run:   cmdDiff,
+	})
+}
+
+func cmdDiff(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var options archiver.DiffOptions
+	fl.BoolVar(&options.CompareContents, "content", false, "Also compare the contents of files that are the same size")
+	fl.BoolVar(&options.IgnoreModTime, "ignore-mtime", false, "Do not compare modification times")
+	fl.DurationVar(&options.ModTimeTolerance, "mtime-tolerance", 2*time.Second, "Ignore differences in modification times up to this amount")
+	rootA := fl.String("root1", ".", "Directory within the first input to compare")
+	rootB := fl.String("root2", ".", "Directory within the second input to compare")
+	asJSON := fl.Bool("json", false, "Print one JSON object per difference")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() != 2 {
+		return usageError("two archives or directories are required")
+	}
+
+	a, err := diffFileSystem(ctx, fl.Arg(0), *rootA)
+	if err != nil {
+		return err
+	}
+	b, err := diffFileSystem(ctx, fl.Arg(1), *rootB)
+	if err != nil {
+		return err
+	}
+
+	diffs, err := archiver.Diff(ctx, a, b, &options)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, d := range diffs {
+		if *asJSON {
+			err = enc.Encode(diffJSON{
+				Path:    d.Path,
+				Type:    d.Type.String(),
+				Changes: d.Changes.String(),
+			})
+		} else {
+			_, err = fmt.Println(d)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// like diff(1), exit with 1 if the inputs differ
+	if len(diffs) > 0 {
+		return exitError{code: exitFailure}
+	}
+	return nil
+}
+
+// diffJSON is the JSON representation of a difference.
+type diffJSON struct {
+	Path    string `json:"path"`
+	Type    string `json:"type"`
+	Changes string `json:"changes,omitempty"`
+}
+
+// diffFileSystem returns the file system of the named archive or
+// directory, rooted at root within it.
+func diffFileSystem(ctx context.Context, name, root string) (fs.FS, error) {
+	fsys, err := archiver.FileSystem(ctx, name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if _, ok := fsys.(archiver.FileFS); ok {
+		return nil, fmt.Errorf("%s: not an archive or directory", name)
+	}
+	if root == "." {
+		return fsys, nil
+	}
+	sub, err := fs.Sub(fsys, root)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return sub, nil
+}
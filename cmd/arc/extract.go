@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "extract",
+		usage: "[flags] <archive> [destination] [paths...]",
+		short: "Extract an archive to disk",
+		run:   cmdExtract,
+	})
+}
+
+func cmdExtract(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var options archiver.ToDiskOptions
+	var fo formatOptions
+	fo.register(fl)
+	fl.BoolVar(&options.Overwrite, "overwrite", false, "Replace existing files")
+	fl.BoolVar(&options.ClearAttributes, "clear-attributes", false, "Do not apply file modes and modification times from the archive")
+	fl.BoolVar(&options.SanitizeNames, "sanitize", false, "Rewrite unsafe entry names to stay within the destination instead of rejecting them")
+	skipUnsafe := fl.Bool("skip-unsafe", false, "Skip (and report) unsafe entries instead of aborting")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 1 {
+		return usageError("an archive file is required")
+	}
+
+	destination := "."
+	if fl.NArg() > 1 {
+		destination = fl.Arg(1)
+	}
+	if fl.NArg() > 2 {
+		options.PathsInArchive = fl.Args()[2:]
+	}
+	if *skipUnsafe {
+		options.OnUnsafeEntry = func(err *archiver.UnsafePathError) error {
+			fmt.Fprintf(os.Stderr, "skipped: %v\n", err)
+			return nil
+		}
+	}
+
+	in, err := openInput(ctx, fl.Arg(0), fo)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	ex, err := in.extractor()
+	if err != nil {
+		return err
+	}
+
+	return archiver.ExtractToDisk(ctx, ex, in.stream, destination, &options)
+}
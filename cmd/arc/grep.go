@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "grep",
+		usage: "[flags] <pattern> <files...>",
+		short: "Search for lines matching a regular expression within archives and compressed files",
+		run:   cmdGrep,
+	})
+}
+
+func cmdGrep(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var fo formatOptions
+	fo.register(fl)
+	ignoreCase := fl.Bool("i", false, "Match case-insensitively")
+	glob := fl.String("glob", "", "Only search entries whose path or base name matches this pattern (e.g. *.log)")
+	filesOnly := fl.Bool("l", false, "Print only the names of the entries that match")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 2 {
+		return usageError("a pattern and at least one file are required (use - for standard input)")
+	}
+
+	expr := fl.Arg(0)
+	if *ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return usageError("invalid pattern: %v", err)
+	}
+	if _, err := path.Match(*glob, ""); err != nil {
+		return usageError("invalid glob: %v", err)
+	}
+
+	g := &grepper{
+		re:        re,
+		glob:      *glob,
+		filesOnly: *filesOnly,
+		w:         bufio.NewWriter(os.Stdout),
+	}
+	defer g.w.Flush()
+
+	for _, name := range fl.Args()[1:] {
+		if err := g.grepFile(ctx, name, fo); err != nil {
+			return err
+		}
+	}
+
+	if !g.matched {
+		return exitError{code: exitFailure}
+	}
+	return nil
+}
+
+// grepper searches the contents of files for lines matching a regular
+// expression. Like grep(1), each matching line is printed with its
+// location, which here includes the name of the entry within the archive.
+type grepper struct {
+	re        *regexp.Regexp
+	glob      string
+	filesOnly bool
+	w         *bufio.Writer
+	matched   bool
+}
+
+// grepFile searches the named file, or standard input if name is "-".
+// Archives are searched entry by entry; compressed files, including
+// compressed entries within archives, are decompressed as they are read;
+// and files of any other format are searched as they are.
+func (g *grepper) grepFile(ctx context.Context, name string, fo formatOptions) error {
+	in, err := openRaw(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	err = in.identify(ctx, fo)
+	if errors.Is(err, archiver.NoMatch) {
+		return g.grepStream(in.name, in.stream)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch format := in.format.(type) {
+	case archiver.Extractor:
+		return g.grepArchive(ctx, in, format)
+	case archiver.Compression:
+		// name the contents after the file, without the compression extension
+		inner := strings.TrimSuffix(filepath.Base(in.name), format.Extension())
+		rc, err := format.OpenReader(in.stream)
+		if err != nil {
+			return fmt.Errorf("%s: %w", in.name, err)
+		}
+		defer rc.Close()
+		return g.grepStream(in.name+":"+inner, rc)
+	}
+	return fmt.Errorf("%s: %s is neither an archive nor a compressed file", in.name, in.format.Extension())
+}
+
+// grepArchive searches the regular files in the input archive.
+func (g *grepper) grepArchive(ctx context.Context, in *input, ex archiver.Extractor) error {
+	return ex.Extract(ctx, in.stream, func(ctx context.Context, f archiver.FileInfo) error {
+		if !f.Mode().IsRegular() || !g.include(f.NameInArchive) {
+			return nil
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%s: opening %s: %w", in.name, f.NameInArchive, err)
+		}
+		defer rc.Close()
+		return g.grepEntry(ctx, in.name+":"+f.NameInArchive, rc)
+	})
+}
+
+// include returns true if the entry with the given path should be searched.
+func (g *grepper) include(name string) bool {
+	if g.glob == "" {
+		return true
+	}
+	name = strings.TrimSuffix(name, "/")
+	matchPath, _ := path.Match(g.glob, name)
+	matchBase, _ := path.Match(g.glob, path.Base(name))
+	return matchPath || matchBase
+}
+
+// grepEntry searches the contents of an archive entry, decompressing
+// them first if they are compressed, as with rotated log files.
+func (g *grepper) grepEntry(ctx context.Context, location string, r io.Reader) error {
+	format, stream, err := archiver.Identify(ctx, "", r)
+	if errors.Is(err, archiver.NoMatch) {
+		return g.grepStream(location, stream)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", location, err)
+	}
+	decomp, ok := format.(archiver.Decompressor)
+	if _, isArchive := format.(archiver.Archive); isArchive || !ok {
+		// archives within archives are not searched, except as they are
+		return g.grepStream(location, stream)
+	}
+	rc, err := decomp.OpenReader(stream)
+	if err != nil {
+		return fmt.Errorf("%s: %w", location, err)
+	}
+	defer rc.Close()
+	return g.grepStream(location, rc)
+}
+
+// grepStream prints the lines read from r that match, each prefixed with
+// location and the line number. If the contents appear to be binary, only
+// whether they match is reported.
+func (g *grepper) grepStream(location string, r io.Reader) error {
+	br := bufio.NewReaderSize(r, 64*1024)
+	head, _ := br.Peek(512)
+	binary := bytes.IndexByte(head, 0) >= 0
+
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return nil
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if g.re.Match(line) {
+			g.matched = true
+			switch {
+			case g.filesOnly:
+				fmt.Fprintln(g.w, location)
+				return nil
+			case binary:
+				fmt.Fprintf(g.w, "%s: binary file matches\n", location)
+				return nil
+			}
+			fmt.Fprintf(g.w, "%s:%d:%s\n", location, lineNum, line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "identify",
+		usage: "[flags] <files...>",
+		short: "Report the format of files and what can be done with them",
+		run:   cmdIdentify,
+	})
+}
+
+func cmdIdentify(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	asJSON := fl.Bool("json", false, "Print one JSON object per file")
+	nameHint := fl.String("name", "", "File name to match by when reading standard input")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 1 {
+		return usageError("at least one file is required (use - for standard input)")
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	var unrecognized int
+	for _, name := range fl.Args() {
+		id, err := identifyFile(ctx, name, *nameHint)
+		if err != nil {
+			return err
+		}
+		if id.Format == "" {
+			unrecognized++
+		}
+		if *asJSON {
+			if err := enc.Encode(id); err != nil {
+				return err
+			}
+			continue
+		}
+		printIdentity(os.Stdout, id)
+	}
+
+	if unrecognized > 0 {
+		return exitError{code: exitFailure, err: fmt.Errorf("%d file(s) not recognized", unrecognized)}
+	}
+	return nil
+}
+
+// identity describes the format of a file.
+type identity struct {
+	File         string   `json:"file"`
+	Format       string   `json:"format"`
+	Compression  *layer   `json:"compression,omitempty"`
+	Archive      *layer   `json:"archive,omitempty"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// layer is one layer of a format, such as the compression
+// of a compressed archive, and how it was matched.
+type layer struct {
+	Format   string `json:"format"`
+	ByName   bool   `json:"by_name"`
+	ByStream bool   `json:"by_stream"`
+}
+
+func printIdentity(w io.Writer, id identity) {
+	if id.Format == "" {
+		fmt.Fprintf(w, "%s: unrecognized\n", id.File)
+		return
+	}
+	fmt.Fprintf(w, "%s: %s\n", id.File, id.Format)
+	for _, l := range []struct {
+		kind string
+		*layer
+	}{
+		{"compression", id.Compression},
+		{"archive", id.Archive},
+	} {
+		if l.layer == nil {
+			continue
+		}
+		var by []string
+		if l.ByName {
+			by = append(by, "name")
+		}
+		if l.ByStream {
+			by = append(by, "stream")
+		}
+		fmt.Fprintf(w, "  %-12s %s (matched by %s)\n", l.kind+":", l.Format, strings.Join(by, " and "))
+	}
+	fmt.Fprintf(w, "  %-12s %s\n", "can:", strings.Join(id.Capabilities, ", "))
+}
+
+// identifyFile identifies the format of the named file, or standard input
+// if name is "-", in which case nameHint is the file name used for matching.
+func identifyFile(ctx context.Context, name, nameHint string) (identity, error) {
+	in, err := openRaw(name)
+	if err != nil {
+		return identity{}, err
+	}
+	if name != "-" {
+		nameHint = filepath.Base(name)
+	}
+	defer in.Close()
+
+	// each layer is matched again individually to learn how it was
+	// matched, so the input must be able to be read more than once
+	ras, err := in.readerAtSeeker()
+	if err != nil {
+		return identity{}, err
+	}
+
+	id := identity{File: in.name}
+	format, _, err := archiver.Identify(ctx, nameHint, ras)
+	if errors.Is(err, archiver.NoMatch) {
+		return id, nil
+	}
+	if err != nil {
+		return identity{}, fmt.Errorf("%s: %w", in.name, err)
+	}
+	id.Format = format.Extension()
+	id.Capabilities = capabilities(format)
+
+	var comp archiver.Compression
+	var inner archiver.Format
+	switch f := format.(type) {
+	case archiver.Archive:
+		comp = f.Compression
+		if f.Archival != nil {
+			inner = f.Archival
+		} else {
+			inner = f.Extraction
+		}
+	case archiver.Compression:
+		comp = f
+	default:
+		inner = f
+	}
+
+	if comp != nil {
+		if _, err := ras.Seek(0, io.SeekStart); err != nil {
+			return identity{}, err
+		}
+		mr, err := comp.Match(ctx, nameHint, ras)
+		if err != nil {
+			return identity{}, fmt.Errorf("%s: matching %s: %w", in.name, comp.Extension(), err)
+		}
+		id.Compression = &layer{Format: comp.Extension(), ByName: mr.ByName, ByStream: mr.ByStream}
+	}
+	if inner != nil {
+		if _, err := ras.Seek(0, io.SeekStart); err != nil {
+			return identity{}, err
+		}
+		var stream io.Reader = ras
+		if comp != nil {
+			rc, err := comp.OpenReader(ras)
+			if err != nil {
+				return identity{}, err
+			}
+			defer rc.Close()
+			stream = rc
+		}
+		mr, err := inner.Match(ctx, nameHint, stream)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return identity{}, fmt.Errorf("%s: matching %s: %w", in.name, inner.Extension(), err)
+		}
+		id.Archive = &layer{Format: inner.Extension(), ByName: mr.ByName, ByStream: mr.ByStream}
+	}
+
+	return id, nil
+}
+
+// capabilities returns the names of the interfaces that format
+// implements. The layers of an Archive are inspected individually,
+// since Archive itself has the methods of every layer.
+func capabilities(format archiver.Format) []string {
+	var archival, extraction, compression archiver.Format
+	switch f := format.(type) {
+	case archiver.Archive:
+		if f.Archival != nil {
+			archival = f.Archival
+		}
+		if f.Extraction != nil {
+			extraction = f.Extraction
+		}
+		if f.Compression != nil {
+			compression = f.Compression
+		}
+	case archiver.Compression:
+		compression = f
+	default:
+		archival, extraction = f, f
+	}
+
+	var caps []string
+	if _, ok := archival.(archiver.Archiver); ok {
+		caps = append(caps, "Archiver")
+	}
+	if _, ok := archival.(archiver.ArchiverAsync); ok {
+		caps = append(caps, "ArchiverAsync")
+	}
+	if _, ok := extraction.(archiver.Extractor); ok {
+		caps = append(caps, "Extractor")
+	}
+	if canInsert(archival, compression) {
+		caps = append(caps, "Inserter")
+	}
+	if _, ok := compression.(archiver.Compressor); ok {
+		caps = append(caps, "Compressor")
+	}
+	if _, ok := compression.(archiver.Decompressor); ok {
+		caps = append(caps, "Decompressor")
+	}
+	return caps
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mholt/archiver/v4"
+)
+
+// input is an opened input file whose format has been identified.
+type input struct {
+	name   string
+	format archiver.Format
+	stream io.Reader
+	file   *os.File // the opened file, or a temporary copy of stdin
+	temp   bool     // whether file is a temporary file to be removed
+}
+
+// openInput opens the named file, or standard input if name is "-",
+// and identifies its format by reading its contents; the file name
+// is not relied upon. If the format requires random access but the
+// input is not seekable, the input is copied to a temporary file.
+func openInput(ctx context.Context, name string, opts formatOptions) (*input, error) {
+	in, err := openRaw(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := in.identify(ctx, opts); err != nil {
+		in.Close()
+		return nil, err
+	}
+	return in, nil
+}
+
+// identify identifies the format of the input by reading its contents
+// and configures it with opts. If the format is not recognized, the
+// error wraps archiver.NoMatch and the stream is left rewound.
+func (in *input) identify(ctx context.Context, opts formatOptions) error {
+	format, stream, err := archiver.Identify(ctx, "", in.stream)
+	if stream != nil {
+		in.stream = stream
+	}
+	if err != nil {
+		return fmt.Errorf("%s: identifying format: %w", in.name, err)
+	}
+	in.format = opts.apply(format)
+
+	if needsRandomAccess(format) {
+		if _, err := in.readerAtSeeker(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openRaw opens the named file, or standard input if name is "-",
+// without identifying its format.
+func openRaw(name string) (*input, error) {
+	if name == "-" {
+		in := &input{name: "stdin", stream: os.Stdin}
+		if _, err := os.Stdin.Seek(0, io.SeekCurrent); err != nil {
+			// hide the Seek method of pipes and terminals, which would fail
+			in.stream = struct{ io.Reader }{os.Stdin}
+		}
+		return in, nil
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &input{name: name, stream: f, file: f}, nil
+}
+
+// readerAtSeeker returns the input stream as a ReaderAtSeeker,
+// copying it to a temporary file first if it is not one.
+func (in *input) readerAtSeeker() (archiver.ReaderAtSeeker, error) {
+	if ras, ok := in.stream.(archiver.ReaderAtSeeker); ok {
+		return ras, nil
+	}
+	tmp, err := os.CreateTemp("", "arc-*")
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(tmp, in.stream)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("buffering %s: %w", in.name, err)
+	}
+
+	// the input is read from the copy from now on
+	if in.file != nil {
+		in.file.Close()
+	}
+	in.file, in.temp, in.stream = tmp, true, tmp
+	return tmp, nil
+}
+
+// archiveFS returns a file system for reading the input archive,
+// which is made seekable if necessary.
+func (in *input) archiveFS(ctx context.Context, ex archiver.Extractor) (*archiver.ArchiveFS, error) {
+	ras, err := in.readerAtSeeker()
+	if err != nil {
+		return nil, err
+	}
+	size, err := ras.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	return &archiver.ArchiveFS{
+		Stream:  io.NewSectionReader(ras, 0, size),
+		Format:  ex,
+		Context: ctx,
+	}, nil
+}
+
+// Close closes the input, removing any temporary file.
+func (in *input) Close() error {
+	if in.file == nil {
+		return nil
+	}
+	err := in.file.Close()
+	if in.temp {
+		os.Remove(in.file.Name())
+	}
+	return err
+}
+
+// extractor returns the input format as an Extractor,
+// or an error if the input is not an archive.
+func (in *input) extractor() (archiver.Extractor, error) {
+	ex, ok := in.format.(archiver.Extractor)
+	if !ok {
+		return nil, fmt.Errorf("%s: %s is not an archive format", in.name, in.format.Extension())
+	}
+	return ex, nil
+}
+
+// needsRandomAccess returns true if the format can only
+// be extracted from an io.ReaderAt and io.Seeker.
+func needsRandomAccess(format archiver.Format) bool {
+	if ar, ok := format.(archiver.Archive); ok {
+		if ar.Compression != nil {
+			return false // decompression is sequential
+		}
+		format = ar.Extraction
+	}
+	switch format.(type) {
+	case archiver.Zip, archiver.SevenZip, archiver.Iso9660:
+		return true
+	}
+	return false
+}
+
+// formatOptions are the options of the archiver package's
+// format types that can be configured with flags.
+type formatOptions struct {
+	password     string
+	textEncoding string
+}
+
+// register defines the flags for the options on fl.
+func (fo *formatOptions) register(fl *flag.FlagSet) {
+	fl.StringVar(&fo.password, "password", "", "Password for encrypted archives (zip, rar, 7z)")
+	fl.StringVar(&fo.textEncoding, "text-encoding", "", "Character encoding of non-UTF-8 file names and comments (zip)")
+}
+
+// apply returns format configured with the options.
+func (fo formatOptions) apply(format archiver.Format) archiver.Format {
+	switch f := format.(type) {
+	case archiver.Archive:
+		if f.Archival != nil {
+			f.Archival = fo.apply(f.Archival).(archiver.Archival)
+		}
+		if f.Extraction != nil {
+			f.Extraction = fo.apply(f.Extraction).(archiver.Extraction)
+		}
+		return f
+	case archiver.Zip:
+		f.TextEncoding = fo.textEncoding
+		f.Password = fo.password
+		return f
+	case archiver.Rar:
+		f.Password = fo.password
+		return f
+	case archiver.SevenZip:
+		f.Password = fo.password
+		return f
+	}
+	return format
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+)
+
+func TestInputReaderAtSeeker(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+
+	name := filepath.Join(t.TempDir(), "input")
+	if err := os.WriteFile(name, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed copy leaves no temporary file behind
+	failing := &input{name: "failing", stream: iotest.ErrReader(errors.New("read failed"))}
+	if _, err := failing.readerAtSeeker(); err == nil {
+		t.Error("expected an error when the input cannot be read")
+	}
+	if entries, _ := os.ReadDir(tmpDir); len(entries) != 0 {
+		t.Errorf("expected the temporary file to be removed, but found %v", entries)
+	}
+
+	// hide the methods of the file, as with a pipe
+	in := &input{name: name, stream: struct{ io.Reader }{f}, file: f}
+	ras, err := in.readerAtSeeker()
+	if err != nil {
+		t.Fatalf("buffering input: %v", err)
+	}
+	data, err := io.ReadAll(ras)
+	if err != nil || string(data) != "contents" {
+		t.Errorf("expected contents of input but got %q, %v", data, err)
+	}
+	if err := f.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected the original file to be closed, but closing it returned %v", err)
+	}
+
+	tmpName := in.file.Name()
+	if err := in.Close(); err != nil {
+		t.Errorf("closing input: %v", err)
+	}
+	if _, err := os.Stat(tmpName); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected the temporary file to be removed, but got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "ls",
+		usage: "[flags] <archive>...",
+		short: "List the contents of archives",
+		run:   cmdLs,
+	})
+}
+
+func cmdLs(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var fo formatOptions
+	fo.register(fl)
+	asJSON := fl.Bool("json", false, "Print one JSON object per entry")
+	asTree := fl.Bool("tree", false, "Print the contents as a directory tree")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 1 {
+		return usageError("at least one archive file is required")
+	}
+	if *asJSON && *asTree {
+		return usageError("-json and -tree are mutually exclusive")
+	}
+
+	for _, name := range fl.Args() {
+		in, err := openInput(ctx, name, fo)
+		if err != nil {
+			return err
+		}
+		if fl.NArg() > 1 && !*asJSON {
+			fmt.Printf("%s:\n", name)
+		}
+		switch {
+		case *asJSON:
+			err = listJSON(ctx, in, os.Stdout)
+		case *asTree:
+			err = listTree(ctx, in, os.Stdout)
+		default:
+			err = listLong(ctx, in, os.Stdout)
+		}
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// listLong prints a line for each entry, similar to `tar -tv`.
+func listLong(ctx context.Context, in *input, w io.Writer) error {
+	ex, err := in.extractor()
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	err = ex.Extract(ctx, in.stream, func(_ context.Context, f archiver.FileInfo) error {
+		name := f.NameInArchive
+		if f.LinkTarget != "" {
+			if isSymlink(f) {
+				name += " -> " + f.LinkTarget
+			} else {
+				name += " link to " + f.LinkTarget
+			}
+		}
+		if f.Encrypted {
+			name += " (encrypted)"
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n",
+			f.Mode(), owner(f.Header), f.Size(), f.ModTime().Format(time.DateTime), name)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// owner returns the owner and group of the entry with header hdr,
+// if the format records them.
+func owner(hdr any) string {
+	switch h := hdr.(type) {
+	case *tar.Header:
+		user, group := h.Uname, h.Gname
+		if user == "" {
+			user = fmt.Sprint(h.Uid)
+		}
+		if group == "" {
+			group = fmt.Sprint(h.Gid)
+		}
+		return user + "/" + group
+	case *archiver.CpioHeader:
+		return fmt.Sprintf("%d/%d", h.Uid, h.Gid)
+	case *archiver.ArHeader:
+		return fmt.Sprintf("%d/%d", h.Uid, h.Gid)
+	case *archiver.Iso9660Header:
+		if h.Mode != 0 { // only with Rock Ridge
+			return fmt.Sprintf("%d/%d", h.Uid, h.Gid)
+		}
+	}
+	return "-"
+}
+
+// listEntry is the JSON representation of an entry in an archive.
+type listEntry struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	Mode       string    `json:"mode"`
+	ModTime    time.Time `json:"mod_time"`
+	IsDir      bool      `json:"is_dir"`
+	LinkTarget string    `json:"link_target,omitempty"`
+	Encrypted  bool      `json:"encrypted,omitempty"`
+	Format     string    `json:"format"`
+	Header     any       `json:"header,omitempty"`
+}
+
+// listJSON prints one JSON object per entry, one per line.
+func listJSON(ctx context.Context, in *input, w io.Writer) error {
+	ex, err := in.extractor()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	return ex.Extract(ctx, in.stream, func(_ context.Context, f archiver.FileInfo) error {
+		return enc.Encode(listEntry{
+			Name:       f.NameInArchive,
+			Size:       f.Size(),
+			Mode:       f.Mode().String(),
+			ModTime:    f.ModTime(),
+			IsDir:      f.IsDir(),
+			LinkTarget: f.LinkTarget,
+			Encrypted:  f.Encrypted,
+			Format:     in.format.Extension(),
+			Header:     f.Header,
+		})
+	})
+}
+
+// listTree prints the contents of the archive as a directory tree.
+func listTree(ctx context.Context, in *input, w io.Writer) error {
+	ex, err := in.extractor()
+	if err != nil {
+		return err
+	}
+	fsys, err := in.archiveFS(ctx, ex)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, ".")
+	return printTree(fsys, ".", "", w)
+}
+
+func printTree(fsys fs.ReadDirFS, dir, indent string, w io.Writer) error {
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for i, entry := range entries {
+		branch, nextIndent := "├── ", "│   "
+		if i == len(entries)-1 {
+			branch, nextIndent = "└── ", "    "
+		}
+		name := entry.Name()
+		if info, err := entry.Info(); err == nil {
+			if f, ok := info.(archiver.FileInfo); ok && f.LinkTarget != "" {
+				name += " -> " + f.LinkTarget
+			}
+		}
+		fmt.Fprintf(w, "%s%s%s\n", indent, branch, name)
+		if entry.IsDir() {
+			if err := printTree(fsys, path.Join(dir, entry.Name()), indent+nextIndent, w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isSymlink(info fs.FileInfo) bool {
+	return info.Mode()&fs.ModeSymlink != 0
+}
@@ -1,7 +1,158 @@
+// Command arc creates, extracts, and inspects archives and compressed
+// files of any format supported by the archiver package.
 package main
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mholt/archiver/v4"
+)
 
 func main() {
-	fmt.Println("TODO: not yet implemented for archiver v4; use v3 for now")
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(exitUsage)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		printUsage()
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "arc: unknown command %q\n\n", name)
+		printUsage()
+		os.Exit(exitUsage)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	err := cmd.run(ctx, cmd.flagSet(), os.Args[2:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		if msg := err.Error(); msg != "" {
+			fmt.Fprintf(os.Stderr, "arc %s: %s\n", name, msg)
+		}
+		cancel()
+		os.Exit(exitCode(err))
+	}
+}
+
+// command is a subcommand of arc.
+type command struct {
+	name  string
+	usage string // synopsis of the arguments
+	short string // one-line description
+
+	// run runs the command. It should define its flags on fl,
+	// then parse args with fl before doing anything else.
+	run func(ctx context.Context, fl *flag.FlagSet, args []string) error
+}
+
+// flagSet returns a new, empty flag set for the command.
+func (c command) flagSet() *flag.FlagSet {
+	fl := flag.NewFlagSet("arc "+c.name, flag.ContinueOnError)
+	fl.Usage = func() {
+		fmt.Fprintf(fl.Output(), "usage: arc %s %s\n\n%s\n", c.name, c.usage, c.short)
+		var hasFlags bool
+		fl.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(fl.Output(), "\nflags:\n")
+			fl.PrintDefaults()
+		}
+	}
+	return fl
+}
+
+// registerCommand registers a command. It should be called during init.
+// Duplicate commands by name are not allowed and will panic.
+func registerCommand(cmd command) {
+	if _, ok := commands[cmd.name]; ok {
+		panic("command " + cmd.name + " is already registered")
+	}
+	commands[cmd.name] = cmd
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "usage: arc <command> [flags] [args...]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].short)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun 'arc <command> -h' for help with a command\n")
 }
+
+// formatByExtension returns the registered format whose extension is the
+// longest suffix of filename, for example ".tar.zst" for "out.tar.zst".
+// Only the extension itself is considered (not any other part of the name)
+// so that names like "notes.brief.zip" are not mistaken for other formats.
+func formatByExtension(ctx context.Context, filename string) (archiver.Format, error) {
+	base := strings.ToLower(filepath.Base(filename))
+	for i := strings.Index(base, "."); i >= 0; {
+		ext := base[i:]
+		format, _, err := archiver.Identify(ctx, ext, nil)
+		if err == nil && format.Extension() == ext {
+			return format, nil
+		}
+		next := strings.Index(base[i+1:], ".")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, fmt.Errorf("%s: unrecognized file extension", filename)
+}
+
+// exitError is an error that causes arc to exit with a specific code.
+// If err is nil, arc exits without printing an error message.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	if e.err == nil {
+		return ""
+	}
+	return e.err.Error()
+}
+func (e exitError) Unwrap() error { return e.err }
+
+// usageError returns an error for invalid usage of the command.
+func usageError(format string, args ...any) error {
+	return exitError{code: exitUsage, err: fmt.Errorf(format, args...)}
+}
+
+// exitCode returns the code arc should exit with for err.
+func exitCode(err error) int {
+	var ee exitError
+	if errors.As(err, &ee) {
+		return ee.code
+	}
+	return exitFailure
+}
+
+// Exit codes.
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// Registered commands.
+var commands = make(map[string]command)
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "insert",
+		usage: "[flags] <archive> <files...>",
+		short: "Add files from disk to an existing archive, replacing any with the same names",
+		run:   cmdInsert,
+	})
+	registerCommand(command{
+		name:  "delete",
+		usage: "[flags] <archive> <paths...>",
+		short: "Remove files from an existing archive",
+		run:   cmdDelete,
+	})
+}
+
+func cmdInsert(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var options archiver.FromDiskOptions
+	var fo formatOptions
+	fo.register(fl)
+	fl.BoolVar(&options.FollowSymlinks, "follow-symlinks", false, "Add the files that symbolic links point to instead of the links")
+	fl.BoolVar(&options.ClearAttributes, "clear-attributes", false, "Do not preserve file attributes other than name, size, type, and permissions")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 2 {
+		return usageError("an archive file and at least one input file are required")
+	}
+	archiveName, inputs := fl.Arg(0), fl.Args()[1:]
+
+	filenames := make(map[string]string, len(inputs))
+	for _, input := range inputs {
+		filenames[input] = ""
+	}
+	files, err := archiver.FilesFromDisk(&options, filenames)
+	if err != nil {
+		return err
+	}
+
+	in, err := openInput(ctx, archiveName, fo)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if in.file == nil {
+		return usageError("the archive must be a file")
+	}
+
+	// files replace any existing entries with the same names; inserting
+	// in place only appends, so it is done if none of them exist yet
+	added := make(map[string]bool, len(files))
+	for _, f := range files {
+		added[path.Clean(f.NameInArchive)] = true
+	}
+	if ar, ok := in.format.(archiver.Archive); ok && canInsert(ar.Archival, ar.Compression) {
+		replaces, err := hasEntry(ctx, in, added)
+		in.Close()
+		if err != nil {
+			return err
+		}
+		if !replaces {
+			f, err := os.OpenFile(archiveName, os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			if err := ar.Insert(ctx, f, files); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}
+
+		// read the archive again, to rewrite it
+		in, err = openInput(ctx, archiveName, fo)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+	}
+
+	// otherwise, rewrite the archive with the new files
+	return rewriteArchive(ctx, in, func(f *archiver.FileInfo) bool {
+		return !added[path.Clean(f.NameInArchive)]
+	}, files)
+}
+
+// hasEntry returns true if the input archive has an entry with any of
+// the names, which are clean paths. The input is read to find out.
+func hasEntry(ctx context.Context, in *input, names map[string]bool) (bool, error) {
+	ex, err := in.extractor()
+	if err != nil {
+		return false, err
+	}
+	var found bool
+	err = ex.Extract(ctx, in.stream, func(_ context.Context, f archiver.FileInfo) error {
+		if names[path.Clean(f.NameInArchive)] {
+			found = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	return found, err
+}
+
+// canInsert returns true if files can be inserted in place into archives
+// with the given archival and compression formats. Compressed archives
+// only allow it if they are tar archives compressed with a format whose
+// streams can be concatenated.
+func canInsert(archival, compression archiver.Format) bool {
+	if compression == nil {
+		if z, ok := archival.(archiver.Zip); ok && z.Password != "" {
+			return false // encrypted files can't be inserted
+		}
+		_, ok := archival.(archiver.Inserter)
+		return ok
+	}
+	if _, ok := archival.(archiver.Tar); !ok {
+		return false
+	}
+	switch compression.(type) {
+	case archiver.Gz, archiver.Zstd, archiver.Xz, archiver.Bz2, archiver.Lz4:
+		return true
+	}
+	return false
+}
+
+func cmdDelete(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var fo formatOptions
+	fo.register(fl)
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 2 {
+		return usageError("an archive file and at least one path to delete are required")
+	}
+	archiveName := fl.Arg(0)
+
+	in, err := openInput(ctx, archiveName, fo)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if in.file == nil {
+		return usageError("the archive must be a file")
+	}
+
+	// delete in place if the format supports it
+	if ar, ok := in.format.(archiver.Archive); ok && ar.Compression == nil {
+		if deleter, ok := ar.Archival.(archiver.Deleter); ok {
+			in.Close()
+			f, err := os.OpenFile(archiveName, os.O_RDWR, 0)
+			if err != nil {
+				return err
+			}
+			names := make([]string, 0, fl.NArg()-1)
+			for _, p := range fl.Args()[1:] {
+				names = append(names, path.Clean(strings.TrimPrefix(p, "/")))
+			}
+			if err := deleter.Delete(ctx, f, names); err != nil {
+				f.Close()
+				if errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("not found in archive: %w", err)
+				}
+				return err
+			}
+			return f.Close()
+		}
+	}
+
+	// otherwise, rewrite the archive without the deleted files;
+	// directories are deleted along with their contents
+	matched := make(map[string]bool)
+	for _, p := range fl.Args()[1:] {
+		matched[path.Clean(strings.TrimPrefix(p, "/"))] = false
+	}
+	deleted := func(name string) bool {
+		name = path.Clean(name)
+		for p := range matched {
+			if name == p || strings.HasPrefix(name, p+"/") {
+				matched[p] = true
+				return true
+			}
+		}
+		return false
+	}
+
+	keep := func(f *archiver.FileInfo) bool { return !deleted(f.NameInArchive) }
+	return rewriteArchive(ctx, in, keep, nil, func() error {
+		var missing []string
+		for p, ok := range matched {
+			if !ok {
+				missing = append(missing, p)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("not found in archive: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	})
+}
+
+// rewriteArchive replaces the input archive file with a new archive of
+// the same format, containing the entries of the input for which filter
+// returns true followed by the extra files. The new archive is written
+// to a temporary file which then atomically replaces the original. If
+// any of the check functions return an error after the new archive is
+// written, the original archive is left as it was.
+func rewriteArchive(ctx context.Context, in *input, filter func(*archiver.FileInfo) bool, extra []archiver.FileInfo, checks ...func() error) error {
+	ex, err := in.extractor()
+	if err != nil {
+		return err
+	}
+	to, ok := in.format.(archiver.ArchiverAsync)
+	if ar, isArchive := in.format.(archiver.Archive); isArchive {
+		_, ok = ar.Archival.(archiver.ArchiverAsync)
+	}
+	if !ok {
+		return fmt.Errorf("%s: %s archives cannot be modified", in.name, in.format.Extension())
+	}
+
+	info, err := in.file.Stat()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(in.name), "."+filepath.Base(in.name)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if tmp != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := transcode(ctx, ex, in.stream, to, tmp, filter, extra); err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	in.Close() // some platforms can't replace open files
+	if err := os.Rename(tmp.Name(), in.name); err != nil {
+		return err
+	}
+	tmp = nil
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func TestInsertReplaces(t *testing.T) {
+	// tar and zip archives are inserted into in place, unless a file
+	// replaces an entry, and tar.br archives are always rewritten
+	for _, name := range []string{"archive.tar", "archive.zip", "archive.tar.br"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFile := func(name, contents string) string {
+				t.Helper()
+				filename := filepath.Join(dir, name)
+				if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return filename
+			}
+			a, b := writeFile("a.txt", "old"), writeFile("b.txt", "b")
+			files, err := archiver.FilesFromDisk(nil, map[string]string{a: "", b: ""})
+			if err != nil {
+				t.Fatalf("gathering files: %v", err)
+			}
+			format, err := formatByExtension(context.Background(), name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			archiveName := filepath.Join(dir, name)
+			f, err := os.Create(archiveName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = format.(archiver.Archiver).Archive(context.Background(), f, files)
+			f.Close()
+			if err != nil {
+				t.Fatalf("creating archive: %v", err)
+			}
+
+			insert := func(filenames ...string) {
+				t.Helper()
+				fl := flag.NewFlagSet("insert", flag.ContinueOnError)
+				if err := cmdInsert(context.Background(), fl, append([]string{archiveName}, filenames...)); err != nil {
+					t.Fatalf("inserting %v: %v", filenames, err)
+				}
+			}
+			insert(writeFile("c.txt", "c"))
+			insert(writeFile("a.txt", "new"), writeFile("d.txt", "d"))
+
+			want := map[string]string{"a.txt": "new", "b.txt": "b", "c.txt": "c", "d.txt": "d"}
+			got := make(map[string]string)
+			var names []string
+			in, err := openInput(context.Background(), archiveName, formatOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+			ex, err := in.extractor()
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ex.Extract(context.Background(), in.stream, func(_ context.Context, f archiver.FileInfo) error {
+				rc, err := f.Open()
+				if err != nil {
+					return err
+				}
+				defer rc.Close()
+				var buf bytes.Buffer
+				if _, err := io.Copy(&buf, rc); err != nil {
+					return err
+				}
+				names = append(names, f.NameInArchive)
+				got[f.NameInArchive] = buf.String()
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("reading archive: %v", err)
+			}
+			if len(names) != len(want) {
+				slices.Sort(names)
+				t.Errorf("expected each file once, but got %v", names)
+			}
+			for file, contents := range want {
+				if got[file] != contents {
+					t.Errorf("expected %s to contain %q but got %q", file, contents, got[file])
+				}
+			}
+		})
+	}
+}
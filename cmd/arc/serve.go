@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mholt/archiver/v4"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "serve",
+		usage: "[flags] <archive>",
+		short: "Browse and download the contents of an archive over HTTP",
+		run:   cmdServe,
+	})
+}
+
+func cmdServe(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	addr := fl.String("addr", "localhost:8080", "Address to listen on")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() != 1 {
+		return usageError("an archive file is required")
+	}
+	name := fl.Arg(0)
+
+	fsys, err := archiver.FileSystem(ctx, name, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	// index the archive up front, which makes browsing it faster
+	// and makes it safe for concurrent use by the server
+	if rdfs, ok := fsys.(fs.ReadDirFS); ok {
+		if _, err := rdfs.ReadDir("."); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:           archiver.FileServer{FS: fsys},
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	fmt.Fprintf(os.Stderr, "Serving %s on http://%s/\n", name, ln.Addr())
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/klauspost/compress/zip"
+	"github.com/mholt/archiver/v4"
+	"github.com/nwaples/rardecode/v2"
+	"github.com/therootcompany/xz"
+)
+
+func init() {
+	registerCommand(command{
+		name:  "test",
+		usage: "[flags] <archive>...",
+		short: "Verify the integrity of archives and compressed files",
+		run:   cmdTest,
+	})
+}
+
+// Exit codes of the test command, for problems it finds with the input.
+const (
+	exitCorrupt       = 3
+	exitTruncated     = 4
+	exitWrongPassword = 5
+	exitUnsupported   = 6
+)
+
+func cmdTest(ctx context.Context, fl *flag.FlagSet, args []string) error {
+	var fo formatOptions
+	fo.register(fl)
+	verbose := fl.Bool("v", false, "Print every entry that is tested, not only those with problems")
+	if err := fl.Parse(args); err != nil {
+		return err
+	}
+	if fl.NArg() < 1 {
+		return usageError("at least one archive file is required")
+	}
+
+	// the exit code reflects the first problem that is found,
+	// but testing continues so that every problem is reported
+	var firstProblem error
+	for _, name := range fl.Args() {
+		t := &tester{verbose: *verbose, w: os.Stdout}
+		if err := t.test(ctx, name, fo); err != nil {
+			return err
+		}
+		if firstProblem == nil {
+			firstProblem = t.firstProblem
+		}
+		fmt.Printf("%s: %d tested, %d problem(s)\n", name, t.tested, t.problems)
+	}
+
+	if firstProblem != nil {
+		return exitError{code: problemCode(firstProblem), err: errors.New("problems were found")}
+	}
+	return nil
+}
+
+// tester verifies the integrity of an input by reading all of it.
+type tester struct {
+	verbose bool
+	w       io.Writer
+
+	tested, problems int
+	firstProblem     error
+}
+
+// test reads every entry of the named archive, or all of the named
+// compressed file, so that any checksums are verified. Problems with
+// the input are reported; only errors unrelated to the contents of the
+// input, such as failing to open it, are returned.
+func (t *tester) test(ctx context.Context, name string, fo formatOptions) error {
+	in, err := openInput(ctx, name, fo)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	ex, ok := in.format.(archiver.Extractor)
+	if !ok {
+		decomp, ok := in.format.(archiver.Decompressor)
+		if !ok {
+			return fmt.Errorf("%s: %s files cannot be tested", in.name, in.format.Extension())
+		}
+		t.tested++
+		t.report(in.name, decompressTo(decomp, in.stream, io.Discard))
+		return nil
+	}
+
+	// decompress here instead of in Extract, so that the rest of the
+	// decompressed stream can be read after the end of the archive;
+	// most compression formats have a checksum at the end of the
+	// stream, which is only verified once it is reached
+	stream := in.stream
+	var decompressed io.ReadCloser
+	if ar, ok := ex.(archiver.Archive); ok && ar.Compression != nil {
+		decompressed, err = ar.Compression.OpenReader(stream)
+		if err != nil {
+			t.report(in.name, err)
+			return nil
+		}
+		defer decompressed.Close()
+		stream, ex = decompressed, ar.Extraction
+	}
+
+	var entryErr error
+	err = ex.Extract(ctx, stream, func(ctx context.Context, f archiver.FileInfo) error {
+		if !f.Mode().IsRegular() {
+			return nil
+		}
+		t.tested++
+		err := testEntry(f)
+		if err != nil {
+			entryErr = err
+		}
+		t.report(f.NameInArchive, err)
+		return nil
+	})
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == nil && decompressed != nil {
+		_, err = io.Copy(io.Discard, decompressed)
+	}
+	// the archive could not be read to the end; if that is because of
+	// a problem already reported for an entry (for example, if the
+	// archive is truncated), it is not reported again
+	if err != nil && (entryErr == nil || !errors.Is(err, entryErr)) {
+		t.report(in.name, err)
+	}
+	return nil
+}
+
+// testEntry reads the entire contents of the file.
+func testEntry(f archiver.FileInfo) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	return err
+}
+
+func (t *tester) report(name string, err error) {
+	if err == nil {
+		if t.verbose {
+			fmt.Fprintf(t.w, "OK           %s\n", name)
+		}
+		return
+	}
+	t.problems++
+	if t.firstProblem == nil {
+		t.firstProblem = err
+	}
+	fmt.Fprintf(t.w, "%-12s %s: %v\n", problemKind(err), name, err)
+}
+
+// problemCode returns the exit code for a problem found while testing.
+func problemCode(err error) int {
+	switch {
+	case isWrongPassword(err):
+		return exitWrongPassword
+	case isUnsupported(err):
+		return exitUnsupported
+	case isTruncated(err):
+		return exitTruncated
+	default:
+		return exitCorrupt
+	}
+}
+
+// problemKind returns a short description of the kind of problem err is.
+func problemKind(err error) string {
+	switch problemCode(err) {
+	case exitWrongPassword:
+		return "PASSWORD"
+	case exitUnsupported:
+		return "UNSUPPORTED"
+	case exitTruncated:
+		return "TRUNCATED"
+	default:
+		return "CORRUPT"
+	}
+}
+
+func isWrongPassword(err error) bool {
+	var sevenZipErr *sevenzip.ReadError
+	if errors.As(err, &sevenZipErr) && sevenZipErr.Encrypted {
+		return true
+	}
+	return errors.Is(err, rardecode.ErrBadPassword) ||
+		errors.Is(err, archiver.ErrPassword)
+}
+
+func isUnsupported(err error) bool {
+	return errors.Is(err, zip.ErrAlgorithm) ||
+		errors.Is(err, rardecode.ErrUnknownDecoder) ||
+		errors.Is(err, rardecode.ErrUnsupportedDecoder) ||
+		errors.Is(err, rardecode.ErrUnknownEncryptMethod) ||
+		errors.Is(err, rardecode.ErrUnknownVersion) ||
+		errors.Is(err, rardecode.ErrMultipleDecoders) ||
+		errors.Is(err, xz.ErrUnsupportedCheck) ||
+		errors.Is(err, xz.ErrOptions) ||
+		// the sevenzip package does not export this error, so its
+		// message is checked; TestTesterUnsupportedMethod pins it
+		strings.Contains(err.Error(), "sevenzip: unsupported compression algorithm")
+}
+
+func isTruncated(err error) bool {
+	return errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, rardecode.ErrUnexpectedArcEnd) ||
+		errors.Is(err, rardecode.ErrDecoderOutOfData) ||
+		errors.Is(err, rardecode.ErrShortFile) ||
+		errors.Is(err, xz.ErrBuf)
+}
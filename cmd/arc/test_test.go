@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zip"
+	"github.com/mholt/archiver/v4"
+)
+
+func TestTesterCompressedArchive(t *testing.T) {
+	dir := t.TempDir()
+	// incompressible contents, so that truncating the archive truncates the file
+	contents := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(contents)
+	files := sourceFiles(t, dir, contents)
+	var buf bytes.Buffer
+	format := archiver.Archive{Compression: archiver.Gz{}, Archival: archiver.Tar{}}
+	if err := format.Archive(context.Background(), &buf, files); err != nil {
+		t.Fatalf("creating archive: %v", err)
+	}
+	archive := buf.Bytes()
+
+	// the gzip trailer is the CRC-32 and size of the decompressed data,
+	// which come after the end of the tar archive
+	badCRC := bytes.Clone(archive)
+	for i := len(badCRC) - 8; i < len(badCRC); i++ {
+		badCRC[i] ^= 0xff
+	}
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		problems int
+		want     string
+	}{
+		{name: "ok", data: archive},
+		{name: "bad-crc", data: badCRC, problems: 1, want: "CORRUPT      bad-crc.tar.gz: gzip: invalid checksum"},
+		{name: "truncated", data: archive[:len(archive)/2], problems: 1, want: "TRUNCATED    src/a.txt: unexpected EOF"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testArchive(t, dir, tc.name+".tar.gz", tc.data, formatOptions{}, tc.problems, tc.want)
+		})
+	}
+}
+
+func TestTesterEncryptedZip(t *testing.T) {
+	dir := t.TempDir()
+	files := sourceFiles(t, dir, bytes.Repeat([]byte("compressible "), 10000))
+	var buf bytes.Buffer
+	format := archiver.Zip{Compression: zip.Deflate, Password: "pw"}
+	if err := format.Archive(context.Background(), &buf, files); err != nil {
+		t.Fatalf("creating archive: %v", err)
+	}
+	archive := buf.Bytes()
+
+	// the file is encrypted with AE-2, which has no CRC, so tampering
+	// with it is only detected by its authentication code, which comes
+	// after the deflated data that the decompressor doesn't read to the end
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("reading archive: %v", err)
+	}
+	zf := zr.File[len(zr.File)-1]
+	dataOffset, err := zf.DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamperedMAC := bytes.Clone(archive)
+	tamperedMAC[dataOffset+int64(zf.CompressedSize64)-1] ^= 0xff
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		password string
+		problems int
+		want     string
+	}{
+		{name: "ok", data: archive, password: "pw"},
+		{name: "tampered", data: tamperedMAC, password: "pw", problems: 1, want: "CORRUPT      src/a.txt: authentication failed: zip: checksum error"},
+		{name: "wrong-password", data: archive, password: "wrong", problems: 1, want: "PASSWORD     src/a.txt: wrong or missing password"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testArchive(t, dir, tc.name+".zip", tc.data, formatOptions{password: tc.password}, tc.problems, tc.want)
+		})
+	}
+}
+
+func TestTesterUnsupportedMethod(t *testing.T) {
+	dir := t.TempDir()
+	files := sourceFiles(t, dir, []byte("stored"))
+	name := filepath.Join(dir, "unsupported.7z")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	format := archiver.SevenZip{Compression: archiver.SevenZipCopy}
+	if err := format.Archive(context.Background(), f, files); err != nil {
+		t.Fatalf("creating archive: %v", err)
+	}
+	archive, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// replace the ID of the copy method of the only coder, in the folder
+	// information of the header, with one that isn't defined, then update
+	// the CRCs of the header and of the signature header that points to it
+	const signatureHeaderLen = 32
+	headerOffset := signatureHeaderLen + int(binary.LittleEndian.Uint64(archive[12:]))
+	header := archive[headerOffset:]
+	coder := []byte{0x0b, 1, 0, 1, 0x01, 0x00} // folder ID, 1 folder, not external, 1 coder, ID size 1, copy
+	i := bytes.Index(header, coder)
+	if i < 0 {
+		t.Fatalf("coder not found in header %x", header)
+	}
+	header[i+len(coder)-1] = 0x7f
+	binary.LittleEndian.PutUint32(archive[28:], crc32.ChecksumIEEE(header))
+	binary.LittleEndian.PutUint32(archive[8:], crc32.ChecksumIEEE(archive[12:signatureHeaderLen]))
+
+	// the sevenzip package doesn't export its error for this,
+	// so this checks that its message is still recognized
+	testArchive(t, dir, "unsupported.7z", archive, formatOptions{}, 1,
+		"UNSUPPORTED  src/a.txt: sevenzip: read error: sevenzip: unsupported compression algorithm")
+}
+
+// sourceFiles writes src/a.txt with contents in dir,
+// and returns the files to add to an archive.
+func sourceFiles(t *testing.T, dir string, contents []byte) []archiver.FileInfo {
+	t.Helper()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := archiver.FilesFromDisk(nil, map[string]string{src: ""})
+	if err != nil {
+		t.Fatalf("gathering files: %v", err)
+	}
+	return files
+}
+
+// testArchive writes data to the named file in dir and tests it, checking
+// the number of problems and the output, without the directory in it.
+func testArchive(t *testing.T, dir, name string, data []byte, fo formatOptions, problems int, want string) {
+	t.Helper()
+	name = filepath.Join(dir, name)
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	tester := &tester{w: &out}
+	if err := tester.test(context.Background(), name, fo); err != nil {
+		t.Fatalf("testing archive: %v", err)
+	}
+	if tester.problems != problems {
+		t.Errorf("expected %d problem(s) but got %d: %s", problems, tester.problems, out.String())
+	}
+	if got := strings.TrimSpace(strings.ReplaceAll(out.String(), dir+string(filepath.Separator), "")); got != want {
+		t.Errorf("expected output %q but got %q", want, got)
+	}
+}
@@ -0,0 +1,744 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterFormat(Cpio{})
+}
+
+// Cpio can read and write cpio archives, as used for Linux initramfs
+// images and RPM payloads. Archives in the "new" ASCII (newc), CRC,
+// and portable ASCII (odc) formats can be read; which of them is
+// written is set by Format.
+type Cpio struct {
+	// The format of the archives to create. The default is CpioNewc,
+	// which is what the Linux kernel expects for initramfs images.
+	Format CpioFormat
+
+	// If true, errors encountered during reading or writing
+	// a file within an archive will be logged and the
+	// operation will continue on remaining files.
+	ContinueOnError bool
+}
+
+// CpioFormat is a format of cpio archive headers.
+type CpioFormat int
+
+const (
+	// The SVR4 "new" ASCII format, with hexadecimal header fields
+	// ("070701").
+	CpioNewc CpioFormat = iota
+
+	// The newc format with a checksum of the contents of each
+	// file in its header ("070702").
+	CpioCRC
+
+	// The POSIX.1 portable format, with octal header fields
+	// ("070707"). It has smaller limits than newc: files must
+	// be smaller than 8 GiB, and user and group IDs below 262144.
+	CpioODC
+)
+
+func (Cpio) Extension() string { return ".cpio" }
+
+func (c Cpio) Match(_ context.Context, filename string, stream io.Reader) (MatchResult, error) {
+	var mr MatchResult
+
+	// match filename
+	if strings.Contains(strings.ToLower(filename), c.Extension()) {
+		mr.ByName = true
+	}
+
+	// match file header
+	buf, err := readAtMost(stream, cpioMagicLen)
+	if err != nil {
+		return mr, err
+	}
+	switch string(buf) {
+	case cpioMagicNewc, cpioMagicCRC, cpioMagicODC:
+		mr.ByStream = true
+	}
+
+	return mr, nil
+}
+
+func (c Cpio) Archive(ctx context.Context, output io.Writer, files []FileInfo) error {
+	cw, err := c.newWriter(output)
+	if err != nil {
+		return err
+	}
+
+	// the link count of a file is in its header, which is written
+	// before its hard links, so count them in advance
+	for _, file := range files {
+		if file.LinkTarget != "" && file.Mode().Type() == 0 {
+			cw.nlinks[path.Clean(file.LinkTarget)]++
+		}
+	}
+
+	for i, file := range files {
+		if err := cw.writeFile(ctx, i, file); err != nil {
+			// files can only be skipped if none of them was written
+			if c.ContinueOnError && ctx.Err() == nil && cw.err == nil {
+				log.Printf("[ERROR] %v", err)
+				continue
+			}
+			return err
+		}
+	}
+
+	return cw.close()
+}
+
+// ArchiveAsync is like Archive, but writes the files received from jobs
+// until the channel is closed. Since the files are not known in advance,
+// the targets of hard links are written with a link count of 1 unless
+// their Header is a CpioHeader with a higher count.
+func (c Cpio) ArchiveAsync(ctx context.Context, output io.Writer, jobs <-chan ArchiveAsyncJob) error {
+	cw, err := c.newWriter(output)
+	if err != nil {
+		return err
+	}
+
+	var i int
+	for job := range jobs {
+		job.Result <- cw.writeFile(ctx, i, job.File)
+		i++
+	}
+
+	return cw.close()
+}
+
+func (c Cpio) newWriter(output io.Writer) (*cpioWriter, error) {
+	switch c.Format {
+	case CpioNewc, CpioCRC, CpioODC:
+	default:
+		return nil, fmt.Errorf("unsupported cpio format: %d", c.Format)
+	}
+	return &cpioWriter{
+		w:      output,
+		format: c.Format,
+		nlinks: make(map[string]int),
+		files:  make(map[string]*CpioHeader),
+	}, nil
+}
+
+// Extract extracts files from the cpio archive. Hard links are files with
+// LinkTarget set to the name of the file they link to, which is always
+// handled before them. Since archives made by GNU cpio store the contents
+// of hard-linked files with the last of their links, the others are held
+// back until that one is read.
+func (c Cpio) Extract(ctx context.Context, sourceArchive io.Reader, handleFile FileHandler) error {
+	cr := &cpioReader{r: sourceArchive}
+
+	// important to initialize to non-nil, empty value due to how fileIsIncluded works
+	skipDirs := skipList{}
+
+	handle := func(hdr *CpioHeader) error {
+		if fileIsIncluded(skipDirs, hdr.Name) {
+			return nil
+		}
+
+		info := cpioFileInfo{hdr}
+		file := FileInfo{
+			FileInfo:      info,
+			Header:        hdr,
+			NameInArchive: hdr.Name,
+			LinkTarget:    hdr.Linkname,
+			Open: func() (fs.File, error) {
+				if hdr != cr.hdr {
+					// a hard link handled after its target has no contents of its own
+					return fileInArchive{io.NopCloser(strings.NewReader("")), info}, nil
+				}
+				return fileInArchive{io.NopCloser(cr), info}, nil
+			},
+		}
+
+		err := handleFile(ctx, file)
+		if errors.Is(err, fs.SkipAll) {
+			return err
+		} else if errors.Is(err, fs.SkipDir) {
+			// if a directory, skip this path; if a file, skip the folder path
+			dirPath := hdr.Name
+			if !info.IsDir() {
+				dirPath = path.Dir(hdr.Name) + "/"
+			}
+			skipDirs.add(dirPath)
+		} else if err != nil {
+			return fmt.Errorf("handling file: %s: %w", hdr.Name, err)
+		}
+		return nil
+	}
+
+	// hard links share an inode number; the ones without contents
+	// link to the file that has them, which may come before or
+	// after them (only headers are kept while waiting for it)
+	files := make(map[cpioInode]string)
+	waiting := make(map[cpioInode][]*CpioHeader)
+	var waitingOrder []cpioInode
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err // honor context cancellation
+		}
+
+		hdr, err := cr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// the next header can't be found without this one,
+			// so there's no continuing on from here
+			return err
+		}
+
+		if hdr.Mode&unixModeType != unixModeRegular {
+			err = handle(hdr)
+		} else {
+			inode := cpioInode{hdr.Devmajor, hdr.Devminor, hdr.Inode}
+			target, seen := files[inode]
+			switch {
+			case hdr.Size > 0 || hdr.Nlink < 2:
+				if !seen {
+					files[inode] = hdr.Name
+				}
+				err = handle(hdr)
+				for _, link := range waiting[inode] {
+					if err != nil {
+						break
+					}
+					link.Linkname = hdr.Name
+					err = handle(link)
+				}
+				delete(waiting, inode)
+			case seen:
+				hdr.Linkname = target
+				err = handle(hdr)
+			default:
+				if _, ok := waiting[inode]; !ok {
+					waitingOrder = append(waitingOrder, inode)
+				}
+				waiting[inode] = append(waiting[inode], hdr)
+			}
+		}
+		if errors.Is(err, fs.SkipAll) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// links to empty files never get a file with contents,
+	// so the first of them becomes the file
+	for _, inode := range waitingOrder {
+		links := waiting[inode]
+		for i, link := range links {
+			if i > 0 {
+				link.Linkname = links[0].Name
+			}
+			err := handle(link)
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CpioHeader is the header of a file in a cpio archive. It is the Header
+// of files extracted from cpio archives; when writing such files to a cpio
+// archive, their owner, link count, and device numbers are kept.
+type CpioHeader struct {
+	Format   CpioFormat
+	Name     string
+	Inode    int64
+	Mode     uint32 // Unix file mode, including the file type
+	Uid      int
+	Gid      int
+	Nlink    int
+	ModTime  time.Time
+	Size     int64
+	Checksum uint32 // sum of the bytes of the contents of regular files; CpioCRC only
+
+	// The device that contains the file.
+	Devmajor int64
+	Devminor int64
+
+	// For device files, the device itself.
+	Rdevmajor int64
+	Rdevminor int64
+
+	// The target of a symbolic link, or for hard links, the name of
+	// the file they link to. The target of a symbolic link is the
+	// contents of its entry; hard links are found by inode number.
+	Linkname string
+}
+
+// cpioInode identifies the file of an entry, which
+// hard links have in common.
+type cpioInode struct {
+	devmajor, devminor, inode int64
+}
+
+// cpioFileInfo satisfies the fs.FileInfo interface for cpio entries.
+type cpioFileInfo struct {
+	hdr *CpioHeader
+}
+
+func (cfi cpioFileInfo) Name() string       { return path.Base(cfi.hdr.Name) }
+func (cfi cpioFileInfo) Size() int64        { return cfi.hdr.Size }
+func (cfi cpioFileInfo) Mode() fs.FileMode  { return fileModeFromUnix(cfi.hdr.Mode) }
+func (cfi cpioFileInfo) ModTime() time.Time { return cfi.hdr.ModTime }
+func (cfi cpioFileInfo) IsDir() bool        { return cfi.hdr.Mode&unixModeType == unixModeDir }
+func (cfi cpioFileInfo) Sys() any           { return cfi.hdr }
+
+// cpioReader reads the headers of a cpio archive, and
+// the contents of the current file.
+type cpioReader struct {
+	r         io.Reader
+	hdr       *CpioHeader // the current file
+	remaining int64       // unread contents of the current file
+	padding   int64       // after the contents of the current file
+	sum       cpioSum     // of the contents read so far, in the CRC format
+}
+
+// next advances to the next file in the archive, skipping the rest of
+// the current one, and returns its header. At the end of the archive,
+// which is the trailer entry (or the end of the stream), it returns io.EOF.
+func (cr *cpioReader) next() (*CpioHeader, error) {
+	if _, err := io.CopyN(io.Discard, cr.r, cr.remaining+cr.padding); err != nil {
+		return nil, noEOF(err)
+	}
+	cr.hdr, cr.remaining, cr.padding, cr.sum = nil, 0, 0, 0
+
+	magic := make([]byte, cpioMagicLen)
+	if _, err := io.ReadFull(cr.r, magic); err != nil {
+		return nil, err
+	}
+	hdr := new(CpioHeader)
+	headerLen, base := cpioNewcHeaderLen, 16
+	switch string(magic) {
+	case cpioMagicNewc:
+		hdr.Format = CpioNewc
+	case cpioMagicCRC:
+		hdr.Format = CpioCRC
+	case cpioMagicODC:
+		hdr.Format = CpioODC
+		headerLen, base = cpioODCHeaderLen, 8
+	default:
+		return nil, fmt.Errorf("invalid cpio header: magic number %q", magic)
+	}
+	buf := make([]byte, headerLen-cpioMagicLen)
+	if _, err := io.ReadFull(cr.r, buf); err != nil {
+		return nil, noEOF(err)
+	}
+
+	f := &cpioFields{buf: buf, base: base}
+	var nameSize int64
+	if hdr.Format == CpioODC {
+		dev := f.get(6)
+		hdr.Inode = f.get(6)
+		hdr.Mode = uint32(f.get(6))
+		hdr.Uid = int(f.get(6))
+		hdr.Gid = int(f.get(6))
+		hdr.Nlink = int(f.get(6))
+		rdev := f.get(6)
+		hdr.ModTime = time.Unix(f.get(11), 0)
+		nameSize = f.get(6)
+		hdr.Size = f.get(11)
+		hdr.Devmajor, hdr.Devminor = dev>>8, dev&0xff
+		hdr.Rdevmajor, hdr.Rdevminor = rdev>>8, rdev&0xff
+	} else {
+		hdr.Inode = f.get(8)
+		hdr.Mode = uint32(f.get(8))
+		hdr.Uid = int(f.get(8))
+		hdr.Gid = int(f.get(8))
+		hdr.Nlink = int(f.get(8))
+		hdr.ModTime = time.Unix(f.get(8), 0)
+		hdr.Size = f.get(8)
+		hdr.Devmajor = f.get(8)
+		hdr.Devminor = f.get(8)
+		hdr.Rdevmajor = f.get(8)
+		hdr.Rdevminor = f.get(8)
+		nameSize = f.get(8)
+		hdr.Checksum = uint32(f.get(8))
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	// the name ends with a null byte, which is counted in its size
+	if nameSize < 1 || nameSize > cpioMaxNameSize {
+		return nil, fmt.Errorf("invalid cpio header: name size %d", nameSize)
+	}
+	name := make([]byte, nameSize+hdr.Format.padding(int64(headerLen)+nameSize))
+	if _, err := io.ReadFull(cr.r, name); err != nil {
+		return nil, noEOF(err)
+	}
+	name, _, _ = bytes.Cut(name, []byte{0})
+	hdr.Name = string(name)
+	if hdr.Name == cpioTrailer {
+		return nil, io.EOF
+	}
+
+	cr.hdr, cr.remaining, cr.padding = hdr, hdr.Size, hdr.Format.padding(hdr.Size)
+
+	// the target of a symbolic link is its contents
+	if hdr.Mode&unixModeType == unixModeSymlink {
+		target, err := linkTargetFromBody(cr)
+		if err != nil {
+			return nil, fmt.Errorf("reading link target: %s: %w", hdr.Name, err)
+		}
+		hdr.Linkname = target
+	}
+
+	return hdr, nil
+}
+
+// Read reads the contents of the current file.
+func (cr *cpioReader) Read(p []byte) (int, error) {
+	if cr.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > cr.remaining {
+		p = p[:cr.remaining]
+	}
+	n, err := cr.r.Read(p)
+	cr.remaining -= int64(n)
+	if cr.hdr.Format == CpioCRC && cr.hdr.Mode&unixModeType == unixModeRegular {
+		cr.sum.Write(p[:n])
+		if cr.remaining == 0 && uint32(cr.sum) != cr.hdr.Checksum {
+			return n, errors.New("checksum mismatch")
+		}
+	}
+	if cr.remaining > 0 {
+		err = noEOF(err)
+	}
+	return n, err
+}
+
+// noEOF returns io.ErrUnexpectedEOF instead of io.EOF,
+// for when the archive ends in the middle of an entry.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// cpioWriter writes files to a cpio archive.
+type cpioWriter struct {
+	w      io.Writer
+	format CpioFormat
+	inode  int64                  // the last inode number assigned
+	nlinks map[string]int         // number of hard links to each file, if known in advance
+	files  map[string]*CpioHeader // regular files written, for hard links to them
+
+	// the archive can't go on after an error
+	// while writing the contents of a file
+	err error
+}
+
+func (cw *cpioWriter) writeFile(ctx context.Context, idx int, file FileInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+	if cw.err != nil {
+		return cw.err
+	}
+
+	name := file.NameInArchive
+	if name == "" {
+		name = file.Name()
+	}
+	hdr := &CpioHeader{
+		Name:    strings.TrimSuffix(name, "/"),
+		Mode:    unixMode(file.Mode()),
+		ModTime: file.ModTime(),
+		Nlink:   1,
+	}
+	var ch *CpioHeader
+	switch h := file.Header.(type) {
+	case CpioHeader:
+		ch = &h
+	case *CpioHeader:
+		ch = h
+	}
+	if ch != nil {
+		hdr.Uid, hdr.Gid, hdr.Nlink = ch.Uid, ch.Gid, max(ch.Nlink, 1)
+		hdr.Rdevmajor, hdr.Rdevminor = ch.Rdevmajor, ch.Rdevminor
+	} else {
+		// tar's header has the owner and device numbers from
+		// the file info of the platform, if it has them
+		if th, err := tar.FileInfoHeader(file, ""); err == nil {
+			hdr.Uid, hdr.Gid = th.Uid, th.Gid
+			hdr.Rdevmajor, hdr.Rdevminor = th.Devmajor, th.Devminor
+		}
+	}
+
+	var body io.Reader
+	switch {
+	case file.IsDir():
+		hdr.Nlink = max(hdr.Nlink, 2)
+
+	case isSymlink(file):
+		if file.LinkTarget == "" {
+			return fmt.Errorf("writing file %d: %s: symbolic link has no target", idx, file.Name())
+		}
+		body = strings.NewReader(file.LinkTarget)
+		hdr.Size = int64(len(file.LinkTarget))
+
+	case file.LinkTarget != "" && file.Mode().Type() == 0:
+		target, ok := cw.files[path.Clean(file.LinkTarget)]
+		if !ok {
+			return fmt.Errorf("writing file %d: %s: hard link target %s is not in the archive", idx, file.Name(), file.LinkTarget)
+		}
+		hdr.Inode, hdr.Nlink = target.Inode, max(target.Nlink, 2)
+
+	case file.Mode().IsRegular():
+		f, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("opening file %d: %s: %w", idx, file.Name(), err)
+		}
+		defer f.Close()
+		body, hdr.Size = f, file.Size()
+		if n := cw.nlinks[path.Clean(hdr.Name)]; n > 0 {
+			hdr.Nlink = n + 1
+		}
+		if cw.format == CpioCRC {
+			rc, checksum, err := cpioChecksum(f, hdr.Size)
+			if err != nil {
+				return fmt.Errorf("reading file %d: %s: %w", idx, file.Name(), err)
+			}
+			defer rc.Close()
+			body, hdr.Checksum = rc, checksum
+		}
+	}
+	if hdr.Inode == 0 {
+		cw.inode++
+		hdr.Inode = cw.inode
+	}
+	if hdr.Mode&unixModeType == unixModeRegular {
+		cw.files[path.Clean(hdr.Name)] = hdr
+	}
+
+	if err := cw.writeHeader(hdr); err != nil {
+		return fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), err)
+	}
+	if body != nil {
+		if _, err := io.CopyN(cw.w, body, hdr.Size); err != nil {
+			cw.err = fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), noEOF(err))
+			return cw.err
+		}
+		if err := cw.pad(hdr.Size); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeHeader writes hdr, and the name that follows it.
+func (cw *cpioWriter) writeHeader(hdr *CpioHeader) error {
+	nameSize := int64(len(hdr.Name)) + 1
+	modTime := max(hdr.ModTime.Unix(), 0)
+
+	var f *cpioFields
+	if cw.format == CpioODC {
+		if hdr.Rdevminor > 0xff {
+			return fmt.Errorf("device minor number %d is too large for the odc format", hdr.Rdevminor)
+		}
+		f = &cpioFields{buf: []byte(cpioMagicODC), base: 8}
+		f.put(0, 6)                 // device
+		f.put(hdr.Inode&0777777, 6) // inode numbers wrap around in large archives
+		f.put(int64(hdr.Mode), 6)
+		f.put(int64(hdr.Uid), 6)
+		f.put(int64(hdr.Gid), 6)
+		f.put(int64(hdr.Nlink), 6)
+		f.put(hdr.Rdevmajor<<8|hdr.Rdevminor, 6)
+		f.put(modTime, 11)
+		f.put(nameSize, 6)
+		f.put(hdr.Size, 11)
+	} else {
+		magic := cpioMagicNewc
+		if cw.format == CpioCRC {
+			magic = cpioMagicCRC
+		}
+		f = &cpioFields{buf: []byte(magic), base: 16}
+		f.put(hdr.Inode, 8)
+		f.put(int64(hdr.Mode), 8)
+		f.put(int64(hdr.Uid), 8)
+		f.put(int64(hdr.Gid), 8)
+		f.put(int64(hdr.Nlink), 8)
+		f.put(modTime, 8)
+		f.put(hdr.Size, 8)
+		f.put(0, 8) // device major
+		f.put(0, 8) // device minor
+		f.put(hdr.Rdevmajor, 8)
+		f.put(hdr.Rdevminor, 8)
+		f.put(nameSize, 8)
+		f.put(int64(hdr.Checksum), 8)
+	}
+	if f.err != nil {
+		return f.err
+	}
+
+	f.buf = append(f.buf, hdr.Name...)
+	f.buf = append(f.buf, 0)
+	f.buf = append(f.buf, make([]byte, cw.format.padding(int64(len(f.buf))))...)
+	if _, err := cw.w.Write(f.buf); err != nil {
+		cw.err = err
+		return err
+	}
+	return nil
+}
+
+// pad writes the padding after n bytes of contents.
+func (cw *cpioWriter) pad(n int64) error {
+	if _, err := cw.w.Write(make([]byte, cw.format.padding(n))); err != nil {
+		cw.err = err
+		return err
+	}
+	return nil
+}
+
+// close ends the archive with the trailer entry.
+func (cw *cpioWriter) close() error {
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.writeHeader(&CpioHeader{Name: cpioTrailer, Nlink: 1})
+}
+
+// cpioChecksum returns the checksum of the size bytes of contents of f as
+// used by the CRC format, which is needed before writing them. It returns a
+// reader of the contents, which is f if it can seek back to the start, or a
+// temporary file with a copy of them; either way, it must be closed.
+func cpioChecksum(f fs.File, size int64) (io.ReadCloser, uint32, error) {
+	var sum cpioSum
+	if rs, ok := f.(io.ReadSeeker); ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err == nil {
+			if _, err := io.CopyN(&sum, rs, size); err != nil {
+				return nil, 0, noEOF(err)
+			}
+			if _, err := rs.Seek(start, io.SeekStart); err != nil {
+				return nil, 0, err
+			}
+			return io.NopCloser(rs), uint32(sum), nil
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "archiver-cpio-*")
+	if err != nil {
+		return nil, 0, err
+	}
+	os.Remove(tmp.Name()) // only needed while open
+	if _, err := io.CopyN(io.MultiWriter(tmp, &sum), f, size); err != nil {
+		tmp.Close()
+		return nil, 0, noEOF(err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		return nil, 0, err
+	}
+	return tmp, uint32(sum), nil
+}
+
+// cpioSum is the checksum of the CRC format,
+// the sum of all bytes of the contents.
+type cpioSum uint32
+
+func (s *cpioSum) Write(p []byte) (int, error) {
+	for _, b := range p {
+		*s += cpioSum(b)
+	}
+	return len(p), nil
+}
+
+// padding returns the number of bytes of padding after n bytes
+// of a header or contents; the newc and CRC formats align them
+// to 4 bytes.
+func (f CpioFormat) padding(n int64) int64 {
+	if f == CpioODC {
+		return 0
+	}
+	return -n & 3
+}
+
+// cpioFields reads or writes the numeric fields of a cpio header,
+// which are fixed-width ASCII numbers in the given base.
+type cpioFields struct {
+	buf  []byte
+	base int
+	err  error
+}
+
+// get reads a field of the given width from the start of buf.
+func (f *cpioFields) get(width int) int64 {
+	if f.err != nil {
+		return 0
+	}
+	field := f.buf[:width]
+	f.buf = f.buf[width:]
+	v, err := strconv.ParseInt(string(field), f.base, 64)
+	if err != nil || v < 0 {
+		f.err = fmt.Errorf("invalid cpio header: field %q", field)
+	}
+	return v
+}
+
+// put appends a field of the given width to buf.
+func (f *cpioFields) put(v int64, width int) {
+	if f.err != nil {
+		return
+	}
+	field := strings.ToUpper(strconv.FormatInt(v, f.base))
+	if v < 0 || len(field) > width {
+		f.err = fmt.Errorf("value %d does not fit in a cpio header field of %d digits", v, width)
+		return
+	}
+	f.buf = append(f.buf, strings.Repeat("0", width-len(field))...)
+	f.buf = append(f.buf, field...)
+}
+
+const (
+	cpioMagicNewc = "070701"
+	cpioMagicCRC  = "070702"
+	cpioMagicODC  = "070707"
+	cpioMagicLen  = 6
+
+	cpioNewcHeaderLen = 110
+	cpioODCHeaderLen  = 76
+
+	// The name of the entry at the end of the archive.
+	cpioTrailer = "TRAILER!!!"
+
+	// Names are limited to keep headers from taking a lot of
+	// memory; they are far longer than paths on disk can be.
+	cpioMaxNameSize = 64 << 10
+)
+
+// Interface guards
+var (
+	_ Archiver      = (*Cpio)(nil)
+	_ ArchiverAsync = (*Cpio)(nil)
+	_ Extractor     = (*Cpio)(nil)
+)
@@ -0,0 +1,135 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"maps"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestCpioArchive(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dir":           {Mode: fs.ModeDir | 0755, ModTime: modTime},
+		"dir/a.txt":     {Data: []byte("contents of a"), Mode: 0644, ModTime: modTime},
+		"dir/empty.txt": {Mode: 0600, ModTime: modTime},
+		"dir/link":      {Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777, ModTime: modTime},
+		"dir/setuid":    {Data: []byte("#!/bin/sh\n"), Mode: fs.ModeSetuid | 0755, ModTime: modTime},
+		"fifo":          {Mode: fs.ModeNamedPipe | 0644, ModTime: modTime},
+	}
+	target, err := fs.Stat(fsys, "dir/a.txt")
+	checkErr(t, err, "getting info of hard link target")
+	files := append(filesFromMapFS(t, fsys), FileInfo{
+		FileInfo:      target,
+		NameInArchive: "hardlink",
+		LinkTarget:    "dir/a.txt",
+	})
+
+	// hard links are extracted as empty files, since they share
+	// the inode of their target, which has the contents
+	want := maps.Clone(fsys)
+	want["hardlink"] = &fstest.MapFile{Mode: 0644, ModTime: modTime}
+
+	for _, tc := range []struct {
+		name   string
+		format CpioFormat
+		magic  string
+	}{
+		{name: "newc", format: CpioNewc, magic: "070701"},
+		{name: "crc", format: CpioCRC, magic: "070702"},
+		{name: "odc", format: CpioODC, magic: "070707"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			archive, got := roundTrip(t, Cpio{Format: tc.format}, files)
+			if magic := string(archive[:6]); magic != tc.magic {
+				t.Errorf("expected magic number %s but got %s", tc.magic, magic)
+			}
+			if !bytes.Contains(archive, []byte(cpioTrailer)) {
+				t.Error("expected the archive to end with a trailer")
+			}
+			checkExtractedFiles(t, got, want)
+
+			for name, f := range got {
+				if hdr := f.Header.(*CpioHeader); hdr.Format != tc.format {
+					t.Errorf("%s: expected format %d in header but got %d", name, tc.format, hdr.Format)
+				}
+			}
+			if link := got["hardlink"]; link.LinkTarget != "dir/a.txt" || link.Size() != 0 {
+				t.Errorf("expected an empty hard link to dir/a.txt but got %q with size %d", link.LinkTarget, link.Size())
+			}
+			linkHdr, targetHdr := got["hardlink"].Header.(*CpioHeader), got["dir/a.txt"].Header.(*CpioHeader)
+			if linkHdr.Inode != targetHdr.Inode || linkHdr.Nlink != 2 || targetHdr.Nlink != 2 {
+				t.Errorf("expected hard link and target to share an inode with 2 links, but got inodes %d and %d with %d and %d links",
+					linkHdr.Inode, targetHdr.Inode, linkHdr.Nlink, targetHdr.Nlink)
+			}
+		})
+	}
+}
+
+func TestCpioExtractDeferredLinks(t *testing.T) {
+	// archives made by GNU cpio and bsdtar have the contents of
+	// hard-linked files with the last of the links
+	var buf bytes.Buffer
+	cw := &cpioWriter{w: &buf}
+	for _, hdr := range []*CpioHeader{
+		{Name: "first", Inode: 1, Mode: unixModeRegular | 0644, Nlink: 3},
+		{Name: "other", Inode: 2, Mode: unixModeRegular | 0644, Nlink: 1, Size: 5},
+		{Name: "second", Inode: 1, Mode: unixModeRegular | 0644, Nlink: 3},
+		{Name: "data", Inode: 1, Mode: unixModeRegular | 0644, Nlink: 3, Size: 4},
+		{Name: "empty1", Inode: 3, Mode: unixModeRegular | 0644, Nlink: 2},
+		{Name: "empty2", Inode: 3, Mode: unixModeRegular | 0644, Nlink: 2},
+	} {
+		checkErr(t, cw.writeHeader(hdr), "writing header")
+		buf.WriteString(strings.Repeat("x", int(hdr.Size)))
+		checkErr(t, cw.pad(hdr.Size), "writing padding")
+	}
+	checkErr(t, cw.close(), "writing trailer")
+
+	var got []string
+	err := Cpio{}.Extract(context.Background(), &buf, func(_ context.Context, fi FileInfo) error {
+		rc, err := fi.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		got = append(got, fi.NameInArchive+">"+fi.LinkTarget+":"+string(data))
+		return err
+	})
+	checkErr(t, err, "extracting archive")
+
+	want := []string{"other>:xxxxx", "data>:xxxx", "first>data:", "second>data:", "empty1>:", "empty2>empty1:"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected files %v but got %v", want, got)
+	}
+}
+
+func TestCpioExtractChecksum(t *testing.T) {
+	files := filesFromMapFS(t, fstest.MapFS{
+		"a.txt": {Data: []byte("checked contents"), Mode: 0644},
+	})
+	var buf bytes.Buffer
+	err := Cpio{Format: CpioCRC}.Archive(context.Background(), &buf, files)
+	checkErr(t, err, "writing archive")
+	archive := buf.Bytes()
+
+	i := bytes.Index(archive, []byte("checked"))
+	archive[i] = 'C'
+	err = Cpio{}.Extract(context.Background(), bytes.NewReader(archive), func(_ context.Context, fi FileInfo) error {
+		rc, err := fi.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		_, err = io.ReadAll(rc)
+		return err
+	})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum error but got %v", err)
+	}
+}
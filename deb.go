@@ -0,0 +1,143 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	RegisterFormat(Deb{})
+}
+
+// Deb can read Debian binary packages, which are ar archives of a
+// debian-binary file with the version of the package format, followed
+// by the control.tar and data.tar archives, usually compressed. Using
+// Tar and the compression format of their extensions, the files in
+// those archives are extracted as if they were in "control" and "data"
+// folders (for example, "data/usr/bin/hello"), so a package can be read
+// like a single archive. Other members of the package, and archives
+// compressed with formats that aren't supported, are extracted as they
+// are.
+type Deb struct{}
+
+func (Deb) Extension() string { return ".deb" }
+
+func (d Deb) Match(_ context.Context, filename string, stream io.Reader) (MatchResult, error) {
+	var mr MatchResult
+
+	// match filename
+	if filepath.Ext(strings.ToLower(filename)) == d.Extension() {
+		mr.ByName = true
+	}
+
+	// match file header
+	buf, err := readAtMost(stream, len(arHeader)+len(debFirstMember))
+	if err != nil {
+		return mr, err
+	}
+	mr.ByStream = isDeb(buf)
+
+	return mr, nil
+}
+
+func (Deb) Extract(ctx context.Context, sourceArchive io.Reader, handleFile FileHandler) error {
+	ar, err := newArReader(sourceArchive)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err // honor context cancellation
+		}
+
+		hdr, err := ar.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		folder, tarball, ok := debTarball(hdr.Name)
+		if !ok {
+			info := arFileInfo{hdr}
+			err := handleFile(ctx, FileInfo{
+				FileInfo:      info,
+				Header:        hdr,
+				NameInArchive: hdr.Name,
+				Open: func() (fs.File, error) {
+					return fileInArchive{io.NopCloser(ar), info}, nil
+				},
+			})
+			if errors.Is(err, fs.SkipAll) {
+				break
+			} else if err != nil && !errors.Is(err, fs.SkipDir) {
+				return fmt.Errorf("handling file: %s: %w", hdr.Name, err)
+			}
+			continue
+		}
+
+		// the tar archive stops at fs.SkipAll, but so should the package
+		var stop bool
+		err = tarball.Extract(ctx, ar, func(ctx context.Context, f FileInfo) error {
+			f.NameInArchive = path.Join(folder, f.NameInArchive)
+			if f.IsDir() {
+				f.NameInArchive += "/"
+			}
+			if f.LinkTarget != "" && !isSymlink(f) {
+				f.LinkTarget = path.Join(folder, f.LinkTarget) // hard links are relative to the archive
+			}
+			err := handleFile(ctx, f)
+			stop = errors.Is(err, fs.SkipAll)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("extracting %s: %w", hdr.Name, err)
+		}
+		if stop {
+			break
+		}
+	}
+
+	return nil
+}
+
+// debTarball returns the folder in which to extract the files of the
+// package member with the given name, and the format with which to
+// extract them, if it is the control or data archive of the package
+// in a supported format.
+func debTarball(name string) (string, Archive, bool) {
+	for _, folder := range []string{"control", "data"} {
+		ext, ok := strings.CutPrefix(name, folder+".tar")
+		if !ok {
+			continue
+		}
+		tarball := Archive{Archival: Tar{}, Extraction: Tar{}}
+		if ext == "" {
+			return folder, tarball, true
+		}
+		tarball.Compression, ok = formats[strings.TrimPrefix(ext, ".")].(Compression)
+		return folder, tarball, ok
+	}
+	return "", Archive{}, false
+}
+
+// isDeb returns true if buf, the start of a file,
+// is the start of a Debian package.
+func isDeb(buf []byte) bool {
+	return bytes.HasPrefix(buf, arHeader) && bytes.HasPrefix(buf[len(arHeader):], debFirstMember)
+}
+
+// The first member of a Debian package is the version of its format.
+var debFirstMember = []byte("debian-binary")
+
+// Interface guard
+var _ Extractor = (*Deb)(nil)
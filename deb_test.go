@@ -0,0 +1,92 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDebExtract(t *testing.T) {
+	tarball := func(format Archiver, fsys fstest.MapFS) []byte {
+		t.Helper()
+		var buf bytes.Buffer
+		checkErr(t, format.Archive(context.Background(), &buf, filesFromMapFS(t, fsys)), "writing tar archive")
+		return buf.Bytes()
+	}
+	data := filesFromMapFS(t, fstest.MapFS{
+		"usr":           {Mode: fs.ModeDir | 0755},
+		"usr/bin":       {Mode: fs.ModeDir | 0755},
+		"usr/bin/hello": {Data: []byte("#!/bin/sh\necho hello\n"), Mode: 0755},
+	})
+	data = append(data, FileInfo{
+		FileInfo:      data[2].FileInfo,
+		Header:        &tar.Header{Typeflag: tar.TypeLink, Name: "usr/bin/hi", Linkname: "usr/bin/hello", Mode: 0755},
+		NameInArchive: "usr/bin/hi",
+		LinkTarget:    "usr/bin/hello",
+	})
+	var dataTar bytes.Buffer
+	err := Archive{Compression: Xz{}, Archival: Tar{}}.Archive(context.Background(), &dataTar, data)
+	checkErr(t, err, "writing data archive")
+
+	members := fstest.MapFS{
+		"debian-binary":  {Data: []byte("2.0\n"), Mode: 0644},
+		"control.tar.gz": {Data: tarball(Archive{Compression: Gz{}, Archival: Tar{}}, fstest.MapFS{"control": {Data: []byte("Package: hello\n"), Mode: 0644}}), Mode: 0644},
+		"data.tar.xz":    {Data: dataTar.Bytes(), Mode: 0644},
+		"data.tar.lzma":  {Data: []byte("unsupported"), Mode: 0644},
+	}
+	var files []FileInfo
+	for _, name := range []string{"debian-binary", "control.tar.gz", "data.tar.xz", "data.tar.lzma"} {
+		info, err := fs.Stat(members, name)
+		checkErr(t, err, "getting file info")
+		files = append(files, FileInfo{FileInfo: info, NameInArchive: name, Open: func() (fs.File, error) { return members.Open(name) }})
+	}
+	var pkg bytes.Buffer
+	checkErr(t, Ar{Format: ArBSD}.Archive(context.Background(), &pkg, files), "writing package")
+
+	format, stream, err := Identify(context.Background(), "", bytes.NewReader(pkg.Bytes()))
+	checkErr(t, err, "identifying package")
+	if _, ok := format.(Deb); !ok {
+		t.Fatalf("expected package to be identified as Deb, but got %T", format)
+	}
+
+	var got []string
+	links := make(map[string]string)
+	err = Deb{}.Extract(context.Background(), stream, func(_ context.Context, f FileInfo) error {
+		got = append(got, f.NameInArchive)
+		links[f.NameInArchive] = f.LinkTarget
+		return nil
+	})
+	checkErr(t, err, "extracting package")
+	want := []string{"debian-binary", "control/control", "data/usr/", "data/usr/bin/", "data/usr/bin/hello", "data/usr/bin/hi", "data.tar.lzma"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected files %v but got %v", want, got)
+	}
+	if target := links["data/usr/bin/hi"]; target != "data/usr/bin/hello" {
+		t.Errorf("expected hard link to data/usr/bin/hello but got %q", target)
+	}
+
+	// stopping in one of the tar archives stops extracting the package
+	got = nil
+	err = Deb{}.Extract(context.Background(), bytes.NewReader(pkg.Bytes()), func(_ context.Context, f FileInfo) error {
+		got = append(got, f.NameInArchive)
+		if f.NameInArchive == "control/control" {
+			return fs.SkipAll
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		_, err = io.Copy(io.Discard, rc)
+		return err
+	})
+	checkErr(t, err, "extracting package")
+	if len(got) != 2 {
+		t.Errorf("expected extraction to stop after control/control, but got %v", got)
+	}
+}
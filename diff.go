@@ -0,0 +1,347 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Diff compares the contents of two file systems and returns the
+// differences between them, sorted by path. Paths that exist only in b
+// are reported as added, paths that exist only in a are reported as
+// removed, and paths that exist in both are compared by type, size,
+// permissions, modification time, and link target (and, optionally,
+// content).
+//
+// Any fs.FS can be compared, but this is especially useful with the
+// file systems returned by FileSystem, so that directories, archives,
+// and compressed archives can be compared with each other uniformly.
+// For example, a backup archive can be verified against the directory
+// it was made from.
+//
+// Link targets of symbolic links are only known if the file system is
+// an ArchiveFS or if it has a ReadLink method (such as os.DirFS in
+// recent versions of Go), so they are only compared if both file
+// systems are one of those.
+func Diff(ctx context.Context, a, b fs.FS, options *DiffOptions) ([]Difference, error) {
+	if options == nil {
+		options = new(DiffOptions)
+	}
+
+	entriesA, err := diffEntries(ctx, a)
+	if err != nil {
+		return nil, fmt.Errorf("walking first file system: %w", err)
+	}
+	entriesB, err := diffEntries(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("walking second file system: %w", err)
+	}
+
+	var diffs []Difference
+	var needContents []string // files that can only be compared by content
+	for name, ea := range entriesA {
+		eb, ok := entriesB[name]
+		if !ok {
+			diffs = append(diffs, Difference{Path: name, Type: DiffRemoved, A: ea.info})
+			continue
+		}
+		changes := options.compare(ea, eb)
+		if options.CompareContents && changes&ChangedSize == 0 &&
+			ea.info.Mode().IsRegular() && eb.info.Mode().IsRegular() {
+			needContents = append(needContents, name)
+		}
+		if changes != 0 {
+			diffs = append(diffs, Difference{Path: name, Type: DiffChanged, Changes: changes, A: ea.info, B: eb.info})
+		}
+	}
+	for name, eb := range entriesB {
+		if _, ok := entriesA[name]; !ok {
+			diffs = append(diffs, Difference{Path: name, Type: DiffAdded, B: eb.info})
+		}
+	}
+
+	if len(needContents) > 0 {
+		hashesA, err := hashFiles(ctx, a, needContents)
+		if err != nil {
+			return nil, fmt.Errorf("hashing files in first file system: %w", err)
+		}
+		hashesB, err := hashFiles(ctx, b, needContents)
+		if err != nil {
+			return nil, fmt.Errorf("hashing files in second file system: %w", err)
+		}
+		for _, name := range needContents {
+			if bytes.Equal(hashesA[name], hashesB[name]) {
+				continue
+			}
+			idx := slices.IndexFunc(diffs, func(d Difference) bool { return d.Path == name })
+			if idx < 0 {
+				diffs = append(diffs, Difference{Path: name, Type: DiffChanged, A: entriesA[name].info, B: entriesB[name].info})
+				idx = len(diffs) - 1
+			}
+			diffs[idx].Changes |= ChangedContent
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+
+	return diffs, nil
+}
+
+// DiffOptions customizes how file systems are compared by Diff.
+type DiffOptions struct {
+	// If true, regular files of the same size are also
+	// compared by the hash of their contents. This requires
+	// reading all such files in both file systems.
+	CompareContents bool
+
+	// Modification times that differ by no more than this
+	// amount are considered equal. Archive formats store
+	// times with varying precision (for example, zip stores
+	// times to within 2 seconds, and tar to within 1 second
+	// by default), so this is useful when comparing an
+	// archive with the files it was created from.
+	ModTimeTolerance time.Duration
+
+	// If true, modification times are not compared.
+	IgnoreModTime bool
+}
+
+// compare returns the ways in which the two entries differ,
+// not including their contents.
+func (o DiffOptions) compare(a, b diffEntry) Change {
+	var changes Change
+	if a.info.Mode().Type() != b.info.Mode().Type() {
+		// the rest of the comparisons are meaningless if
+		// the entries are not even the same kind of file
+		return ChangedType
+	}
+	if a.info.Mode() != b.info.Mode() {
+		changes |= ChangedMode
+	}
+	if a.info.Mode().IsRegular() && a.info.Size() != b.info.Size() {
+		changes |= ChangedSize
+	}
+	if !o.IgnoreModTime {
+		ta, tb := a.info.ModTime(), b.info.ModTime()
+		// implicit directories in archives have no modification time
+		if !ta.IsZero() && !tb.IsZero() {
+			d := ta.Sub(tb)
+			if d < 0 {
+				d = -d
+			}
+			if d > o.ModTimeTolerance {
+				changes |= ChangedModTime
+			}
+		}
+	}
+	if a.linkKnown && b.linkKnown && a.linkTarget != b.linkTarget {
+		changes |= ChangedLinkTarget
+	}
+	return changes
+}
+
+// Difference is a difference between two file systems.
+type Difference struct {
+	// The path of the file that differs.
+	Path string
+
+	// Whether the file was added, removed, or changed.
+	Type DiffType
+
+	// For changed files, the ways in which they differ.
+	Changes Change
+
+	// Information about the file in the first and second
+	// file systems. A is nil if the file was added, and B
+	// is nil if the file was removed.
+	A, B fs.FileInfo
+}
+
+func (d Difference) String() string {
+	if d.Type == DiffChanged {
+		return fmt.Sprintf("%s %s (%s)", d.Type, d.Path, d.Changes)
+	}
+	return fmt.Sprintf("%s %s", d.Type, d.Path)
+}
+
+// DiffType is the type of a Difference.
+type DiffType int
+
+// Types of differences.
+const (
+	DiffAdded DiffType = iota + 1
+	DiffRemoved
+	DiffChanged
+)
+
+func (t DiffType) String() string {
+	switch t {
+	case DiffAdded:
+		return "added"
+	case DiffRemoved:
+		return "removed"
+	case DiffChanged:
+		return "changed"
+	}
+	return fmt.Sprintf("DiffType(%d)", int(t))
+}
+
+// Change is a set of ways in which a file changed.
+type Change uint8
+
+// Ways in which a file can change.
+const (
+	ChangedType Change = 1 << iota
+	ChangedMode
+	ChangedSize
+	ChangedModTime
+	ChangedLinkTarget
+	ChangedContent
+)
+
+func (c Change) String() string {
+	var names []string
+	for _, ch := range []struct {
+		change Change
+		name   string
+	}{
+		{ChangedType, "type"},
+		{ChangedMode, "mode"},
+		{ChangedSize, "size"},
+		{ChangedModTime, "mtime"},
+		{ChangedLinkTarget, "link target"},
+		{ChangedContent, "content"},
+	} {
+		if c&ch.change != 0 {
+			names = append(names, ch.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// diffEntry is a file to be compared.
+type diffEntry struct {
+	info       fs.FileInfo
+	linkTarget string
+	linkKnown  bool // whether linkTarget could be read
+}
+
+// readLinkFS is a file system that can read symbolic links.
+// (It is the same as fs.ReadLinkFS in newer versions of Go.)
+type readLinkFS interface {
+	ReadLink(name string) (string, error)
+}
+
+// diffEntries walks fsys and returns all its entries by path,
+// except for the root.
+func diffEntries(ctx context.Context, fsys fs.FS) (map[string]diffEntry, error) {
+	entries := make(map[string]diffEntry)
+	err := fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if fpath == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := diffEntry{info: info}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if fi, ok := info.(FileInfo); ok {
+				entry.linkTarget, entry.linkKnown = fi.LinkTarget, true
+			} else if rl, ok := fsys.(readLinkFS); ok {
+				entry.linkTarget, err = rl.ReadLink(fpath)
+				if err != nil {
+					return err
+				}
+				entry.linkKnown = true
+			}
+		}
+		entries[fpath] = entry
+		return nil
+	})
+	return entries, err
+}
+
+// hashFiles returns the hashes of the contents of the named files in fsys.
+// Archives are read only once, rather than once per file.
+func hashFiles(ctx context.Context, fsys fs.FS, names []string) (map[string][]byte, error) {
+	hashes := make(map[string][]byte, len(names))
+
+	if afs, ok := fsys.(*ArchiveFS); ok {
+		wanted := make(map[string]bool, len(names))
+		for _, name := range names {
+			wanted[path.Join(afs.Prefix, name)] = true
+		}
+
+		var input io.Reader
+		if afs.Stream != nil {
+			input = io.NewSectionReader(afs.Stream, 0, afs.Stream.Size())
+		} else {
+			archiveFile, err := os.Open(afs.Path)
+			if err != nil {
+				return nil, err
+			}
+			defer archiveFile.Close()
+			input = archiveFile
+		}
+
+		err := afs.Format.Extract(ctx, input, func(ctx context.Context, f FileInfo) error {
+			name := path.Clean(f.NameInArchive)
+			if !wanted[name] {
+				return nil
+			}
+			sum, err := hashFile(f.Open)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			hashes[strings.TrimPrefix(strings.TrimPrefix(name, afs.Prefix), "/")] = sum
+			return nil
+		})
+		return hashes, err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		sum, err := hashFile(func() (fs.File, error) { return fsys.Open(name) })
+		if err != nil {
+			return nil, err
+		}
+		hashes[name] = sum
+	}
+	return hashes, nil
+}
+
+// hashFile returns the hash of the contents of the file opened by open.
+func hashFile(open func() (fs.File, error)) ([]byte, error) {
+	if open == nil {
+		return nil, errors.New("file cannot be opened")
+	}
+	f, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
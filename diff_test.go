@@ -0,0 +1,177 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a := fstest.MapFS{
+		"same.txt":    {Data: []byte("same"), Mode: 0644, ModTime: now},
+		"removed.txt": {Data: []byte("gone"), Mode: 0644, ModTime: now},
+		"size.txt":    {Data: []byte("short"), Mode: 0644, ModTime: now},
+		"mode.sh":     {Data: []byte("#!/bin/sh"), Mode: 0644, ModTime: now},
+		"mtime.txt":   {Data: []byte("time"), Mode: 0644, ModTime: now},
+		"content.txt": {Data: []byte("aaaa"), Mode: 0644, ModTime: now},
+		"kind":        {Mode: fs.ModeDir | 0755, ModTime: now},
+	}
+	b := fstest.MapFS{
+		"same.txt":    {Data: []byte("same"), Mode: 0644, ModTime: now.Add(time.Second)},
+		"added.txt":   {Data: []byte("new"), Mode: 0644, ModTime: now},
+		"size.txt":    {Data: []byte("longer"), Mode: 0644, ModTime: now},
+		"mode.sh":     {Data: []byte("#!/bin/sh"), Mode: 0755, ModTime: now},
+		"mtime.txt":   {Data: []byte("time"), Mode: 0644, ModTime: now.Add(time.Hour)},
+		"content.txt": {Data: []byte("bbbb"), Mode: 0644, ModTime: now},
+		"kind":        {Data: []byte("file"), Mode: 0644, ModTime: now},
+	}
+
+	for _, tc := range []struct {
+		name    string
+		options *DiffOptions
+		expect  []string
+	}{
+		{
+			name:    "metadata",
+			options: &DiffOptions{ModTimeTolerance: 2 * time.Second},
+			expect: []string{
+				"added added.txt",
+				"changed kind (type)",
+				"changed mode.sh (mode)",
+				"changed mtime.txt (mtime)",
+				"removed removed.txt",
+				"changed size.txt (size)",
+			},
+		},
+		{
+			name:    "contents",
+			options: &DiffOptions{CompareContents: true, IgnoreModTime: true},
+			expect: []string{
+				"added added.txt",
+				"changed content.txt (content)",
+				"changed kind (type)",
+				"changed mode.sh (mode)",
+				"removed removed.txt",
+				"changed size.txt (size)",
+			},
+		},
+		{
+			name:    "exact times",
+			options: nil,
+			expect: []string{
+				"added added.txt",
+				"changed kind (type)",
+				"changed mode.sh (mode)",
+				"changed mtime.txt (mtime)",
+				"removed removed.txt",
+				"changed same.txt (mtime)",
+				"changed size.txt (size)",
+			},
+		},
+	} {
+		diffs, err := Diff(context.Background(), a, b, tc.options)
+		checkErr(t, err, tc.name)
+		var actual []string
+		for _, d := range diffs {
+			actual = append(actual, d.String())
+		}
+		if len(actual) != len(tc.expect) {
+			t.Errorf("%s: expected %d differences %v but got %d: %v", tc.name, len(tc.expect), tc.expect, len(actual), actual)
+			continue
+		}
+		for i := range actual {
+			if actual[i] != tc.expect[i] {
+				t.Errorf("%s: difference %d: expected '%s' but got '%s'", tc.name, i, tc.expect[i], actual[i])
+			}
+		}
+	}
+}
+
+func TestDiffArchive(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	archive := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: now}},
+		{hdr: tar.Header{Name: "dir/a.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: now}, body: "hello"},
+		{hdr: tar.Header{Name: "dir/b.txt", Typeflag: tar.TypeReg, Mode: 0644, ModTime: now}, body: "world"},
+		{hdr: tar.Header{Name: "dir/link", Typeflag: tar.TypeSymlink, Linkname: "a.txt", Mode: 0777, ModTime: now}},
+	})
+	afs := &ArchiveFS{
+		Stream: io.NewSectionReader(bytes.NewReader(archive), 0, int64(len(archive))),
+		Format: Tar{},
+	}
+	mapFS := fstest.MapFS{
+		"dir":       {Mode: fs.ModeDir | 0755, ModTime: now},
+		"dir/a.txt": {Data: []byte("hello"), Mode: 0644, ModTime: now},
+		"dir/b.txt": {Data: []byte("World"), Mode: 0644, ModTime: now},
+		"dir/link":  {Data: []byte("a.txt"), Mode: fs.ModeSymlink | 0777, ModTime: now},
+	}
+
+	diffs, err := Diff(context.Background(), afs, mapFS, &DiffOptions{CompareContents: true})
+	checkErr(t, err, "comparing archive")
+
+	// the link target is the same, if the MapFS can tell us (since Go
+	// 1.25); if it can't, the link target isn't compared
+	expect := []string{"changed dir/b.txt (content)"}
+	if len(diffs) != len(expect) {
+		t.Fatalf("expected differences %v but got %v", expect, diffs)
+	}
+	for i, d := range diffs {
+		if d.String() != expect[i] {
+			t.Errorf("difference %d: expected '%s' but got '%s'", i, expect[i], d)
+		}
+	}
+}
+
+func TestDiffDirSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	dir := t.TempDir()
+	checkErr(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644), "writing file")
+	checkErr(t, os.Chmod(filepath.Join(dir, "a.txt"), 0644), "setting mode")
+	checkErr(t, os.Symlink("a.txt", filepath.Join(dir, "link")), "creating symlink")
+
+	for _, tc := range []struct {
+		name   string
+		target string
+		dirFS  fs.FS
+		expect []string
+	}{
+		{name: "same target", target: "a.txt", dirFS: os.DirFS(dir)},
+		{name: "different target", target: "b.txt", dirFS: os.DirFS(dir), expect: []string{"changed link (link target)"}},
+		// os.DirFS can't read links before Go 1.25, so the targets aren't compared
+		{name: "unknown target", target: "b.txt", dirFS: struct{ fs.FS }{os.DirFS(dir)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			archive := buildTar(t, []tarEntry{
+				{hdr: tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "hello"},
+				{hdr: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: tc.target, Mode: 0777}},
+			})
+			afs := &ArchiveFS{
+				Stream: io.NewSectionReader(bytes.NewReader(archive), 0, int64(len(archive))),
+				Format: Tar{},
+			}
+
+			diffs, err := Diff(context.Background(), afs, tc.dirFS, &DiffOptions{IgnoreModTime: true})
+			checkErr(t, err, "comparing archive with directory")
+			var got []string
+			for _, d := range diffs {
+				got = append(got, d.String())
+			}
+			if !slices.Equal(got, tc.expect) {
+				t.Errorf("expected differences %v but got %v", tc.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package archiver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExtractToDisk extracts the archive read from sourceArchive into the
+// destination directory on disk, using format to read the archive. It
+// is the counterpart to FilesFromDisk: regular files, directories,
+// symbolic links, and hard links are created with the modes and
+// modification times recorded in the archive. Other kinds of entries
+// (such as device files and named pipes) are skipped.
+//
+// The format can be any Extractor, including Archive values for
+// compressed archives. Some formats (like Zip and SevenZip) require
+// sourceArchive to also be an io.ReaderAt and io.Seeker; see their
+// Extract methods for details.
+//
+// Since names in archives cannot be trusted, entries are never written
+// outside of the destination directory: entries with absolute paths,
+// ".." components, Windows drive or volume prefixes, or backslashes
+// in their names are rejected (or rewritten, if enabled in options),
+// and nothing is written through a symbolic link that resolves outside
+// of the destination (for example, one created earlier in the same
+// archive). Such violations are reported as *UnsafePathError.
+//
+// The destination directory is created if it does not exist.
+// Extraction will adhere to the settings specified in options.
+func ExtractToDisk(ctx context.Context, format Extractor, sourceArchive io.Reader, destination string, options *ToDiskOptions) error {
+	if options == nil {
+		options = new(ToDiskOptions)
+	}
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return fmt.Errorf("creating destination directory: %w", err)
+	}
+
+	// symbolic links are resolved when checking containment,
+	// so the destination itself must be resolved for comparison
+	realRoot, err := filepath.EvalSymlinks(destination)
+	if err != nil {
+		return fmt.Errorf("resolving destination directory: %w", err)
+	}
+	realRoot, err = filepath.Abs(realRoot)
+	if err != nil {
+		return fmt.Errorf("resolving destination directory: %w", err)
+	}
+
+	de := &diskExtractor{
+		ToDiskOptions: *options,
+		root:          destination,
+		realRoot:      realRoot,
+	}
+	if de.PathsInArchive != nil {
+		de.PathsInArchive = make([]string, len(options.PathsInArchive))
+		for i, p := range options.PathsInArchive {
+			de.PathsInArchive[i] = strings.TrimPrefix(path.Clean("/"+p), "/")
+		}
+	}
+
+	if err := format.Extract(ctx, sourceArchive, de.handleFile); err != nil {
+		return err
+	}
+
+	return de.finishDirs()
+}
+
+// ToDiskOptions specifies various options for extracting files to disk.
+type ToDiskOptions struct {
+	// If set, only these paths in the archive are extracted. Paths
+	// of directories include their contents. Paths are matched after
+	// cleaning (and sanitizing, if enabled) the names of entries.
+	PathsInArchive []string
+
+	// If true, files and links which already exist on disk will
+	// be replaced. Otherwise, extraction fails upon encountering
+	// an existing file. Existing directories are always reused.
+	Overwrite bool
+
+	// If true, file modes and modification times from the archive
+	// will not be applied to the extracted files; the defaults
+	// of the operating system are used instead.
+	ClearAttributes bool
+
+	// If true, unsafe entry names are rewritten to stay within the
+	// destination instead of being rejected: backslashes become
+	// slashes, and drive or volume prefixes, leading slashes, and
+	// ".." components are removed. For example, "../../etc/passwd"
+	// is extracted as "etc/passwd".
+	SanitizeNames bool
+
+	// If set, entries that fail the safety checks are skipped and
+	// reported to this function instead of aborting the extraction.
+	// If the function returns an error, extraction stops with that
+	// error. If nil, the first unsafe entry aborts the extraction.
+	OnUnsafeEntry func(err *UnsafePathError) error
+}
+
+// UnsafePathError is returned when extracting an entry would create
+// or write to a file outside of the destination directory.
+type UnsafePathError struct {
+	// The name of the offending entry as it appears in the archive.
+	NameInArchive string
+
+	// Why the entry was deemed unsafe.
+	Reason string
+}
+
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("unsafe entry %q: %s", e.NameInArchive, e.Reason)
+}
+
+// diskExtractor writes the entries of a single archive to disk.
+type diskExtractor struct {
+	ToDiskOptions
+	root     string
+	realRoot string // root with symlinks resolved; absolute
+
+	// directory attributes are applied after extraction, since
+	// restrictive modes would prevent writing their contents and
+	// writing their contents would update their mod times
+	dirs []extractedDir
+}
+
+type extractedDir struct {
+	path    string
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (de *diskExtractor) handleFile(ctx context.Context, file FileInfo) error {
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+
+	name, reason := safeName(file.NameInArchive, de.SanitizeNames)
+	if reason != "" {
+		return de.unsafe(file.NameInArchive, reason)
+	}
+	if name == "." {
+		return nil // root of the archive; the destination itself
+	}
+	if !fileIsIncluded(de.PathsInArchive, name) {
+		return nil
+	}
+	target := filepath.Join(de.root, filepath.FromSlash(name))
+
+	// make sure we won't be writing through a symlink that leads outside
+	// the destination; directories are checked including themselves since
+	// they are reused if they exist, but other files are always recreated
+	checkPath := filepath.Dir(target)
+	if file.IsDir() {
+		checkPath = target
+	}
+	if inside, err := de.resolvesInside(checkPath); err != nil {
+		return fmt.Errorf("%s: %w", file.NameInArchive, err)
+	} else if !inside {
+		return de.unsafe(file.NameInArchive, "path traverses a symbolic link that leads outside the destination")
+	}
+
+	switch {
+	case file.IsDir():
+		return de.writeDir(target, file)
+	case isSymlink(file):
+		return de.writeSymlink(target, file)
+	case file.LinkTarget != "" && file.Mode().Type() == 0:
+		return de.writeHardLink(target, file)
+	case file.Mode().IsRegular():
+		return de.writeFile(target, file)
+	}
+
+	return nil
+}
+
+func (de *diskExtractor) writeDir(target string, file FileInfo) error {
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return fmt.Errorf("%s: creating directory: %w", file.NameInArchive, err)
+	}
+	de.dirs = append(de.dirs, extractedDir{
+		path:    target,
+		mode:    file.Mode(),
+		modTime: file.ModTime(),
+	})
+	return nil
+}
+
+func (de *diskExtractor) writeFile(target string, file FileInfo) error {
+	if err := de.prepareTarget(target); err != nil {
+		return fmt.Errorf("%s: %w", file.NameInArchive, err)
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("%s: creating file: %w", file.NameInArchive, err)
+	}
+	if err := openAndCopyFile(file, out); err != nil {
+		out.Close()
+		return fmt.Errorf("%s: writing file: %w", file.NameInArchive, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("%s: closing file: %w", file.NameInArchive, err)
+	}
+
+	return de.setAttributes(target, file.Mode(), file.ModTime())
+}
+
+func (de *diskExtractor) writeSymlink(target string, file FileInfo) error {
+	if file.LinkTarget == "" {
+		return fmt.Errorf("%s: symbolic link has no target", file.NameInArchive)
+	}
+	if err := de.prepareTarget(target); err != nil {
+		return fmt.Errorf("%s: %w", file.NameInArchive, err)
+	}
+	if err := os.Symlink(file.LinkTarget, target); err != nil {
+		return fmt.Errorf("%s: creating symbolic link: %w", file.NameInArchive, err)
+	}
+	return nil
+}
+
+func (de *diskExtractor) writeHardLink(target string, file FileInfo) error {
+	linkTarget, reason := safeName(file.LinkTarget, de.SanitizeNames)
+	if reason != "" {
+		return de.unsafe(file.NameInArchive, "hard link target "+reason)
+	}
+	oldname := filepath.Join(de.root, filepath.FromSlash(linkTarget))
+	if inside, err := de.resolvesInside(oldname); err != nil {
+		return fmt.Errorf("%s: %w", file.NameInArchive, err)
+	} else if !inside {
+		return de.unsafe(file.NameInArchive, "hard link target leads outside the destination")
+	}
+	if err := de.prepareTarget(target); err != nil {
+		return fmt.Errorf("%s: %w", file.NameInArchive, err)
+	}
+	if err := os.Link(oldname, target); err != nil {
+		return fmt.Errorf("%s: creating hard link: %w", file.NameInArchive, err)
+	}
+	return nil
+}
+
+// unsafe reports an unsafe entry. It returns nil if the entry
+// should be skipped, or an error if extraction should stop.
+func (de *diskExtractor) unsafe(nameInArchive, reason string) error {
+	err := &UnsafePathError{NameInArchive: nameInArchive, Reason: reason}
+	if de.OnUnsafeEntry != nil {
+		return de.OnUnsafeEntry(err)
+	}
+	return err
+}
+
+// resolvesInside returns true if p, with all symbolic links in its
+// deepest existing ancestor (or itself, if it exists) resolved, is
+// still within the destination directory.
+func (de *diskExtractor) resolvesInside(p string) (bool, error) {
+	existing := p
+	for {
+		_, err := os.Lstat(existing)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if errors.Is(err, fs.ErrNotExist) {
+		// a dangling symlink; we don't know where it leads
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(de.realRoot, resolved)
+	if err != nil {
+		return false, nil
+	}
+	return filepath.IsLocal(rel) || rel == ".", nil
+}
+
+// safeName returns name, the path of an entry in an archive, as a
+// clean, relative, slash-separated path. If name is not safe to use
+// as a path within a destination directory, the returned reason is
+// non-empty and describes why, unless sanitize is true and the name
+// can be rewritten into a safe one. The returned name may be "." if
+// it refers to the root of the archive.
+func safeName(name string, sanitize bool) (string, string) {
+	var reason string
+	if strings.Contains(name, `\`) {
+		reason = "name contains backslashes"
+		name = strings.ReplaceAll(name, `\`, "/")
+	}
+	if vol := windowsVolumeName(name); vol != "" {
+		reason = "name has a drive or volume prefix"
+		name = name[len(vol):]
+	}
+	if strings.HasPrefix(name, "/") {
+		reason = "name is an absolute path"
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == ".." {
+			reason = "name contains a parent directory reference"
+			break
+		}
+	}
+	if reason != "" && !sanitize {
+		return "", reason
+	}
+
+	// rooting the path before cleaning it discards any ".." that
+	// would otherwise climb above the root
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return ".", ""
+	}
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return "", "name is not a local path"
+	}
+	return name, ""
+}
+
+// windowsVolumeName returns the drive letter ("C:") prefix
+// of the slash-separated path p, if it has one. UNC paths
+// are treated as absolute paths, since they start with "/".
+func windowsVolumeName(p string) string {
+	if len(p) >= 2 && p[1] == ':' &&
+		('a' <= p[0] && p[0] <= 'z' || 'A' <= p[0] && p[0] <= 'Z') {
+		return p[:2]
+	}
+	return ""
+}
+
+// prepareTarget makes sure the parent directory of target exists
+// and, if overwriting is enabled, removes any existing file at
+// target so that a fresh file or link can be created in its place.
+// (Removing it rather than truncating it also ensures we never
+// write through an existing link.)
+func (de *diskExtractor) prepareTarget(target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("creating parent directory: %w", err)
+	}
+	if !de.Overwrite {
+		return nil
+	}
+	info, err := os.Lstat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("cannot overwrite directory %s", target)
+	}
+	return os.Remove(target)
+}
+
+// setAttributes applies the mode and modification time to the
+// file at target, unless attributes are to be cleared.
+func (de *diskExtractor) setAttributes(target string, mode fs.FileMode, modTime time.Time) error {
+	if de.ClearAttributes {
+		return nil
+	}
+	if err := os.Chmod(target, mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+		return fmt.Errorf("setting mode: %w", err)
+	}
+	if !modTime.IsZero() {
+		if err := os.Chtimes(target, modTime, modTime); err != nil {
+			return fmt.Errorf("setting modification time: %w", err)
+		}
+	}
+	return nil
+}
+
+// finishDirs applies the attributes of the extracted directories,
+// deepest first, so that setting attributes of one directory does
+// not interfere with setting those of another.
+func (de *diskExtractor) finishDirs() error {
+	sort.SliceStable(de.dirs, func(i, j int) bool {
+		return de.dirs[i].path > de.dirs[j].path
+	})
+	for _, dir := range de.dirs {
+		if err := de.setAttributes(dir.path, dir.mode, dir.modTime); err != nil {
+			return fmt.Errorf("%s: %w", dir.path, err)
+		}
+	}
+	return nil
+}
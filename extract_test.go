@@ -0,0 +1,268 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// tarEntry describes an entry for building test tarballs.
+type tarEntry struct {
+	hdr  tar.Header
+	body string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		hdr := e.hdr
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(e.body))
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("writing header %s: %v", hdr.Name, err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatalf("writing body %s: %v", hdr.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractToDisk(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic and hard links require privileges on Windows")
+	}
+
+	modTime := time.Date(2020, 2, 2, 2, 2, 2, 0, time.UTC)
+	archive := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime}},
+		{hdr: tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0750, ModTime: modTime}},
+		{hdr: tar.Header{Name: "a/file.txt", Typeflag: tar.TypeReg, Mode: 0640, ModTime: modTime}, body: "hello"},
+		{hdr: tar.Header{Name: "a/link", Typeflag: tar.TypeSymlink, Linkname: "file.txt", ModTime: modTime}},
+		{hdr: tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "a/file.txt", ModTime: modTime}},
+		{hdr: tar.Header{Name: "implicit/dir/file.txt", Typeflag: tar.TypeReg, Mode: 0600, ModTime: modTime}, body: "implicit"},
+	})
+
+	dest := t.TempDir()
+	err := ExtractToDisk(context.Background(), Tar{}, bytes.NewReader(archive), dest, nil)
+	checkErr(t, err, "extracting")
+
+	data, err := os.ReadFile(filepath.Join(dest, "a", "file.txt"))
+	checkErr(t, err, "reading extracted file")
+	if string(data) != "hello" {
+		t.Errorf("expected file contents 'hello' but got '%s'", data)
+	}
+
+	info, err := os.Stat(filepath.Join(dest, "a", "file.txt"))
+	checkErr(t, err, "stat extracted file")
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected mode 0640 but got %v", info.Mode().Perm())
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("expected mod time %v but got %v", modTime, info.ModTime())
+	}
+
+	dirInfo, err := os.Stat(filepath.Join(dest, "a"))
+	checkErr(t, err, "stat extracted directory")
+	if dirInfo.Mode().Perm() != 0750 || !dirInfo.ModTime().Equal(modTime) {
+		t.Errorf("expected directory mode 0750 and mod time %v but got %v and %v",
+			modTime, dirInfo.Mode().Perm(), dirInfo.ModTime())
+	}
+
+	linkTarget, err := os.Readlink(filepath.Join(dest, "a", "link"))
+	checkErr(t, err, "reading symlink")
+	if linkTarget != "file.txt" {
+		t.Errorf("expected link target 'file.txt' but got '%s'", linkTarget)
+	}
+
+	hardInfo, err := os.Stat(filepath.Join(dest, "hard"))
+	checkErr(t, err, "stat hard link")
+	if !os.SameFile(info, hardInfo) {
+		t.Errorf("expected hard link to refer to the same file")
+	}
+
+	data, err = os.ReadFile(filepath.Join(dest, "implicit", "dir", "file.txt"))
+	checkErr(t, err, "reading file in implicit directory")
+	if string(data) != "implicit" {
+		t.Errorf("expected file contents 'implicit' but got '%s'", data)
+	}
+
+	// extracting again should fail, unless overwriting
+	err = ExtractToDisk(context.Background(), Tar{}, bytes.NewReader(archive), dest, nil)
+	if err == nil {
+		t.Errorf("expected error extracting over existing files")
+	}
+	err = ExtractToDisk(context.Background(), Tar{}, bytes.NewReader(archive), dest, &ToDiskOptions{Overwrite: true})
+	checkErr(t, err, "extracting with overwrite")
+}
+
+func TestExtractToDiskZipSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	src := t.TempDir()
+	checkErr(t, os.WriteFile(filepath.Join(src, "target.txt"), []byte("target"), 0644), "writing file")
+	checkErr(t, os.Symlink("target.txt", filepath.Join(src, "link")), "creating symlink")
+
+	files, err := FilesFromDisk(nil, map[string]string{src + string(filepath.Separator): ""})
+	checkErr(t, err, "gathering files")
+
+	buf := new(bytes.Buffer)
+	checkErr(t, Zip{}.Archive(context.Background(), buf, files), "creating zip")
+
+	dest := t.TempDir()
+	err = ExtractToDisk(context.Background(), Zip{}, bytes.NewReader(buf.Bytes()), dest, nil)
+	checkErr(t, err, "extracting")
+
+	linkTarget, err := os.Readlink(filepath.Join(dest, "link"))
+	checkErr(t, err, "reading symlink")
+	if linkTarget != "target.txt" {
+		t.Errorf("expected link target 'target.txt' but got '%s'", linkTarget)
+	}
+}
+
+func TestSafeName(t *testing.T) {
+	for i, tc := range []struct {
+		input    string
+		sanitize bool
+		expect   string
+		unsafe   bool
+	}{
+		{input: "a/b/c", expect: "a/b/c"},
+		{input: "./a/b/", expect: "a/b"},
+		{input: "./", expect: "."},
+		{input: "a/./b", expect: "a/b"},
+		{input: "/etc/passwd", unsafe: true},
+		{input: "../x", unsafe: true},
+		{input: "a/../../x", unsafe: true},
+		{input: "a/../b", unsafe: true},
+		{input: `..\x`, unsafe: true},
+		{input: `a\b`, unsafe: true},
+		{input: "C:/Windows/x", unsafe: true},
+		{input: `C:\Windows\x`, unsafe: true},
+		{input: "//server/share/x", unsafe: true},
+		{input: "/etc/passwd", sanitize: true, expect: "etc/passwd"},
+		{input: "../../etc/passwd", sanitize: true, expect: "etc/passwd"},
+		{input: "a/../../x", sanitize: true, expect: "x"},
+		{input: `..\..\x`, sanitize: true, expect: "x"},
+		{input: `C:\Windows\x`, sanitize: true, expect: "Windows/x"},
+		{input: "//server/share/x", sanitize: true, expect: "server/share/x"},
+		{input: "..", sanitize: true, expect: "."},
+	} {
+		actual, reason := safeName(tc.input, tc.sanitize)
+		if tc.unsafe {
+			if reason == "" {
+				t.Errorf("Test %d (input=%s): expected unsafe, but got '%s'", i, tc.input, actual)
+			}
+			continue
+		}
+		if reason != "" {
+			t.Errorf("Test %d (input=%s sanitize=%t): unexpectedly unsafe: %s", i, tc.input, tc.sanitize, reason)
+			continue
+		}
+		if actual != tc.expect {
+			t.Errorf("Test %d (input=%s sanitize=%t): expected '%s' but got '%s'", i, tc.input, tc.sanitize, tc.expect, actual)
+		}
+	}
+}
+
+func TestExtractToDiskUnsafe(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+
+	outside := t.TempDir()
+	archive := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "ok.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "ok"},
+		{hdr: tar.Header{Name: "../escape.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "escaped"},
+		{hdr: tar.Header{Name: "evil", Typeflag: tar.TypeSymlink, Linkname: outside}},
+		{hdr: tar.Header{Name: "evil/pwned.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "pwned"},
+		{hdr: tar.Header{Name: "evil/", Typeflag: tar.TypeDir, Mode: 0777}},
+		{hdr: tar.Header{Name: "hard", Typeflag: tar.TypeLink, Linkname: "evil/secret"}},
+	})
+
+	// aborts on the first unsafe entry by default
+	dest := t.TempDir()
+	err := ExtractToDisk(context.Background(), Tar{}, bytes.NewReader(archive), dest, nil)
+	var unsafeErr *UnsafePathError
+	if !errors.As(err, &unsafeErr) {
+		t.Fatalf("expected UnsafePathError, got: %v", err)
+	}
+	if unsafeErr.NameInArchive != "../escape.txt" {
+		t.Errorf("expected unsafe entry '../escape.txt' but got '%s'", unsafeErr.NameInArchive)
+	}
+
+	// skips and reports unsafe entries if configured
+	dest = t.TempDir()
+	var skipped []string
+	err = ExtractToDisk(context.Background(), Tar{}, bytes.NewReader(archive), dest, &ToDiskOptions{
+		OnUnsafeEntry: func(err *UnsafePathError) error {
+			skipped = append(skipped, err.NameInArchive)
+			return nil
+		},
+	})
+	checkErr(t, err, "extracting with skipping")
+	expectSkipped := []string{"../escape.txt", "evil/pwned.txt", "evil/", "hard"}
+	if !reflect.DeepEqual(skipped, expectSkipped) {
+		t.Errorf("expected skipped entries %v but got %v", expectSkipped, skipped)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "ok.txt")); err != nil {
+		t.Errorf("expected safe entry to be extracted: %v", err)
+	}
+	entries, err := os.ReadDir(outside)
+	checkErr(t, err, "reading outside directory")
+	if len(entries) > 0 {
+		t.Errorf("expected nothing written outside the destination, but found %d entries", len(entries))
+	}
+
+	// sanitizing rewrites names to stay inside
+	dest = t.TempDir()
+	err = ExtractToDisk(context.Background(), Tar{}, bytes.NewReader(archive), dest, &ToDiskOptions{
+		SanitizeNames: true,
+		OnUnsafeEntry: func(*UnsafePathError) error { return nil },
+	})
+	checkErr(t, err, "extracting with sanitizing")
+	if _, err := os.Stat(filepath.Join(dest, "escape.txt")); err != nil {
+		t.Errorf("expected sanitized entry to be extracted inside destination: %v", err)
+	}
+}
+
+func TestExtractToDiskPathsInArchive(t *testing.T) {
+	archive := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "./a/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "./a/1.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "1"},
+		{hdr: tar.Header{Name: "./b/2.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "2"},
+		{hdr: tar.Header{Name: "./c.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "c"},
+	})
+
+	dest := t.TempDir()
+	err := ExtractToDisk(context.Background(), Tar{}, bytes.NewReader(archive), dest, &ToDiskOptions{
+		PathsInArchive: []string{"a/", "./c.txt"},
+	})
+	checkErr(t, err, "extracting")
+
+	for name, expect := range map[string]bool{
+		"a/1.txt": true,
+		"b/2.txt": false,
+		"c.txt":   true,
+	} {
+		_, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name)))
+		if exists := err == nil; exists != expect {
+			t.Errorf("%s: expected extracted=%t but got %t", name, expect, exists)
+		}
+	}
+}
@@ -171,9 +171,8 @@ func readAtMost(stream io.Reader, n int) ([]byte, error) {
 // format (e.g. ".tar.gz") and provides both functionalities in a single
 // type. It ensures that archival functions are wrapped by compressors and
 // decompressors. However, compressed archives have some limitations; for
-// example, files cannot be inserted/appended because of complexities with
-// modifying existing compression state (perhaps this could be overcome,
-// but I'm not about to try it).
+// example, files can only be inserted into compressed tar archives, and
+// only with compression formats whose streams can be concatenated.
 //
 // The embedded Archival and Extraction values are used for writing and
 // reading, respectively. Compression is optional and is only needed if the
@@ -290,6 +289,32 @@ func (ar Archive) Extract(ctx context.Context, sourceArchive io.Reader, handleFi
 	return ar.Extraction.Extract(ctx, sourceArchive, handleFile)
 }
 
+// Insert inserts files into the archive, implementing the Inserter
+// interface if the archival format does. Files can also be inserted into
+// tar archives compressed with Gz, Zstd, Xz, Bz2, or Lz4, since streams
+// in those formats can be concatenated: the end of the archive is
+// replaced by new compressed members (or frames) containing the new
+// files, without recompressing the rest of the archive. This requires
+// that the archive have a Truncate method, as *os.File does.
+func (ar Archive) Insert(ctx context.Context, into io.ReadWriteSeeker, files []FileInfo) error {
+	if ar.Compression == nil {
+		inserter, ok := ar.Archival.(Inserter)
+		if !ok {
+			return fmt.Errorf("%T archive does not support inserting", ar.Archival)
+		}
+		return inserter.Insert(ctx, into, files)
+	}
+	t, ok := ar.Archival.(Tar)
+	if !ok {
+		return fmt.Errorf("inserting into compressed %T archives is not supported", ar.Archival)
+	}
+	comp, ok := ar.Compression.(concatenator)
+	if !ok {
+		return fmt.Errorf("inserting into %T-compressed archives is not supported", ar.Compression)
+	}
+	return t.insertCompressed(ctx, comp, into, files)
+}
+
 // MatchResult returns true if the format was matched either
 // by name, stream, or both. Name usually refers to matching
 // by file extension, and stream usually refers to reading
@@ -426,4 +451,5 @@ var (
 	_ Archiver      = (*Archive)(nil)
 	_ ArchiverAsync = (*Archive)(nil)
 	_ Extractor     = (*Archive)(nil)
+	_ Inserter      = (*Archive)(nil)
 )
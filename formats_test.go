@@ -6,10 +6,12 @@ import (
 	"errors"
 	"io"
 	"io/fs"
+	"maps"
 	"math/rand"
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 	"time"
 )
 
@@ -105,6 +107,93 @@ func TestCompression(t *testing.T) {
 	}
 }
 
+func TestArchiveInsertCompressed(t *testing.T) {
+	ctx := context.Background()
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	random := make([]byte, 100*1024) // spans blocks of the compressors
+	rand.New(rand.NewSource(1)).Read(random)
+	batches := []fstest.MapFS{
+		{
+			"a.txt":     {Data: []byte("a"), Mode: 0644, ModTime: modTime},
+			"dir":       {Mode: fs.ModeDir | 0755, ModTime: modTime},
+			"dir/b.bin": {Data: random, Mode: 0644, ModTime: modTime},
+		},
+		{
+			"c.txt": {Data: bytes.Repeat([]byte("c"), 513), Mode: 0644, ModTime: modTime},
+		},
+		{
+			"dir/d.txt": {Data: []byte("d"), Mode: 0600, ModTime: modTime},
+		},
+	}
+
+	for _, comp := range []Compression{Gz{}, Gz{Multithreaded: true}, Zstd{}, Xz{}, Bz2{}, Lz4{}} {
+		format := Archive{Compression: comp, Archival: Tar{}, Extraction: Tar{}}
+		t.Run(comp.Extension(), func(t *testing.T) {
+			f := createArchive(t, format, batches[0])
+			want := archiveContents(t, format, f)
+
+			var trailer bytes.Buffer
+			wc, err := comp.OpenWriter(&trailer)
+			checkErr(t, err, "opening writer")
+			_, err = wc.Write(make([]byte, 1024))
+			checkErr(t, err, "writing trailer")
+			checkErr(t, wc.Close(), "closing writer")
+
+			var before []byte
+			for i, batch := range batches[1:] {
+				err := format.Insert(ctx, f, filesFromMapFS(t, batch))
+				checkErr(t, err, "inserting batch %d", i+1)
+				for name, file := range batch {
+					want[name] = string(file.Data)
+				}
+				got := archiveContents(t, format, f)
+				if !maps.Equal(got, want) {
+					t.Errorf("after inserting batch %d: expected %d files but got %d, or contents differ", i+1, len(want), len(got))
+				}
+
+				// only the trailer should have been replaced by the second insert
+				data, err := os.ReadFile(f.Name())
+				checkErr(t, err, "reading archive")
+				if before != nil && !bytes.HasPrefix(data, before[:len(before)-trailer.Len()]) {
+					t.Errorf("after inserting batch %d: start of archive was rewritten", i+1)
+				}
+				before = data
+
+				// the result must also be a valid stream for other decompressors
+				_, err = f.Seek(0, io.SeekStart)
+				checkErr(t, err, "seeking")
+				found, _, err := Identify(ctx, "", f)
+				checkErr(t, err, "identifying")
+				if found.Extension() != format.Extension() {
+					t.Errorf("expected format %s but got %s", format.Extension(), found.Extension())
+				}
+			}
+		})
+	}
+
+	t.Run("untruncatable", func(t *testing.T) {
+		format := Archive{Compression: Gz{}, Archival: Tar{}, Extraction: Tar{}}
+		f := createArchive(t, format, batches[0])
+		want := archiveContents(t, format, f)
+		err := format.Insert(ctx, struct{ io.ReadWriteSeeker }{f}, filesFromMapFS(t, batches[1]))
+		if err == nil {
+			t.Error("expected an error inserting into an archive that cannot be truncated")
+		}
+		if got := archiveContents(t, format, f); !maps.Equal(got, want) {
+			t.Errorf("expected archive to be unchanged, but it has %d files, or contents differ", len(got))
+		}
+	})
+
+	t.Run("unsupported compression", func(t *testing.T) {
+		format := Archive{Compression: Brotli{}, Archival: Tar{}, Extraction: Tar{}}
+		f := createArchive(t, format, batches[0])
+		err := format.Insert(ctx, f, filesFromMapFS(t, batches[1]))
+		if err == nil {
+			t.Error("expected an error inserting into a brotli-compressed archive")
+		}
+	})
+}
+
 func checkErr(t *testing.T, err error, msgFmt string, args ...any) {
 	t.Helper()
 	if err == nil {
@@ -202,6 +291,33 @@ func TestIdentifyCanAssessSmallOrNoContent(t *testing.T) {
 	}
 }
 
+func TestIdentifyByNameWithoutStream(t *testing.T) {
+	// every format must be able to match by name alone, since a
+	// format is chosen by name before an archive is created
+	for _, filename := range []string{"a.br", "a.tar.br", "a.tar.gz", "a.zip", "a.7z", "a.iso"} {
+		t.Run(filename, func(t *testing.T) {
+			format, stream, err := Identify(context.Background(), filename, nil)
+			checkErr(t, err, "identifying %s", filename)
+			if stream != nil {
+				t.Errorf("expected no stream to be returned but got %#v", stream)
+			}
+			if ext := format.Extension(); !strings.HasSuffix(filename, ext) {
+				t.Errorf("expected format with extension of %s but got %s", filename, ext)
+			}
+		})
+	}
+}
+
+func TestBrotliMatchWithoutStream(t *testing.T) {
+	// Brotli has no header, so it matches a stream by decoding it,
+	// which must not be attempted when there is no stream
+	format, _, err := Identify(context.Background(), "x.br", nil)
+	checkErr(t, err, "identifying by name")
+	if _, ok := format.(Brotli); !ok {
+		t.Errorf("expected Brotli but got %T", format)
+	}
+}
+
 func compress(
 	t *testing.T, compName string, content []byte,
 	openwriter func(w io.Writer) (io.WriteCloser, error),
@@ -361,6 +477,27 @@ func TestIdentifyFindFormatByStreamContent(t *testing.T) {
 			compressorName:        ".gz",
 			wantFormatName:        ".tar.gz",
 		},
+		{
+			name:                  "should recognize cpio",
+			openCompressionWriter: newWriteNopCloser,
+			content:               archive(t, Cpio{}, tmpTxtFileName, tmpTxtFileInfo),
+			compressorName:        "",
+			wantFormatName:        ".cpio",
+		},
+		{
+			name:                  "should recognize cpio.gz",
+			openCompressionWriter: Gz{}.OpenWriter,
+			content:               archive(t, Cpio{}, tmpTxtFileName, tmpTxtFileInfo),
+			compressorName:        ".gz",
+			wantFormatName:        ".cpio.gz",
+		},
+		{
+			name:                  "should recognize ar",
+			openCompressionWriter: newWriteNopCloser,
+			content:               archive(t, Ar{}, tmpTxtFileName, tmpTxtFileInfo),
+			compressorName:        "",
+			wantFormatName:        ".a",
+		},
 		{
 			name:                  "should recognize zip",
 			openCompressionWriter: newWriteNopCloser,
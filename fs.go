@@ -333,8 +333,10 @@ func (f ArchiveFS) Open(name string) (fs.File, error) {
 		if err != nil {
 			return nil, err
 		}
-		if err := archiveFile.Close(); err != nil {
-			return nil, err
+		if archiveFile != nil {
+			if err := archiveFile.Close(); err != nil {
+				return nil, err
+			}
 		}
 		return &dirFile{
 			info:    dirFileInfo{archiveInfo},
@@ -349,8 +351,29 @@ func (f ArchiveFS) Open(name string) (fs.File, error) {
 		inputStream = io.NewSectionReader(f.Stream, 0, f.Stream.Size())
 	}
 
+	// if limits are to be enforced, unwrap the underlying format so that
+	// we can bypass its decompressor (see below), and enforce them here
+	format := f.Format
+	ctx := f.context()
+	var lim *limiter
+	if le, ok := format.(LimitedExtractor); ok {
+		format = le.Extractor
+		ctx, lim, err = newLimiter(ctx, le.Limits)
+		if err != nil {
+			return nil, err
+		}
+		inputStream = lim.countInput(inputStream)
+	}
+
+	// an Archive embeds its Compression, so it is always a Decompressor
+	// even when the archive is not compressed; only decompress if it is
+	decomp, ok := format.(Decompressor)
+	if ar, isArchive := format.(Archive); isArchive {
+		decomp, ok = ar.Compression, ar.Compression != nil
+	}
+
 	var decompressor io.ReadCloser
-	if decomp, ok := f.Format.(Decompressor); ok {
+	if ok {
 		decompressor, err = decomp.OpenReader(inputStream)
 		if err != nil {
 			return nil, err
@@ -361,7 +384,7 @@ func (f ArchiveFS) Open(name string) (fs.File, error) {
 	// prepare the handler that we'll need if we have to iterate the
 	// archive to find the file being requested
 	var fsFile fs.File
-	handler := func(ctx context.Context, file FileInfo) error {
+	var handler FileHandler = func(ctx context.Context, file FileInfo) error {
 		if err := ctx.Err(); err != nil {
 			return err
 		}
@@ -407,17 +430,21 @@ func (f ArchiveFS) Open(name string) (fs.File, error) {
 		return fs.SkipAll
 	}
 
+	if lim != nil {
+		handler = lim.handler(handler)
+	}
+
 	// when we start the walk, we pass in a nil list of files to extract, since
 	// files may have a "." component in them, and the underlying format doesn't
 	// know about our file system semantics, so we need to filter ourselves (it's
 	// not significantly less efficient).
-	if ar, ok := f.Format.(Archive); ok {
+	if ar, ok := format.(Archive); ok {
 		// bypass the CompressedArchive format's opening of the decompressor, since
 		// we already did it because we need to keep it open after returning.
 		// "I BYPASSED THE COMPRESSOR!" -Rey
-		err = ar.Extraction.Extract(f.context(), inputStream, handler)
+		err = ar.Extraction.Extract(ctx, inputStream, handler)
 	} else {
-		err = f.Format.Extract(f.context(), inputStream, handler)
+		err = format.Extract(ctx, inputStream, handler)
 	}
 	if err != nil {
 		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("extract: %w", err)}
@@ -629,9 +656,9 @@ func (f *ArchiveFS) Sub(dir string) (fs.FS, error) {
 	// the reason we don't append to the Path field directly
 	// is because the input might be a stream rather than a
 	// path on disk, and the Prefix field is applied on both
-	result := f
-	result.Prefix = dir
-	return result, nil
+	result := *f
+	result.Prefix = path.Join(f.Prefix, dir)
+	return &result, nil
 }
 
 // TopDirOpen is a special Open() function that may be useful if
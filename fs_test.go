@@ -1,6 +1,7 @@
 package archiver
 
 import (
+	"archive/tar"
 	"bytes"
 	_ "embed"
 	"fmt"
@@ -211,3 +212,68 @@ func TestArchiveFS_ReadDir(t *testing.T) {
 		})
 	}
 }
+
+func TestArchiveFS_Sub(t *testing.T) {
+	archive := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "a/b/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{hdr: tar.Header{Name: "a/b/c.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "c"},
+	})
+	fsys := &ArchiveFS{
+		Stream: io.NewSectionReader(bytes.NewReader(archive), 0, int64(len(archive))),
+		Format: Tar{},
+	}
+	sub, err := fsys.Sub("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nested, err := sub.(fs.SubFS).Sub("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each call returns a new file system, rooted in the one it was called on
+	if fsys.Prefix != "" {
+		t.Errorf("expected no prefix on the original file system, but got %q", fsys.Prefix)
+	}
+	if prefix := sub.(*ArchiveFS).Prefix; prefix != "a" {
+		t.Errorf("expected prefix %q on the parent file system, but got %q", "a", prefix)
+	}
+	entries, err := fs.ReadDir(nested, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "c.txt" {
+		t.Errorf("expected only c.txt in the nested file system, but got %v", entries)
+	}
+}
+
+func TestArchiveFS_OpenArchive(t *testing.T) {
+	entries := []tarEntry{
+		{hdr: tar.Header{Name: "etc/app.conf", Typeflag: tar.TypeReg, Mode: 0644}, body: "debug = true\n"},
+	}
+	plain := buildTar(t, entries)
+	compressed := compressedTestTar(t, entries)
+
+	for _, tc := range []struct {
+		name    string
+		format  Archive
+		archive []byte
+	}{
+		{name: "tar", format: Archive{Extraction: Tar{}}, archive: plain},
+		{name: "tar.gz", format: Archive{Compression: Gz{}, Extraction: Tar{}}, archive: compressed},
+	} {
+		fsys := ArchiveFS{
+			Stream: io.NewSectionReader(bytes.NewReader(tc.archive), 0, int64(len(tc.archive))),
+			Format: tc.format,
+		}
+		b, err := fs.ReadFile(fsys, "etc/app.conf")
+		if err != nil {
+			t.Errorf("%s: reading file: %v", tc.name, err)
+			continue
+		}
+		if string(b) != "debug = true\n" {
+			t.Errorf("%s: expected file contents 'debug = true\\n' but got '%s'", tc.name, b)
+		}
+	}
+}
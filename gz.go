@@ -1,8 +1,10 @@
 package archiver
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"strings"
 
@@ -85,5 +87,29 @@ func (gz Gz) OpenReader(r io.Reader) (io.ReadCloser, error) {
 	return gzR, err
 }
 
+// members finds the gzip members in ra by decompressing each one, since
+// the length of a member is not recorded anywhere in it.
+func (gz Gz) members(ra io.ReaderAt, size int64) ([]int64, error) {
+	if gz.DisableMultistream {
+		return nil, fmt.Errorf("multistream must be enabled to read concatenated members")
+	}
+	var offsets []int64
+	for offset := int64(0); offset < size; {
+		offsets = append(offsets, offset)
+		cr := &readCounter{r: io.NewSectionReader(ra, offset, size-offset)}
+		br := bufio.NewReader(cr) // read by the decompressor directly, so none is read past the member
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("member at offset %d: %w", offset, err)
+		}
+		zr.Multistream(false)
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			return nil, fmt.Errorf("member at offset %d: %w", offset, err)
+		}
+		offset += cr.n - int64(br.Buffered())
+	}
+	return offsets, nil
+}
+
 // magic number at the beginning of gzip files
 var gzHeader = []byte{0x1f, 0x8b}
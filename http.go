@@ -0,0 +1,179 @@
+package archiver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileServer is an http.Handler that serves the contents of a file system,
+// such as an ArchiveFS, so that archives can be browsed and downloaded
+// from without extracting them. Directories are served as HTML listings.
+//
+// Unlike http.FileServer, files do not need to be seekable, which files
+// within archives usually are not. If a file is an io.Seeker, it is served
+// with http.ServeContent, which supports range and conditional requests;
+// otherwise, the whole file is streamed and only conditional requests by
+// modification time are supported. The Content-Type is determined by file
+// extension or, failing that, by sniffing the first bytes of the file.
+//
+// The file system must be safe for concurrent use. An ArchiveFS is only
+// safe for concurrent use after it has been indexed by calling ReadDir.
+type FileServer struct {
+	FS fs.FS
+}
+
+func (s FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := s.FS.Open(name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	// directories are requested with a trailing slash and
+	// files without, so that relative links work properly
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			redirectTo(w, r, path.Base(r.URL.Path)+"/")
+			return
+		}
+		s.serveDir(w, r, name)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		redirectTo(w, r, "../"+path.Base(r.URL.Path))
+		return
+	}
+
+	if rs, ok := f.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, info.Name(), info.ModTime(), rs)
+		return
+	}
+	serveStream(w, r, info, f)
+}
+
+// serveStream serves a file that cannot seek, so range
+// requests are not supported and the file is sent in full.
+func serveStream(w http.ResponseWriter, r *http.Request, info fs.FileInfo, f io.Reader) {
+	modTime := info.ModTime()
+	if !modTime.IsZero() && modTime.Unix() != 0 {
+		if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil &&
+			r.Header.Get("If-None-Match") == "" &&
+			!modTime.Truncate(time.Second).After(ims) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+
+	ctype := mime.TypeByExtension(path.Ext(info.Name()))
+	if ctype == "" {
+		// sniff the content type, and then put back what we read
+		buf := make([]byte, 512)
+		n, err := io.ReadFull(f, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			httpError(w, err)
+			return
+		}
+		ctype = http.DetectContentType(buf[:n])
+		f = io.MultiReader(bytes.NewReader(buf[:n]), f)
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Accept-Ranges", "none")
+	if info.Mode().IsRegular() {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, f)
+	}
+}
+
+// serveDir serves an HTML listing of the named directory.
+func (s FileServer) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+	entries, err := fs.ReadDir(s.FS, name)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	title := html.EscapeString("/" + strings.TrimPrefix(name, "."))
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>%s</title></head>\n<body>\n<h1>%s</h1>\n<table>\n", title, title)
+	if name != "." {
+		fmt.Fprintf(w, "<tr><td><a href=\"../\">../</a></td><td></td><td></td></tr>\n")
+	}
+	for _, entry := range entries {
+		entryName := entry.Name()
+		var size, modTime string
+		if info, err := entry.Info(); err == nil {
+			if info.Mode().IsRegular() {
+				size = strconv.FormatInt(info.Size(), 10)
+			}
+			if !info.ModTime().IsZero() {
+				modTime = info.ModTime().UTC().Format(time.DateTime)
+			}
+		}
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(w, "<tr><td><a href=\"%s\">%s</a></td><td>%s</td><td>%s</td></tr>\n",
+			html.EscapeString(link.String()), html.EscapeString(entryName), size, modTime)
+	}
+	fmt.Fprintf(w, "</table>\n</body>\n</html>\n")
+}
+
+// redirectTo redirects to the relative URL target, preserving the query string.
+func redirectTo(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// httpError writes an HTTP error response for err.
+func httpError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
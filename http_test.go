@@ -0,0 +1,122 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFileServer(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	archive := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "logs/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modTime}},
+		{hdr: tar.Header{Name: "logs/app.log", Typeflag: tar.TypeReg, Mode: 0644, ModTime: modTime}, body: "started\nstopped\n"},
+		{hdr: tar.Header{Name: "config.json", Typeflag: tar.TypeReg, Mode: 0644, ModTime: modTime}, body: `{"debug": true}`},
+		{hdr: tar.Header{Name: "noext", Typeflag: tar.TypeReg, Mode: 0644, ModTime: modTime}, body: "<html><body>hi</body></html>"},
+	})
+	afs := &ArchiveFS{
+		Stream: io.NewSectionReader(bytes.NewReader(archive), 0, int64(len(archive))),
+		Format: Tar{},
+	}
+	if _, err := afs.ReadDir("."); err != nil {
+		t.Fatalf("indexing archive: %v", err)
+	}
+	srv := httptest.NewServer(FileServer{FS: afs})
+	defer srv.Close()
+
+	// don't follow redirects, so that we can check them
+	client := srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	for _, tc := range []struct {
+		path         string
+		header       http.Header
+		status       int
+		contentType  string
+		lastModified bool
+		body         string // substring
+		location     string
+	}{
+		{path: "/", status: http.StatusOK, contentType: "text/html; charset=utf-8", body: `<a href="logs/">logs/</a>`},
+		{path: "/logs/", status: http.StatusOK, contentType: "text/html; charset=utf-8", body: `<a href="app.log">app.log</a>`},
+		{path: "/logs", status: http.StatusMovedPermanently, location: "logs/"},
+		{path: "/logs/app.log", status: http.StatusOK, lastModified: true, body: "started\nstopped\n"},
+		{path: "/config.json", status: http.StatusOK, contentType: "application/json", lastModified: true, body: `{"debug": true}`},
+		{path: "/noext", status: http.StatusOK, contentType: "text/html; charset=utf-8", lastModified: true, body: "<html><body>hi</body></html>"},
+		{path: "/config.json/", status: http.StatusMovedPermanently, location: "../config.json"},
+		{path: "/missing.txt", status: http.StatusNotFound},
+		{
+			path:   "/config.json",
+			header: http.Header{"If-Modified-Since": {modTime.Add(time.Minute).Format(http.TimeFormat)}},
+			status: http.StatusNotModified,
+		},
+		{
+			// range requests are not supported for files that can't seek
+			path:   "/config.json",
+			header: http.Header{"Range": {"bytes=0-3"}},
+			status: http.StatusOK,
+			body:   `{"debug": true}`,
+		},
+	} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+tc.path, nil)
+		checkErr(t, err, "making request")
+		for k, v := range tc.header {
+			req.Header[k] = v
+		}
+		resp, err := client.Do(req)
+		checkErr(t, err, "doing request")
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		checkErr(t, err, "reading response")
+
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: expected status %d but got %d", tc.path, tc.status, resp.StatusCode)
+		}
+		if tc.contentType != "" && resp.Header.Get("Content-Type") != tc.contentType {
+			t.Errorf("%s: expected Content-Type '%s' but got '%s'", tc.path, tc.contentType, resp.Header.Get("Content-Type"))
+		}
+		if tc.lastModified && resp.Header.Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+			t.Errorf("%s: expected Last-Modified '%s' but got '%s'", tc.path, modTime.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+		}
+		if !strings.Contains(string(body), tc.body) {
+			t.Errorf("%s: expected body to contain '%s' but got '%s'", tc.path, tc.body, body)
+		}
+		if tc.location != "" && resp.Header.Get("Location") != tc.location {
+			t.Errorf("%s: expected redirect to '%s' but got '%s'", tc.path, tc.location, resp.Header.Get("Location"))
+		}
+	}
+}
+
+func TestFileServerRange(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"data.txt": {Data: []byte("0123456789"), Mode: 0644, ModTime: modTime},
+	}
+	srv := httptest.NewServer(FileServer{FS: fsys})
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/data.txt", nil)
+	checkErr(t, err, "making request")
+	req.Header.Set("Range", "bytes=2-5")
+	resp, err := srv.Client().Do(req)
+	checkErr(t, err, "doing request")
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	checkErr(t, err, "reading response")
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("expected status %d but got %d", http.StatusPartialContent, resp.StatusCode)
+	}
+	if string(body) != "2345" {
+		t.Errorf("expected body '2345' but got '%s'", body)
+	}
+	if resp.Header.Get("Last-Modified") != modTime.Format(http.TimeFormat) {
+		t.Errorf("expected Last-Modified '%s' but got '%s'", modTime.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+	}
+}
@@ -109,3 +109,31 @@ type Inserter interface {
 	// Context cancellation must be honored.
 	Insert(ctx context.Context, archive io.ReadWriteSeeker, files []FileInfo) error
 }
+
+// Deleter can delete files from an existing archive.
+// EXPERIMENTAL: This API is subject to change.
+type Deleter interface {
+	// Delete deletes the named files from archive and compacts it to
+	// reclaim their space. Naming a directory deletes everything in it.
+	// It is an error if a name does not match any file in the archive.
+	//
+	// Context cancellation must be honored, but only until the archive
+	// is first modified, so that it is not left half-compacted.
+	Delete(ctx context.Context, archive io.ReadWriteSeeker, names []string) error
+}
+
+// Renamer can rename files in an existing archive.
+// EXPERIMENTAL: This API is subject to change.
+type Renamer interface {
+	// Rename renames the files in archive according to renames, which
+	// maps names to new names, without recompressing their contents.
+	// Renaming a directory moves everything in it, and if a directory
+	// is moved to the root of the archive (with a new name of "" or "."),
+	// its entry is removed and its contents take its place. It is an error
+	// if a name does not match any file in the archive, or if a file
+	// would have the same name as another.
+	//
+	// Context cancellation must be honored, but only until the archive
+	// is first modified, so that it is not left half-rewritten.
+	Rename(ctx context.Context, archive io.ReadWriteSeeker, renames map[string]string) error
+}
@@ -0,0 +1,592 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+func init() {
+	RegisterFormat(Iso9660{})
+}
+
+// Iso9660 can read ISO 9660 images (.iso files) of CDs and DVDs. Long
+// and Unicode file names are read from the Joliet extension, and with
+// the Rock Ridge extension, so are POSIX file modes, owners, symbolic
+// links, and modification times; if an image has both, Rock Ridge is
+// used, as Unix systems do when mounting it.
+type Iso9660 struct{}
+
+func (Iso9660) Extension() string { return ".iso" }
+
+func (iso Iso9660) Match(_ context.Context, filename string, stream io.Reader) (MatchResult, error) {
+	var mr MatchResult
+
+	// match filename
+	if filepath.Ext(strings.ToLower(filename)) == iso.Extension() {
+		mr.ByName = true
+	}
+
+	// match file header, which is the identifier of the first
+	// volume descriptor, after the system area of the image
+	buf, err := readAtMost(stream, isoMagicOffset+len(isoMagic))
+	if err != nil {
+		return mr, err
+	}
+	mr.ByStream = len(buf) == isoMagicOffset+len(isoMagic) && bytes.Equal(buf[isoMagicOffset:], isoMagic)
+
+	return mr, nil
+}
+
+// Extract extracts files from the ISO 9660 image. Like Zip, sourceArchive
+// must be an io.ReaderAt and io.Seeker, since the files are found by their
+// locations in the image; if it is not, an error is returned.
+func (iso Iso9660) Extract(ctx context.Context, sourceArchive io.Reader, handleFile FileHandler) error {
+	sra, ok := sourceArchive.(seekReaderAt)
+	if !ok {
+		return fmt.Errorf("input type must be an io.ReaderAt and io.Seeker because of ISO 9660 format constraints")
+	}
+
+	ir, root, err := newIsoReader(sra)
+	if err != nil {
+		return err
+	}
+
+	// directories can be found through more than one record, and a
+	// broken (or malicious) image could even have them contain
+	// themselves, so each one is only walked once
+	walked := map[uint32]bool{root.extents[0].location: true}
+
+	var walk func(dir string, dirHdr *Iso9660Header) error
+	walk = func(dir string, dirHdr *Iso9660Header) error {
+		hdrs, err := ir.readDir(dirHdr)
+		if err != nil {
+			return fmt.Errorf("reading directory %s: %w", dir, err)
+		}
+
+		for _, hdr := range hdrs {
+			if err := ctx.Err(); err != nil {
+				return err // honor context cancellation
+			}
+
+			hdr.Name = path.Join(dir, hdr.Name)
+			info := isoFileInfo{hdr}
+
+			// the directory that Rock Ridge moves deep directories
+			// to is empty without them, and isn't part of the image
+			if ir.rockRidge && dir == "" && info.IsDir() && strings.EqualFold(hdr.Name, "rr_moved") {
+				if moved, err := ir.readDir(hdr); err == nil && len(moved) == 0 {
+					continue
+				}
+			}
+
+			file := FileInfo{
+				FileInfo:      info,
+				Header:        hdr,
+				NameInArchive: hdr.Name,
+				LinkTarget:    hdr.Linkname,
+				Open: func() (fs.File, error) {
+					return fileInArchive{io.NopCloser(ir.contents(hdr)), info}, nil
+				},
+			}
+			if info.IsDir() {
+				file.NameInArchive += "/"
+			}
+
+			err := handleFile(ctx, file)
+			if errors.Is(err, fs.SkipAll) {
+				return err
+			} else if errors.Is(err, fs.SkipDir) {
+				// if a directory, skip this path; if a file, skip the folder path
+				if info.IsDir() {
+					continue
+				}
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("handling file: %s: %w", hdr.Name, err)
+			}
+
+			if info.IsDir() && !walked[hdr.extents[0].location] {
+				walked[hdr.extents[0].location] = true
+				if err := walk(hdr.Name, hdr); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	err = walk("", root)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// Iso9660Header is the header of a file in an ISO 9660 image,
+// from its directory record and Rock Ridge entries. It is the
+// Header of files extracted from ISO 9660 images.
+type Iso9660Header struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	Flags   byte // of the directory record
+
+	// These are only set if the image has Rock Ridge entries.
+	Mode     uint32 // Unix file mode, including the file type
+	Uid      int
+	Gid      int
+	Nlink    int
+	Linkname string // the target of a symbolic link
+
+	// the data of the file, in one or more parts
+	extents []isoExtent
+
+	// directories deeper than ISO 9660 allows are moved elsewhere by
+	// Rock Ridge, and linked to from where they belong
+	relocated bool
+	childLink uint32
+}
+
+// isoExtent is a contiguous part of the data of a file.
+type isoExtent struct {
+	location uint32 // in logical blocks
+	length   uint32
+}
+
+// isoContinuation is where the system use area of a
+// directory record continues, from a Rock Ridge CE entry.
+type isoContinuation struct {
+	location uint32 // in logical blocks
+	offset   uint32
+	length   uint32
+}
+
+// isoFileInfo satisfies the fs.FileInfo interface for ISO 9660 entries.
+type isoFileInfo struct {
+	hdr *Iso9660Header
+}
+
+func (ifi isoFileInfo) Name() string       { return path.Base(ifi.hdr.Name) }
+func (ifi isoFileInfo) Size() int64        { return ifi.hdr.Size }
+func (ifi isoFileInfo) ModTime() time.Time { return ifi.hdr.ModTime }
+func (ifi isoFileInfo) IsDir() bool        { return ifi.hdr.Flags&isoFlagDirectory != 0 }
+func (ifi isoFileInfo) Sys() any           { return ifi.hdr }
+
+func (ifi isoFileInfo) Mode() fs.FileMode {
+	if ifi.hdr.Mode != 0 {
+		return fileModeFromUnix(ifi.hdr.Mode)
+	}
+	// without Rock Ridge, everything is read-only
+	if ifi.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// isoReader reads the directories of an ISO 9660 image.
+type isoReader struct {
+	r         io.ReaderAt
+	blockSize int64
+	joliet    bool // if names are read from the Joliet directories
+	rockRidge bool // if the system use areas have Rock Ridge entries
+	suspSkip  int  // bytes to skip at the start of system use areas
+}
+
+// newIsoReader reads the volume descriptors of the image, and
+// returns a reader for it with the root directory to read from.
+func newIsoReader(r io.ReaderAt) (*isoReader, *Iso9660Header, error) {
+	ir := &isoReader{r: r}
+
+	var primary, joliet []byte
+	for i := int64(0); i < isoMaxVolumeDescriptors; i++ {
+		desc := make([]byte, isoSectorSize)
+		if _, err := r.ReadAt(desc, isoSystemAreaSize+i*isoSectorSize); err != nil {
+			return nil, nil, fmt.Errorf("reading volume descriptor: %w", noEOF(err))
+		}
+		if !bytes.Equal(desc[1:6], isoMagic) {
+			return nil, nil, fmt.Errorf("invalid volume descriptor: identifier %q", desc[1:6])
+		}
+		if desc[0] == isoVolumeDescriptorTerminator {
+			break
+		}
+		switch desc[0] {
+		case isoVolumeDescriptorPrimary:
+			if primary == nil {
+				primary = desc
+			}
+		case isoVolumeDescriptorSupplementary:
+			// the escape sequence of UCS-2 at level 1, 2, or 3
+			escape := desc[88:120]
+			if joliet == nil && (bytes.Contains(escape, []byte("%/@")) ||
+				bytes.Contains(escape, []byte("%/C")) ||
+				bytes.Contains(escape, []byte("%/E"))) {
+				joliet = desc
+			}
+		}
+	}
+	if primary == nil {
+		return nil, nil, fmt.Errorf("no primary volume descriptor")
+	}
+
+	ir.blockSize = int64(binary.LittleEndian.Uint16(primary[128:130]))
+	if ir.blockSize < 512 || ir.blockSize > isoSectorSize || ir.blockSize&(ir.blockSize-1) != 0 {
+		return nil, nil, fmt.Errorf("invalid logical block size: %d", ir.blockSize)
+	}
+	root, err := ir.parseRecord(primary[156:190], false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading root directory record: %w", err)
+	}
+
+	// Rock Ridge is announced by an SP entry at the start of the
+	// system use area of the root directory's own (".") record
+	first := make([]byte, 255)
+	if _, err := r.ReadAt(first, int64(root.extents[0].location)*ir.blockSize); err != nil {
+		return nil, nil, fmt.Errorf("reading root directory: %w", noEOF(err))
+	}
+	if n := int(first[0]); n >= 34 && n-34 >= 7 {
+		sua := first[34:n]
+		if bytes.HasPrefix(sua, []byte("SP")) && sua[2] >= 7 && sua[4] == 0xBE && sua[5] == 0xEF {
+			ir.rockRidge = true
+			ir.suspSkip = int(sua[6])
+		}
+	}
+
+	if !ir.rockRidge && joliet != nil {
+		ir.joliet = true
+		root, err = ir.parseRecord(joliet[156:190], false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading Joliet root directory record: %w", err)
+		}
+	}
+
+	return ir, root, nil
+}
+
+// readDir returns the headers of the files in the directory,
+// without its own (".") and its parent's ("..") records.
+func (ir *isoReader) readDir(dir *Iso9660Header) ([]*Iso9660Header, error) {
+	if dir.Size > isoMaxDirSize {
+		return nil, fmt.Errorf("directory is too large: %d bytes", dir.Size)
+	}
+	data, err := io.ReadAll(ir.contents(dir))
+	if err != nil {
+		return nil, err
+	}
+
+	var hdrs []*Iso9660Header
+	var multiExtent *Iso9660Header // a file whose data continues in the next record
+	for i := 0; i < len(data); {
+		n := int(data[i])
+		if n == 0 {
+			// records don't cross sectors, so the rest of this one is padding
+			i = (i/isoSectorSize + 1) * isoSectorSize
+			continue
+		}
+		if i+n > len(data) {
+			return nil, fmt.Errorf("directory record at offset %d is %d bytes, past the end of the directory", i, n)
+		}
+		hdr, err := ir.parseRecord(data[i:i+n], true)
+		if err != nil {
+			return nil, fmt.Errorf("directory record at offset %d: %w", i, err)
+		}
+		i += n
+
+		switch {
+		case hdr == nil || hdr.relocated || hdr.Flags&isoFlagAssociated != 0:
+			// the directory itself and its parent, directories that
+			// are listed where they belong, and associated files
+			// (such as resource forks) aren't files of their own
+			continue
+		case multiExtent != nil:
+			multiExtent.extents = append(multiExtent.extents, hdr.extents...)
+			multiExtent.Size += hdr.Size
+			multiExtent.Flags = hdr.Flags
+		default:
+			hdrs = append(hdrs, hdr)
+			multiExtent = hdr
+		}
+		if multiExtent.Flags&isoFlagMultiExtent == 0 {
+			multiExtent = nil
+		}
+	}
+
+	// relocated directories are read from the location of their
+	// own records, which have their sizes
+	for _, hdr := range hdrs {
+		if hdr.childLink == 0 {
+			continue
+		}
+		first := make([]byte, 34)
+		if _, err := ir.r.ReadAt(first, int64(hdr.childLink)*ir.blockSize); err != nil {
+			return nil, fmt.Errorf("reading relocated directory %s: %w", hdr.Name, noEOF(err))
+		}
+		size := binary.LittleEndian.Uint32(first[10:14])
+		hdr.extents = []isoExtent{{location: hdr.childLink, length: size}}
+		hdr.Size = int64(size)
+		hdr.Flags |= isoFlagDirectory
+	}
+
+	return hdrs, nil
+}
+
+// parseRecord parses a directory record. If file is true, the name
+// and system use area of the record are read, and nil is returned
+// for the records of the directory itself and its parent.
+func (ir *isoReader) parseRecord(rec []byte, file bool) (*Iso9660Header, error) {
+	if len(rec) < 34 || int(rec[0]) > len(rec) || 33+int(rec[32]) > int(rec[0]) {
+		return nil, fmt.Errorf("invalid directory record")
+	}
+	rec = rec[:rec[0]]
+	hdr := &Iso9660Header{
+		Flags:   rec[25],
+		ModTime: isoRecordingTime(rec[18:25]),
+	}
+	ext := isoExtent{
+		location: binary.LittleEndian.Uint32(rec[2:6]),
+		length:   binary.LittleEndian.Uint32(rec[10:14]),
+	}
+	hdr.extents, hdr.Size = []isoExtent{ext}, int64(ext.length)
+	if !file {
+		return hdr, nil
+	}
+
+	id := rec[33 : 33+rec[32]]
+	if len(id) == 1 && (id[0] == 0 || id[0] == 1) {
+		return nil, nil
+	}
+	if ir.joliet {
+		u := make([]uint16, len(id)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(id[2*i:])
+		}
+		hdr.Name = string(utf16.Decode(u))
+	} else {
+		hdr.Name = string(id)
+	}
+	// file names have a version number, and a dot if they don't have an extension
+	if hdr.Flags&isoFlagDirectory == 0 {
+		if i := strings.LastIndexByte(hdr.Name, ';'); i >= 0 {
+			hdr.Name = hdr.Name[:i]
+		}
+		hdr.Name = strings.TrimSuffix(hdr.Name, ".")
+	}
+
+	if ir.rockRidge {
+		// the system use area follows the name, which is padded to an
+		// even length; a broken record may not even have the padding
+		start := 33 + len(id) + (len(id)+1)%2 + ir.suspSkip
+		if start >= len(rec) {
+			return hdr, nil
+		}
+		sua := rec[start:]
+		if err := ir.parseRockRidge(hdr, sua); err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+	}
+
+	return hdr, nil
+}
+
+// parseRockRidge sets the fields of hdr from the Rock Ridge entries
+// in the system use area of its record, and any continuations of it.
+func (ir *isoReader) parseRockRidge(hdr *Iso9660Header, sua []byte) error {
+	var name, linkname []byte
+	var hasName, continueLink bool
+
+	for continuations := 0; ; continuations++ {
+		var next *isoContinuation
+		for len(sua) >= 4 {
+			n := int(sua[2])
+			if n < 4 || n > len(sua) {
+				break
+			}
+			data := sua[4:n]
+			sig := string(sua[:2])
+			sua = sua[n:]
+
+			switch {
+			case sig == "ST":
+				sua = nil // end of the entries
+
+			case sig == "CE" && len(data) >= 24:
+				next = &isoContinuation{
+					location: binary.LittleEndian.Uint32(data[0:4]),
+					offset:   binary.LittleEndian.Uint32(data[8:12]),
+					length:   binary.LittleEndian.Uint32(data[16:20]),
+				}
+
+			case sig == "PX" && len(data) >= 32:
+				hdr.Mode = binary.LittleEndian.Uint32(data[0:4])
+				hdr.Nlink = int(binary.LittleEndian.Uint32(data[8:12]))
+				hdr.Uid = int(binary.LittleEndian.Uint32(data[16:20]))
+				hdr.Gid = int(binary.LittleEndian.Uint32(data[24:28]))
+
+			case sig == "NM" && len(data) >= 1:
+				// the name may be continued in more entries; the
+				// current and parent directories aren't named
+				if data[0]&(isoNameCurrent|isoNameParent) == 0 {
+					name = append(name, data[1:]...)
+					hasName = true
+				}
+
+			case sig == "SL" && len(data) >= 1:
+				for c := data[1:]; len(c) >= 2 && 2+int(c[1]) <= len(c); c = c[2+int(c[1]):] {
+					var part string
+					switch {
+					case c[0]&isoLinkCurrent != 0:
+						part = "."
+					case c[0]&isoLinkParent != 0:
+						part = ".."
+					case c[0]&isoLinkRoot != 0:
+						part = "/"
+					default:
+						part = string(c[2 : 2+c[1]])
+					}
+					if len(linkname) > 0 && !continueLink && linkname[len(linkname)-1] != '/' {
+						linkname = append(linkname, '/')
+					}
+					linkname = append(linkname, part...)
+					continueLink = c[0]&isoLinkContinue != 0
+				}
+
+			case sig == "TF" && len(data) >= 1:
+				hdr.ModTime = isoModTime(data, hdr.ModTime)
+
+			case sig == "CL" && len(data) >= 4:
+				hdr.childLink = binary.LittleEndian.Uint32(data[0:4])
+
+			case sig == "RE":
+				hdr.relocated = true
+			}
+		}
+
+		if next == nil {
+			break
+		}
+		if continuations >= isoMaxContinuations {
+			return fmt.Errorf("too many continuations of system use area")
+		}
+		if next.length > isoSectorSize {
+			return fmt.Errorf("continuation area is too large: %d bytes", next.length)
+		}
+		sua = make([]byte, next.length)
+		if _, err := ir.r.ReadAt(sua, int64(next.location)*ir.blockSize+int64(next.offset)); err != nil {
+			return fmt.Errorf("reading continuation of system use area: %w", noEOF(err))
+		}
+	}
+
+	if hasName {
+		hdr.Name = string(name)
+	}
+	hdr.Linkname = string(linkname)
+	return nil
+}
+
+// contents returns a reader of the data of the file.
+func (ir *isoReader) contents(hdr *Iso9660Header) io.Reader {
+	readers := make([]io.Reader, len(hdr.extents))
+	for i, ext := range hdr.extents {
+		readers[i] = io.NewSectionReader(ir.r, int64(ext.location)*ir.blockSize, int64(ext.length))
+	}
+	return io.MultiReader(readers...)
+}
+
+// isoRecordingTime parses the 7-byte time of a directory record.
+func isoRecordingTime(b []byte) time.Time {
+	if bytes.Equal(b, make([]byte, 7)) {
+		return time.Time{}
+	}
+	zone := time.FixedZone("", int(int8(b[6]))*15*60)
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, zone)
+}
+
+// isoModTime returns the modification time in the data of a
+// Rock Ridge TF entry, or def if it doesn't have one.
+func isoModTime(data []byte, def time.Time) time.Time {
+	const (
+		creation     = 1 << 0
+		modification = 1 << 1
+		longForm     = 1 << 7
+	)
+	flags, data := data[0], data[1:]
+	if flags&modification == 0 {
+		return def
+	}
+	size := 7
+	if flags&longForm != 0 {
+		size = 17
+	}
+	if flags&creation != 0 {
+		data = data[min(size, len(data)):]
+	}
+	if len(data) < size {
+		return def
+	}
+	if size == 7 {
+		return isoRecordingTime(data[:7])
+	}
+
+	// the long form is the same as in volume descriptors:
+	// digits of the date and time, and the time zone
+	digits := string(data[:16])
+	if strings.Trim(digits, "0") == "" {
+		return def
+	}
+	field := func(i, j int) int {
+		v, _ := strconv.Atoi(digits[i:j])
+		return v
+	}
+	zone := time.FixedZone("", int(int8(data[16]))*15*60)
+	return time.Date(field(0, 4), time.Month(field(4, 6)), field(6, 8),
+		field(8, 10), field(10, 12), field(12, 14), field(14, 16)*int(10*time.Millisecond), zone)
+}
+
+var isoMagic = []byte("CD001")
+
+const (
+	isoSectorSize     = 2048
+	isoSystemAreaSize = 16 * isoSectorSize
+
+	// The identifier of the first volume descriptor, after the system area.
+	isoMagicOffset = isoSystemAreaSize + 1
+
+	isoVolumeDescriptorPrimary       = 1
+	isoVolumeDescriptorSupplementary = 2
+	isoVolumeDescriptorTerminator    = 255
+
+	// Flags of directory records.
+	isoFlagDirectory   = 1 << 1
+	isoFlagAssociated  = 1 << 2
+	isoFlagMultiExtent = 1 << 7
+
+	// Flags of Rock Ridge NM entries.
+	isoNameCurrent = 1 << 1
+	isoNameParent  = 1 << 2
+
+	// Flags of components of Rock Ridge SL entries.
+	isoLinkContinue = 1 << 0
+	isoLinkCurrent  = 1 << 1
+	isoLinkParent   = 1 << 2
+	isoLinkRoot     = 1 << 3
+
+	// Limits to keep broken or malicious images from
+	// taking a lot of memory or time to read.
+	isoMaxVolumeDescriptors = 64
+	isoMaxDirSize           = 64 << 20
+	isoMaxContinuations     = 16
+)
+
+// Interface guard
+var _ Extractor = (*Iso9660)(nil)
@@ -0,0 +1,134 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+//go:generate find testdata/iso -exec touch -h -d "2024-05-01 12:00:00 UTC" {} +
+//go:generate env LANG=C.UTF-8 bsdtar --format iso9660 --options !pad,rockridge=strict -cf testdata/rockridge.iso -C testdata/iso .
+//go:generate env LANG=C.UTF-8 bsdtar --format iso9660 --options !pad,!rockridge -cf testdata/joliet.iso -C testdata/iso .
+//go:generate env LANG=C.UTF-8 bsdtar --format iso9660 --options !pad,!rockridge,!joliet -cf testdata/plain.iso -C testdata/iso .
+
+func TestIso9660Extract(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// the contents of the files on disk that the images were made from
+	const longName = "A file with a rather long name, ünïcode.txt"
+	source := func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join("testdata/iso", name))
+		checkErr(t, err, "reading file on disk")
+		return data
+	}
+	long, exec, hello := source(longName), source("dir/exec.sh"), source("dir/hello.txt")
+
+	for _, tc := range []struct {
+		filename string
+		want     fstest.MapFS
+	}{
+		{
+			// Rock Ridge has the names and modes of the files on disk
+			filename: "testdata/rockridge.iso",
+			want: fstest.MapFS{
+				longName:        {Data: long, Mode: 0644, ModTime: modTime},
+				"dir":           {Mode: fs.ModeDir | 0755, ModTime: modTime},
+				"dir/exec.sh":   {Data: exec, Mode: 0755, ModTime: modTime},
+				"dir/hello.txt": {Data: hello, Mode: 0644, ModTime: modTime},
+				"dir/link":      {Data: []byte("hello.txt"), Mode: fs.ModeSymlink | 0777, ModTime: modTime},
+			},
+		},
+		{
+			// Joliet has the names, but no modes or symbolic links
+			filename: "testdata/joliet.iso",
+			want: fstest.MapFS{
+				longName:        {Data: long, Mode: 0444, ModTime: modTime},
+				"dir":           {Mode: fs.ModeDir | 0555, ModTime: modTime},
+				"dir/exec.sh":   {Data: exec, Mode: 0444, ModTime: modTime},
+				"dir/hello.txt": {Data: hello, Mode: 0444, ModTime: modTime},
+			},
+		},
+		{
+			filename: "testdata/plain.iso",
+			want: fstest.MapFS{
+				"A_FILE_W.TXT":  {Data: long, Mode: 0444, ModTime: modTime},
+				"DIR":           {Mode: fs.ModeDir | 0555, ModTime: modTime},
+				"DIR/EXEC.SH":   {Data: exec, Mode: 0444, ModTime: modTime},
+				"DIR/HELLO.TXT": {Data: hello, Mode: 0444, ModTime: modTime},
+			},
+		},
+	} {
+		t.Run(tc.filename, func(t *testing.T) {
+			f, err := os.Open(tc.filename)
+			checkErr(t, err, "opening image")
+			defer f.Close()
+
+			format, _, err := Identify(context.Background(), "", f)
+			checkErr(t, err, "identifying image")
+			if _, ok := format.(Iso9660); !ok {
+				t.Fatalf("expected image to be identified as ISO 9660 but got %T", format)
+			}
+			checkExtractedFiles(t, extractFiles(t, Iso9660{}, f), tc.want)
+		})
+	}
+}
+
+func TestIso9660ArchiveFS(t *testing.T) {
+	fsys := &ArchiveFS{Path: "testdata/rockridge.iso", Format: Iso9660{}}
+
+	data, err := fs.ReadFile(fsys, "dir/hello.txt")
+	checkErr(t, err, "reading file from image")
+	if string(data) != "hello\n" {
+		t.Errorf("expected contents %q but got %q", "hello\n", data)
+	}
+
+	entries, err := fs.ReadDir(fsys, "dir")
+	checkErr(t, err, "reading directory from image")
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, " "); got != "exec.sh hello.txt link" {
+		t.Errorf("expected directory entries exec.sh, hello.txt, and link but got %s", got)
+	}
+}
+
+func TestIso9660ExtractNotSeekable(t *testing.T) {
+	data, err := os.ReadFile("testdata/plain.iso")
+	checkErr(t, err, "reading image")
+
+	err = Iso9660{}.Extract(context.Background(), io.MultiReader(bytes.NewReader(data)), func(context.Context, FileInfo) error {
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "io.ReaderAt and io.Seeker") {
+		t.Errorf("expected an error about the input type but got %v", err)
+	}
+}
+
+func TestIso9660ParseMalformedRecord(t *testing.T) {
+	ir := &isoReader{rockRidge: true}
+
+	// a record with an identifier of even length must have a padding
+	// byte before its system use area, but this one ends after the name
+	rec := make([]byte, 35)
+	rec[0], rec[32] = 35, 2
+	copy(rec[33:], "AB")
+	hdr, err := ir.parseRecord(rec, true)
+	checkErr(t, err, "parsing record")
+	if hdr.Name != "AB" || hdr.Mode != 0 {
+		t.Errorf("expected file AB without Rock Ridge entries but got %q with mode %o", hdr.Name, hdr.Mode)
+	}
+
+	// a record whose identifier is longer than the record
+	rec[32] = 3
+	if _, err := ir.parseRecord(rec, true); err == nil {
+		t.Error("expected an error for an identifier past the end of the record")
+	}
+}
@@ -0,0 +1,344 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Limits bounds the resources that may be consumed while reading
+// archives and compressed files, which is important when handling
+// untrusted input: a tiny archive can expand to enormous sizes (a
+// "decompression bomb"). A zero value for any limit means no limit.
+//
+// Limits are enforced by wrapping formats with LimitedExtractor or
+// LimitedDecompressor. Those wrappers can be used anywhere their
+// underlying interfaces are accepted, including as the Format of an
+// ArchiveFS or the Compression of a FileFS.
+type Limits struct {
+	// The maximum number of uncompressed bytes that may be read,
+	// in total, across all entries. This includes the bytes read
+	// by any nested extractions (see MaxNestingDepth).
+	MaxTotalBytes int64
+
+	// The maximum number of uncompressed bytes that may be read
+	// from any single entry.
+	MaxEntryBytes int64
+
+	// The maximum number of entries that may be walked, including
+	// the entries walked by any nested extractions.
+	MaxEntries int
+
+	// The maximum ratio of uncompressed bytes read to compressed
+	// bytes consumed from the input. The ratio is only checked after
+	// at least 1 MiB of uncompressed bytes have been read, because
+	// headers and small entries can legitimately have very high
+	// ratios.
+	MaxCompressionRatio float64
+
+	// The maximum number of extractions that may be nested within
+	// one another, including the outermost one; for example, 2 allows
+	// extracting an archive found inside the archive, but not one
+	// further level down. An extraction is nested if it is performed
+	// with the context given to the FileHandler of another extraction
+	// that enforces limits.
+	MaxNestingDepth int
+}
+
+// LimitError is returned when reading exceeds one of the Limits.
+type LimitError struct {
+	// The name of the Limits field that was exceeded,
+	// for example "MaxTotalBytes".
+	Limit string
+
+	// The name of the entry in the archive that was being
+	// read when the limit was exceeded, if any.
+	Entry string
+}
+
+func (e *LimitError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("exceeded limit %s", e.Limit)
+	}
+	return fmt.Sprintf("%s: exceeded limit %s", e.Entry, e.Limit)
+}
+
+// LimitedExtractor is an Extractor that enforces Limits while
+// extracting with the underlying Extractor. Limits on bytes apply
+// to what is read from files opened in the FileHandler.
+type LimitedExtractor struct {
+	Extractor
+	Limits Limits
+}
+
+// Extract extracts from sourceArchive with the underlying Extractor,
+// returning a *LimitError if any limit is exceeded.
+func (le LimitedExtractor) Extract(ctx context.Context, sourceArchive io.Reader, handleFile FileHandler) error {
+	ctx, lim, err := newLimiter(ctx, le.Limits)
+	if err != nil {
+		return err
+	}
+	return le.Extractor.Extract(ctx, lim.countInput(sourceArchive), lim.handler(handleFile))
+}
+
+// LimitedDecompressor is a Decompressor that enforces Limits while
+// reading from the underlying Decompressor. The decompressed stream
+// is treated as a single, unnamed entry.
+type LimitedDecompressor struct {
+	Decompressor
+	Limits Limits
+}
+
+// OpenReader wraps r with a new reader that decompresses what is read
+// and returns a *LimitError if any limit is exceeded.
+func (ld LimitedDecompressor) OpenReader(r io.Reader) (io.ReadCloser, error) {
+	lim := &limiter{Limits: ld.Limits, depth: 1}
+	rc, err := ld.Decompressor.OpenReader(lim.countInput(r))
+	if err != nil {
+		return nil, err
+	}
+	return &limitedReader{ReadCloser: rc, lim: lim}, nil
+}
+
+// ratioGracePeriod is how many uncompressed bytes may be read before
+// the compression ratio is enforced.
+const ratioGracePeriod = 1 << 20
+
+// limiter tracks resource usage for a single extraction or
+// decompression and enforces its limits. Limiters of nested
+// extractions are chained to their parent limiter, so that
+// totals accumulate at every level.
+type limiter struct {
+	Limits
+	parent *limiter
+	depth  int
+
+	entries    int
+	total      int64  // uncompressed bytes read
+	compressed int64  // compressed bytes consumed from input
+	current    string // name of current entry
+}
+
+type limiterCtxKey struct{}
+
+// newLimiter returns a new limiter that enforces limits, nested within
+// the limiter of ctx if there is one, and a context carrying it.
+func newLimiter(ctx context.Context, limits Limits) (context.Context, *limiter, error) {
+	lim := &limiter{Limits: limits, depth: 1}
+	if parent, ok := ctx.Value(limiterCtxKey{}).(*limiter); ok {
+		lim.parent = parent
+		lim.depth = parent.depth + 1
+	}
+	for l := lim; l != nil; l = l.parent {
+		if l.MaxNestingDepth > 0 && lim.depth-l.depth+1 > l.MaxNestingDepth {
+			return ctx, nil, &LimitError{Limit: "MaxNestingDepth", Entry: lim.parent.current}
+		}
+	}
+	return context.WithValue(ctx, limiterCtxKey{}, lim), lim, nil
+}
+
+// countInput wraps the input stream r so that the compressed bytes
+// consumed from it are counted. If r can read at and seek, so can
+// the returned reader.
+func (l *limiter) countInput(r io.Reader) io.Reader {
+	if ras, ok := r.(ReaderAtSeeker); ok {
+		return countingReaderAtSeeker{ras, l}
+	}
+	return countingReader{r, l}
+}
+
+// handler wraps handleFile so that entries are counted and the
+// files opened by handleFile are read within the limits.
+func (l *limiter) handler(handleFile FileHandler) FileHandler {
+	return func(ctx context.Context, file FileInfo) error {
+		l.current = file.NameInArchive
+		if err := l.addEntry(); err != nil {
+			return err
+		}
+		if l.MaxEntryBytes > 0 && file.FileInfo != nil && file.Size() > l.MaxEntryBytes {
+			return &LimitError{Limit: "MaxEntryBytes", Entry: file.NameInArchive}
+		}
+		if open := file.Open; open != nil {
+			file.Open = func() (fs.File, error) {
+				f, err := open()
+				if err != nil {
+					return nil, err
+				}
+				return newLimitedFile(f, l, file.NameInArchive), nil
+			}
+		}
+		return handleFile(ctx, file)
+	}
+}
+
+func (l *limiter) addEntry() error {
+	for lim := l; lim != nil; lim = lim.parent {
+		lim.entries++
+		if lim.MaxEntries > 0 && lim.entries > lim.MaxEntries {
+			return &LimitError{Limit: "MaxEntries", Entry: l.current}
+		}
+	}
+	return nil
+}
+
+// addBytes records that n more uncompressed bytes were read from the
+// entry named name, which has now had entryTotal bytes read from it.
+func (l *limiter) addBytes(name string, n, entryTotal int64) error {
+	if l.MaxEntryBytes > 0 && entryTotal > l.MaxEntryBytes {
+		return &LimitError{Limit: "MaxEntryBytes", Entry: name}
+	}
+	for lim := l; lim != nil; lim = lim.parent {
+		lim.total += n
+		if lim.MaxTotalBytes > 0 && lim.total > lim.MaxTotalBytes {
+			return &LimitError{Limit: "MaxTotalBytes", Entry: name}
+		}
+	}
+	if l.MaxCompressionRatio > 0 && l.total > ratioGracePeriod &&
+		float64(l.total) > l.MaxCompressionRatio*float64(max(l.compressed, 1)) {
+		return &LimitError{Limit: "MaxCompressionRatio", Entry: name}
+	}
+	return nil
+}
+
+// limitedFile is a file opened from within an archive
+// whose reads are counted against a limiter.
+type limitedFile struct {
+	fs.File
+	lim      *limiter
+	name     string
+	pos      int64
+	furthest int64 // the end of the furthest read, which is how much of the entry was read
+}
+
+// newLimitedFile returns f as a limitedFile. If f can seek or read
+// at offsets, so can the returned file, so that, for example, ranges
+// of it can be served by FileServer; all bytes read are counted.
+func newLimitedFile(f fs.File, lim *limiter, name string) fs.File {
+	lf := &limitedFile{File: f, lim: lim, name: name}
+	_, canSeek := f.(io.Seeker)
+	_, canReadAt := f.(io.ReaderAt)
+	switch {
+	case canSeek && canReadAt:
+		return limitedReadSeekerAtFile{lf}
+	case canSeek:
+		return limitedSeekerFile{lf}
+	case canReadAt:
+		return limitedReaderAtFile{lf}
+	}
+	return lf
+}
+
+func (lf *limitedFile) Read(p []byte) (int, error) {
+	n, err := lf.File.Read(p)
+	lf.pos += int64(n)
+	if limitErr := lf.count(n, lf.pos); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
+
+func (lf *limitedFile) seek(offset int64, whence int) (int64, error) {
+	pos, err := lf.File.(io.Seeker).Seek(offset, whence)
+	if err == nil {
+		lf.pos = pos
+	}
+	return pos, err
+}
+
+func (lf *limitedFile) readAt(p []byte, off int64) (int, error) {
+	n, err := lf.File.(io.ReaderAt).ReadAt(p, off)
+	if limitErr := lf.count(n, off+int64(n)); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
+
+// count records that n bytes were read, up to offset end.
+func (lf *limitedFile) count(n int, end int64) error {
+	lf.furthest = max(lf.furthest, end)
+	return lf.lim.addBytes(lf.name, int64(n), lf.furthest)
+}
+
+type limitedSeekerFile struct{ *limitedFile }
+
+func (f limitedSeekerFile) Seek(offset int64, whence int) (int64, error) {
+	return f.seek(offset, whence)
+}
+
+type limitedReaderAtFile struct{ *limitedFile }
+
+func (f limitedReaderAtFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.readAt(p, off)
+}
+
+type limitedReadSeekerAtFile struct{ *limitedFile }
+
+func (f limitedReadSeekerAtFile) Seek(offset int64, whence int) (int64, error) {
+	return f.seek(offset, whence)
+}
+
+func (f limitedReadSeekerAtFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.readAt(p, off)
+}
+
+// limitedReader is a decompressed stream
+// whose reads are counted against a limiter.
+type limitedReader struct {
+	io.ReadCloser
+	lim  *limiter
+	read int64
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.ReadCloser.Read(p)
+	lr.read += int64(n)
+	if limitErr := lr.lim.addBytes("", int64(n), lr.read); limitErr != nil {
+		return n, limitErr
+	}
+	return n, err
+}
+
+// countingReader counts the bytes read from
+// the input stream of a limiter.
+type countingReader struct {
+	io.Reader
+	lim *limiter
+}
+
+func (cr countingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.lim.compressed += int64(n)
+	return n, err
+}
+
+// countingReaderAtSeeker is like countingReader, but for
+// input streams that also read at and seek, which some
+// formats (like Zip) require.
+type countingReaderAtSeeker struct {
+	ReaderAtSeeker
+	lim *limiter
+}
+
+func (cr countingReaderAtSeeker) Read(p []byte) (int, error) {
+	n, err := cr.ReaderAtSeeker.Read(p)
+	cr.lim.compressed += int64(n)
+	return n, err
+}
+
+func (cr countingReaderAtSeeker) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.ReaderAtSeeker.ReadAt(p, off)
+	cr.lim.compressed += int64(n)
+	return n, err
+}
+
+// Interface guards
+var (
+	_ Extractor    = LimitedExtractor{}
+	_ Decompressor = LimitedDecompressor{}
+
+	_ io.Seeker   = limitedSeekerFile{}
+	_ io.ReaderAt = limitedReaderAtFile{}
+	_ io.Seeker   = limitedReadSeekerAtFile{}
+	_ io.ReaderAt = limitedReadSeekerAtFile{}
+)
@@ -0,0 +1,220 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func compressedTestTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	wc, err := Gz{}.OpenWriter(buf)
+	checkErr(t, err, "opening compressor")
+	_, err = wc.Write(buildTar(t, entries))
+	checkErr(t, err, "compressing")
+	checkErr(t, wc.Close(), "closing compressor")
+	return buf.Bytes()
+}
+
+func expectLimitError(t *testing.T, err error, limit, entry string) {
+	t.Helper()
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("expected LimitError, got: %v", err)
+	}
+	if limitErr.Limit != limit || limitErr.Entry != entry {
+		t.Errorf("expected limit %s on entry '%s' but got limit %s on entry '%s'",
+			limit, entry, limitErr.Limit, limitErr.Entry)
+	}
+}
+
+func readAllHandler(_ context.Context, f FileInfo) error {
+	if f.IsDir() {
+		return nil
+	}
+	file, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(io.Discard, file)
+	return err
+}
+
+func TestLimitedExtractor(t *testing.T) {
+	const bigSize = 4 << 20
+	archive := compressedTestTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "small.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "small"},
+		{hdr: tar.Header{Name: "big.bin", Typeflag: tar.TypeReg, Mode: 0644}, body: strings.Repeat("\x00", bigSize)},
+	})
+	format := Archive{Compression: Gz{}, Extraction: Tar{}}
+
+	for _, tc := range []struct {
+		limits Limits
+		limit  string
+		entry  string
+	}{
+		{limits: Limits{MaxTotalBytes: 1 << 20}, limit: "MaxTotalBytes", entry: "big.bin"},
+		{limits: Limits{MaxEntryBytes: 1 << 20}, limit: "MaxEntryBytes", entry: "big.bin"},
+		{limits: Limits{MaxEntries: 1}, limit: "MaxEntries", entry: "big.bin"},
+		{limits: Limits{MaxCompressionRatio: 10}, limit: "MaxCompressionRatio", entry: "big.bin"},
+	} {
+		t.Run(tc.limit, func(t *testing.T) {
+			le := LimitedExtractor{Extractor: format, Limits: tc.limits}
+			err := le.Extract(context.Background(), bytes.NewReader(archive), readAllHandler)
+			expectLimitError(t, err, tc.limit, tc.entry)
+		})
+	}
+
+	// generous limits should not interfere
+	le := LimitedExtractor{Extractor: format, Limits: Limits{
+		MaxTotalBytes:       bigSize + 5,
+		MaxEntryBytes:       bigSize,
+		MaxEntries:          2,
+		MaxCompressionRatio: 10000,
+	}}
+	err := le.Extract(context.Background(), bytes.NewReader(archive), readAllHandler)
+	checkErr(t, err, "extracting within limits")
+}
+
+func TestLimitedExtractorNesting(t *testing.T) {
+	inner := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "inner.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "inner"},
+	})
+	outer := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "inner.tar", Typeflag: tar.TypeReg, Mode: 0644}, body: string(inner)},
+	})
+
+	var nestedHandler FileHandler
+	nestedHandler = func(ctx context.Context, f FileInfo) error {
+		if !strings.HasSuffix(f.NameInArchive, ".tar") {
+			return readAllHandler(ctx, f)
+		}
+		file, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		le := LimitedExtractor{Extractor: Tar{}}
+		return le.Extract(ctx, file, nestedHandler)
+	}
+
+	le := LimitedExtractor{Extractor: Tar{}, Limits: Limits{MaxNestingDepth: 1}}
+	err := le.Extract(context.Background(), bytes.NewReader(outer), nestedHandler)
+	expectLimitError(t, err, "MaxNestingDepth", "inner.tar")
+
+	le.Limits = Limits{MaxNestingDepth: 2, MaxEntries: 1}
+	err = le.Extract(context.Background(), bytes.NewReader(outer), nestedHandler)
+	expectLimitError(t, err, "MaxEntries", "inner.txt")
+
+	le.Limits = Limits{MaxNestingDepth: 2}
+	err = le.Extract(context.Background(), bytes.NewReader(outer), nestedHandler)
+	checkErr(t, err, "extracting nested archive within limits")
+}
+
+func TestLimitedDecompressor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	wc, err := Zstd{}.OpenWriter(buf)
+	checkErr(t, err, "opening compressor")
+	_, err = wc.Write(make([]byte, 4<<20))
+	checkErr(t, err, "compressing")
+	checkErr(t, wc.Close(), "closing compressor")
+
+	ld := LimitedDecompressor{Decompressor: Zstd{}, Limits: Limits{MaxTotalBytes: 1 << 20}}
+	rc, err := ld.OpenReader(bytes.NewReader(buf.Bytes()))
+	checkErr(t, err, "opening decompressor")
+	defer rc.Close()
+	_, err = io.Copy(io.Discard, rc)
+	expectLimitError(t, err, "MaxTotalBytes", "")
+}
+
+func TestArchiveFSLimits(t *testing.T) {
+	archive := compressedTestTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "big.bin", Typeflag: tar.TypeReg, Mode: 0644}, body: strings.Repeat("\x00", 2<<20)},
+	})
+	fsys := &ArchiveFS{
+		Stream: io.NewSectionReader(bytes.NewReader(archive), 0, int64(len(archive))),
+		Format: LimitedExtractor{
+			Extractor: Archive{Compression: Gz{}, Extraction: Tar{}},
+			Limits:    Limits{MaxTotalBytes: 1 << 20},
+		},
+	}
+	_, err := fs.ReadFile(fsys, "big.bin")
+	expectLimitError(t, err, "MaxTotalBytes", "big.bin")
+}
+
+// filesExtractor is an Extractor that walks the files
+// instead of reading an archive.
+type filesExtractor []FileInfo
+
+func (fe filesExtractor) Extract(ctx context.Context, _ io.Reader, handleFile FileHandler) error {
+	for _, file := range fe {
+		if err := handleFile(ctx, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestLimitedExtractorSeekable(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	files := filesFromMapFS(t, fstest.MapFS{
+		"data.txt": {Data: []byte("0123456789"), Mode: 0644, ModTime: modTime},
+	})
+
+	for _, tc := range []struct {
+		limits Limits
+		body   string
+		limit  string
+	}{
+		// the range is served by seeking, so only it is read
+		{limits: Limits{MaxTotalBytes: 4}, body: "2345"},
+		// the bytes read at an offset count toward the total
+		{limits: Limits{MaxTotalBytes: 3}, limit: "MaxTotalBytes"},
+	} {
+		le := LimitedExtractor{Extractor: filesExtractor(files), Limits: tc.limits}
+		err := le.Extract(context.Background(), nil, func(_ context.Context, f FileInfo) error {
+			file, err := f.Open()
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			if _, ok := file.(io.ReaderAt); !ok {
+				t.Error("expected file to read at offsets like the underlying file")
+			}
+			rs, ok := file.(io.ReadSeeker)
+			if !ok {
+				t.Fatal("expected file to seek like the underlying file")
+			}
+			if tc.limit != "" {
+				_, err := file.(io.ReaderAt).ReadAt(make([]byte, 4), 2)
+				return err
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/data.txt", nil)
+			req.Header.Set("Range", "bytes=2-5")
+			rec := httptest.NewRecorder()
+			rec.Header().Set("Content-Type", "text/plain") // don't read the file to detect it
+			http.ServeContent(rec, req, f.Name(), f.ModTime(), rs)
+			if rec.Code != http.StatusPartialContent || rec.Body.String() != tc.body {
+				t.Errorf("expected status %d with body '%s' but got %d with '%s'", http.StatusPartialContent, tc.body, rec.Code, rec.Body)
+			}
+			return nil
+		})
+		if tc.limit != "" {
+			expectLimitError(t, err, tc.limit, "data.txt")
+		} else {
+			checkErr(t, err, "extracting")
+		}
+	}
+}
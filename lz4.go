@@ -1,8 +1,10 @@
 package archiver
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"strings"
 
@@ -50,7 +52,51 @@ func (lz Lz4) OpenWriter(w io.Writer) (io.WriteCloser, error) {
 }
 
 func (Lz4) OpenReader(r io.Reader) (io.ReadCloser, error) {
-	return io.NopCloser(lz4.NewReader(r)), nil
+	br := bufio.NewReader(r)
+	return io.NopCloser(&lz4Reader{Reader: lz4.NewReader(br), src: br}), nil
+}
+
+// members finds the LZ4 frames in ra by decompressing each one, since
+// the length of a frame is not recorded anywhere in it.
+func (Lz4) members(ra io.ReaderAt, size int64) ([]int64, error) {
+	var offsets []int64
+	for offset := int64(0); offset < size; {
+		offsets = append(offsets, offset)
+		cr := &readCounter{r: io.NewSectionReader(ra, offset, size-offset)}
+		if _, err := io.Copy(io.Discard, lz4.NewReader(cr)); err != nil {
+			return nil, fmt.Errorf("frame at offset %d: %w", offset, err)
+		}
+		if cr.n == 0 {
+			return nil, fmt.Errorf("frame at offset %d: %w", offset, io.ErrUnexpectedEOF)
+		}
+		offset += cr.n
+	}
+	return offsets, nil
+}
+
+// lz4Reader reads concatenated LZ4 frames, as the lz4 command does,
+// since lz4.Reader stops at the end of the first one.
+type lz4Reader struct {
+	*lz4.Reader
+	src *bufio.Reader
+}
+
+func (lr *lz4Reader) Read(p []byte) (int, error) {
+	for {
+		n, err := lr.Reader.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		if _, err := lr.src.Peek(1); err == io.EOF {
+			return n, io.EOF // no more frames
+		} else if err != nil {
+			return n, err
+		}
+		lr.Reader.Reset(lr.src)
+		if n > 0 {
+			return n, nil
+		}
+	}
 }
 
 var lz4Header = []byte{0x04, 0x22, 0x4d, 0x18}
@@ -102,6 +102,20 @@ func (r Rar) Extract(ctx context.Context, sourceArchive io.Reader, handleFile Fi
 			},
 		}
 
+		// rar stores the target of a symlink as its file contents; since
+		// the stream is consumed by reading it, serve the contents from
+		// the link target instead
+		if isSymlink(info) {
+			linkTarget, err := linkTargetFromBody(rr)
+			if err != nil {
+				return fmt.Errorf("reading link target: %s: %w", hdr.Name, err)
+			}
+			file.LinkTarget = linkTarget
+			file.Open = func() (fs.File, error) {
+				return fileInArchive{io.NopCloser(strings.NewReader(linkTarget)), info}, nil
+			}
+		}
+
 		err = handleFile(ctx, file)
 		if errors.Is(err, fs.SkipAll) {
 			break
@@ -2,6 +2,7 @@ package archiver
 
 import (
 	"archive/tar"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"io/fs"
 	"log"
 	"path"
+	"slices"
 	"strings"
 )
 
@@ -79,14 +81,10 @@ func (t Tar) writeFileToArchive(ctx context.Context, tw *tar.Writer, file FileIn
 		return err // honor context cancellation
 	}
 
-	hdr, err := tar.FileInfoHeader(file, file.LinkTarget)
+	hdr, err := t.fileHeader(file)
 	if err != nil {
 		return fmt.Errorf("file %s: creating header: %w", file.NameInArchive, err)
 	}
-	hdr.Name = file.NameInArchive // complete path, since FileInfoHeader() only has base name
-	if hdr.Name == "" {
-		hdr.Name = file.Name() // assume base name of file I guess
-	}
 	if t.NumericUIDGID {
 		hdr.Uname = ""
 		hdr.Gname = ""
@@ -179,6 +177,567 @@ func (t Tar) Insert(ctx context.Context, into io.ReadWriteSeeker, files []FileIn
 	return nil
 }
 
+// fileHeader returns the header with which to write file into an archive.
+// If file has a tar header, as files extracted from tar archives do, a
+// copy of that header is used (with the name in the archive) so that its
+// PAX records, user and group names, device numbers, and so on are kept
+// when copying entries between tar archives. Otherwise, the header is
+// made from the file's info.
+func (Tar) fileHeader(file FileInfo) (*tar.Header, error) {
+	var hdr *tar.Header
+	switch h := file.Header.(type) {
+	case tar.Header:
+		hdr = &h
+	case *tar.Header:
+		hdrCopy := *h
+		hdr = &hdrCopy
+	}
+	if hdr == nil {
+		var err error
+		hdr, err = tar.FileInfoHeader(file, file.LinkTarget)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if hdr.Typeflag == tar.TypeGNUSparse {
+			hdr.Typeflag = tar.TypeReg // the writer can't make sparse files, so write it in full
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = file.Size()
+		}
+		if file.LinkTarget != "" {
+			hdr.Linkname = file.LinkTarget
+		}
+	}
+
+	name := file.NameInArchive // complete path, since FileInfoHeader() only has base name
+	if name == "" {
+		name = file.Name() // assume base name of file I guess
+	}
+	if name != hdr.Name {
+		hdr.Format = tar.FormatUnknown // the new name may need a different format
+	}
+	hdr.Name = name
+	return hdr, nil
+}
+
+// insertCompressed inserts files into a tar archive that is compressed
+// with comp, by rewriting the end of it as new compressed members. The
+// member containing the end of the last file is cut short there and
+// followed by the new files; then the end-of-archive trailer is written
+// as a member of its own, so that inserting again only needs to replace
+// the trailer. The archive must have a Truncate method, as *os.File does,
+// since any compressed data left at the end would be read as more of the
+// archive.
+func (t Tar) insertCompressed(ctx context.Context, comp concatenator, into io.ReadWriteSeeker, files []FileInfo) error {
+	tf, ok := into.(truncater)
+	if !ok {
+		return fmt.Errorf("inserting into a compressed archive requires truncating it, but %T cannot be truncated", into)
+	}
+	size, err := into.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	ra := seekerReaderAt{into}
+	offsets, err := comp.members(ra, size)
+	if err != nil {
+		return fmt.Errorf("finding compressed members: %w", err)
+	}
+
+	// find the end of the last file, and the member it ends in
+	offsets = append(offsets, size)
+	mr := &memberReader{comp: comp, ra: ra, offsets: offsets}
+	defer mr.close()
+	const blockSize = 512
+	var end int64
+	tr := tar.NewReader(mr)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err // honor context cancellation
+		}
+		_, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return err
+		}
+		end = (mr.n + blockSize - 1) / blockSize * blockSize
+	}
+	mr.close()
+	var member int
+	for i, start := range mr.starts {
+		if start <= end {
+			member = i
+		}
+	}
+	var cut, keep int64
+	if len(mr.starts) > 0 {
+		cut, keep = offsets[member], end-mr.starts[member]
+	}
+
+	// write the new members after the existing data, so that
+	// the archive is unchanged if anything fails until then
+	w := &seekerWriter{ws: into, offset: size}
+	moved := false
+	defer func() {
+		if !moved {
+			tf.Truncate(size)
+		}
+	}()
+
+	writeMember := func(write func(io.Writer) error) error {
+		wc, err := comp.OpenWriter(w)
+		if err != nil {
+			return err
+		}
+		if err := write(wc); err != nil {
+			wc.Close()
+			return err
+		}
+		return wc.Close()
+	}
+	if keep > 0 || len(files) > 0 {
+		err := writeMember(func(w io.Writer) error {
+			if keep > 0 {
+				rc, err := comp.OpenReader(io.NewSectionReader(ra, cut, offsets[member+1]-cut))
+				if err != nil {
+					return err
+				}
+				_, err = io.CopyN(w, rc, keep)
+				rc.Close()
+				if err != nil {
+					return fmt.Errorf("copying end of archive: %w", err)
+				}
+			}
+			tw := tar.NewWriter(w)
+			for i, file := range files {
+				if err := ctx.Err(); err != nil {
+					return err // honor context cancellation
+				}
+				err := t.writeFileToArchive(ctx, tw, file)
+				if err != nil {
+					if t.ContinueOnError && ctx.Err() == nil {
+						log.Printf("[ERROR] appending file %d into archive: %s: %v", i, file.Name(), err)
+						continue
+					}
+					return fmt.Errorf("appending file %d into archive: %s: %w", i, file.Name(), err)
+				}
+			}
+			return tw.Flush()
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = writeMember(func(w io.Writer) error {
+		_, err := w.Write(make([]byte, 2*blockSize))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("writing end of archive: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+	moved = true
+	n := w.offset - size
+	if err := moveData(into, cut, size, n, make([]byte, 32*1024)); err != nil {
+		return err
+	}
+	return tf.Truncate(cut + n)
+}
+
+// memberReader reads the decompressed contents of the consecutive
+// members of a compressed stream, recording where each one begins.
+type memberReader struct {
+	comp    Compression
+	ra      io.ReaderAt
+	offsets []int64 // where the members begin, followed by where the last one ends
+
+	rc     io.ReadCloser // the current member
+	starts []int64       // decompressed offsets of the members opened so far
+	n      int64         // decompressed bytes read
+}
+
+func (mr *memberReader) Read(p []byte) (int, error) {
+	for {
+		if mr.rc == nil {
+			i := len(mr.starts)
+			if i+1 >= len(mr.offsets) {
+				return 0, io.EOF
+			}
+			rc, err := mr.comp.OpenReader(io.NewSectionReader(mr.ra, mr.offsets[i], mr.offsets[i+1]-mr.offsets[i]))
+			if err != nil {
+				return 0, fmt.Errorf("member at offset %d: %w", mr.offsets[i], err)
+			}
+			mr.rc = rc
+			mr.starts = append(mr.starts, mr.n)
+		}
+		n, err := mr.rc.Read(p)
+		mr.n += int64(n)
+		if err == io.EOF {
+			mr.close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (mr *memberReader) close() {
+	if mr.rc != nil {
+		mr.rc.Close()
+		mr.rc = nil
+	}
+}
+
+// Delete deletes the named files from the tar archive, implementing the
+// Deleter interface. The entries after the deleted ones are moved up to
+// take their place. If the archive has a Truncate method, as *os.File
+// does, it is truncated to its new size; otherwise, the space left over
+// at the end is zeroed, which tar readers treat as the end of the archive.
+//
+// If a deleted file is the target of a hard link that is not deleted, the
+// first such link takes its place as a regular file, keeping its contents,
+// and the other links to it are changed to point to that one instead.
+func (t Tar) Delete(ctx context.Context, archive io.ReadWriteSeeker, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	toDelete := newDeletionList(names)
+
+	const blockSize = 512
+
+	// find the extent of each entry (including any extended headers before
+	// it) by reading through it, since the size of its data in the archive
+	// is not always the size in its header, as with sparse files
+	type entry struct {
+		hdr                   *tar.Header
+		start, dataStart, end int64
+		delete                bool
+		newHeader             []byte
+	}
+	var entries []entry
+	archiveStart, err := archive.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	start := archiveStart
+	tr := tar.NewReader(archive)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err // honor context cancellation
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		dataStart, err := archive.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("reading file: %s: %w", hdr.Name, err)
+		}
+		pos, err := archive.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end := archiveStart + (pos-archiveStart+blockSize-1)/blockSize*blockSize // round up to next block
+		entries = append(entries, entry{
+			hdr:       hdr,
+			start:     start,
+			dataStart: dataStart,
+			end:       end,
+			delete:    hdr.Typeflag != tar.TypeXGlobalHeader && toDelete.includes(hdr.Name),
+		})
+		start = end
+	}
+	if err := toDelete.notFound(); err != nil {
+		return err
+	}
+
+	// hard links point to earlier entries, so by the time a link that is
+	// kept is found, the entry with the contents of its target is known;
+	// if that entry is deleted, it is kept under the name of the first
+	// such link instead, which is deleted, so the contents stay in place
+	holders := make(map[string]int)      // names of deleted files, to the entry that has their contents
+	replacements := make(map[int]string) // entries kept under the name of a link, to that name
+	aliases := make(map[string]string)   // names of deleted links, to the kept name they point to
+	writeHeader := func(e *entry, hdr tar.Header) error {
+		hdr.Format = tar.FormatUnknown // let the writer choose a format that fits the names
+		var buf bytes.Buffer
+		if err := tar.NewWriter(&buf).WriteHeader(&hdr); err != nil {
+			return fmt.Errorf("writing header: %s: %w", hdr.Name, err)
+		}
+		e.newHeader = buf.Bytes()
+		return nil
+	}
+	for i := range entries {
+		e := &entries[i]
+		name, linkname := strings.TrimSuffix(e.hdr.Name, "/"), e.hdr.Linkname
+		switch {
+		case e.hdr.Typeflag == tar.TypeLink && e.delete:
+			if j, ok := holders[linkname]; ok {
+				holders[name] = j
+			} else if alias, ok := aliases[linkname]; ok {
+				aliases[name] = alias
+			} else {
+				aliases[name] = linkname
+			}
+		case e.delete:
+			holders[name] = i
+		case e.hdr.Typeflag == tar.TypeLink:
+			newLinkname, changed := aliases[linkname]
+			j, held := holders[linkname]
+			if replacement, ok := replacements[j]; held && ok {
+				newLinkname, changed = replacement, true
+			}
+			if changed {
+				hdr := *e.hdr
+				hdr.Linkname = newLinkname
+				if err := writeHeader(e, hdr); err != nil {
+					return err
+				}
+			}
+			if !held || changed {
+				continue
+			}
+			holder := &entries[j]
+			if holder.end-holder.dataStart != (holder.hdr.Size+blockSize-1)/blockSize*blockSize {
+				return fmt.Errorf("deleting file: %s: sparse files that are the target of a hard link cannot be deleted", holder.hdr.Name)
+			}
+			hdr := *holder.hdr
+			hdr.Name = e.hdr.Name
+			if err := writeHeader(holder, hdr); err != nil {
+				return err
+			}
+			holder.delete, e.delete = false, true
+			replacements[j] = e.hdr.Name
+		}
+	}
+	first := slices.IndexFunc(entries, func(e entry) bool { return e.delete || e.newHeader != nil })
+	if first < 0 {
+		return nil
+	}
+	size, err := archive.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// lay out the remaining entries from the first deleted or changed one
+	// onward, as with Rename; the archive now gets modified, so there's no
+	// turning back for context cancellation
+	offset := entries[first].start
+	var segments []segment
+	for _, e := range entries[first:] {
+		if e.delete {
+			continue
+		}
+		header := e.newHeader
+		if header == nil {
+			header = make([]byte, e.dataStart-e.start)
+			if _, err := archive.Seek(e.start, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(archive, header); err != nil {
+				return fmt.Errorf("reading header: %s: %w", e.hdr.Name, err)
+			}
+		}
+		segments = append(segments, segment{
+			header:   header,
+			offset:   offset,
+			dataFrom: e.dataStart,
+			dataLen:  e.end - e.dataStart,
+		})
+		offset += int64(len(header)) + e.end - e.dataStart
+	}
+	if err := rearrange(archive, segments); err != nil {
+		return err
+	}
+
+	// end the archive with two zero blocks, and remove what's left
+	if err := zeroData(archive, offset, offset+2*blockSize); err != nil {
+		return fmt.Errorf("writing end of archive: %w", err)
+	}
+	offset += 2 * blockSize
+	if tf, ok := archive.(truncater); ok && offset < size {
+		return tf.Truncate(offset)
+	}
+	return zeroData(archive, offset, size)
+}
+
+// Rename renames files in the tar archive, implementing the Renamer
+// interface. Hard links to renamed files are updated too. The headers
+// of renamed files are rewritten, using PAX headers if the new names
+// need them, and the entries after the first renamed one are moved to
+// make room. If the archive shrinks and has a Truncate method, as
+// *os.File does, it is truncated to its new size; otherwise, the space
+// left over at the end is zeroed. Sparse files cannot be renamed.
+func (t Tar) Rename(ctx context.Context, archive io.ReadWriteSeeker, renames map[string]string) error {
+	if len(renames) == 0 {
+		return nil
+	}
+	toRename := newRenameList(renames)
+
+	const blockSize = 512
+
+	// find the extent of each entry, as with Delete, and where its data starts
+	type entry struct {
+		hdr                   *tar.Header
+		start, dataStart, end int64
+		name                  string // new name
+		renamed, remove       bool
+		newHeader             []byte
+	}
+	var entries []entry
+	archiveStart, err := archive.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	start := archiveStart
+	tr := tar.NewReader(archive)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err // honor context cancellation
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		dataStart, err := archive.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return fmt.Errorf("reading file: %s: %w", hdr.Name, err)
+		}
+		pos, err := archive.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end := archiveStart + (pos-archiveStart+blockSize-1)/blockSize*blockSize // round up to next block
+		entries = append(entries, entry{hdr: hdr, start: start, dataStart: dataStart, end: end})
+		start = end
+	}
+
+	// write the new headers of the renamed entries
+	first := -1
+	newNames := make(map[string]int)
+	for i := range entries {
+		e := &entries[i]
+		if e.hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		newName, renamed := toRename.rename(e.hdr.Name)
+		linkname, linkMatch := e.hdr.Linkname, -1
+		if e.hdr.Typeflag == tar.TypeLink {
+			linkname, linkMatch = toRename.lookup(e.hdr.Linkname)
+		}
+		e.name, e.renamed = newName, renamed
+		if newName != "" {
+			newNames[strings.TrimSuffix(newName, "/")]++
+		}
+		if !renamed && linkMatch < 0 {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if newName == "" {
+			e.remove = true
+			continue
+		}
+
+		hdr := *e.hdr
+		hdr.Name, hdr.Linkname = newName, linkname
+		hdr.Format = tar.FormatUnknown // let the writer choose a format that fits the names
+		switch hdr.Typeflag {
+		case tar.TypeLink, tar.TypeSymlink, tar.TypeChar, tar.TypeBlock, tar.TypeDir, tar.TypeFifo:
+			hdr.Size = 0 // no data follows these headers
+		default:
+			if e.end-e.dataStart != (hdr.Size+blockSize-1)/blockSize*blockSize {
+				return fmt.Errorf("renaming file: %s: sparse files cannot be renamed", e.hdr.Name)
+			}
+		}
+		var buf bytes.Buffer
+		if err := tar.NewWriter(&buf).WriteHeader(&hdr); err != nil {
+			return fmt.Errorf("renaming file: %s: writing header: %w", e.hdr.Name, err)
+		}
+		e.newHeader = buf.Bytes()
+	}
+	if err := toRename.notFound(); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.renamed && !e.remove && newNames[strings.TrimSuffix(e.name, "/")] > 1 {
+			return fmt.Errorf("renaming file: %s to %s: %w", e.hdr.Name, e.name, fs.ErrExist)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+	size, err := archive.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	// lay out the entries from the first renamed one onward, reading
+	// the headers of the others so they can be moved along with their
+	// data; the archive now gets modified, so there's no turning back
+	// for context cancellation
+	offset := entries[first].start
+	var segments []segment
+	for _, e := range entries[first:] {
+		if e.remove {
+			continue
+		}
+		header := e.newHeader
+		if header == nil {
+			header = make([]byte, e.dataStart-e.start)
+			if _, err := archive.Seek(e.start, io.SeekStart); err != nil {
+				return err
+			}
+			if _, err := io.ReadFull(archive, header); err != nil {
+				return fmt.Errorf("reading header: %s: %w", e.hdr.Name, err)
+			}
+		}
+		segments = append(segments, segment{
+			header:   header,
+			offset:   offset,
+			dataFrom: e.dataStart,
+			dataLen:  e.end - e.dataStart,
+		})
+		offset += int64(len(header)) + e.end - e.dataStart
+	}
+	if err := rearrange(archive, segments); err != nil {
+		return err
+	}
+
+	// end the archive with two zero blocks, and remove what's left
+	if err := zeroData(archive, offset, offset+2*blockSize); err != nil {
+		return fmt.Errorf("writing end of archive: %w", err)
+	}
+	offset += 2 * blockSize
+	if tf, ok := archive.(truncater); ok && offset < size {
+		return tf.Truncate(offset)
+	}
+	return zeroData(archive, offset, size)
+}
+
 func (t Tar) Extract(ctx context.Context, sourceArchive io.Reader, handleFile FileHandler) error {
 	tr := tar.NewReader(sourceArchive)
 
@@ -250,4 +809,6 @@ var (
 	_ ArchiverAsync = (*Tar)(nil)
 	_ Extractor     = (*Tar)(nil)
 	_ Inserter      = (*Tar)(nil)
+	_ Deleter       = (*Tar)(nil)
+	_ Renamer       = (*Tar)(nil)
 )
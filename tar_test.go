@@ -0,0 +1,142 @@
+package archiver
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTarDelete(t *testing.T) {
+	testDelete(t, Tar{})
+}
+
+func TestTarDeleteHardLinkTarget(t *testing.T) {
+	archive := buildTar(t, []tarEntry{
+		{hdr: tar.Header{Name: "target.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "contents"},
+		{hdr: tar.Header{Name: "link1", Typeflag: tar.TypeLink, Linkname: "target.txt"}},
+		{hdr: tar.Header{Name: "other.txt", Typeflag: tar.TypeReg, Mode: 0644}, body: "other"},
+		{hdr: tar.Header{Name: "link2", Typeflag: tar.TypeLink, Linkname: "target.txt"}},
+		{hdr: tar.Header{Name: "link3", Typeflag: tar.TypeLink, Linkname: "link1"}},
+	})
+
+	// the entries as "name" for files and "name -> target" for hard links,
+	// with the contents of files
+	for _, tc := range []struct {
+		delete []string
+		expect []string
+	}{
+		{
+			delete: []string{"link1"},
+			expect: []string{"target.txt: contents", "other.txt: other", "link2 -> target.txt", "link3 -> target.txt"},
+		},
+		{
+			delete: []string{"target.txt"},
+			expect: []string{"link1: contents", "other.txt: other", "link2 -> link1", "link3 -> link1"},
+		},
+		{
+			delete: []string{"target.txt", "link1"},
+			expect: []string{"link2: contents", "other.txt: other", "link3 -> link2"},
+		},
+		{
+			delete: []string{"target.txt", "link1", "link2", "link3"},
+			expect: []string{"other.txt: other"},
+		},
+	} {
+		f, err := os.Create(filepath.Join(t.TempDir(), "archive.tar"))
+		checkErr(t, err, "creating archive")
+		defer f.Close()
+		_, err = f.Write(archive)
+		checkErr(t, err, "writing archive")
+		_, err = f.Seek(0, io.SeekStart)
+		checkErr(t, err, "seeking to start of archive")
+		checkErr(t, Tar{}.Delete(context.Background(), f, tc.delete), "deleting %v", tc.delete)
+
+		_, err = f.Seek(0, io.SeekStart)
+		checkErr(t, err, "seeking to start of archive")
+		var got []string
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			checkErr(t, err, "reading archive after deleting %v", tc.delete)
+			if hdr.Typeflag == tar.TypeLink {
+				got = append(got, hdr.Name+" -> "+hdr.Linkname)
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			checkErr(t, err, "reading %s", hdr.Name)
+			got = append(got, hdr.Name+": "+string(data))
+		}
+		if !reflect.DeepEqual(got, tc.expect) {
+			t.Errorf("deleting %v: expected %q but got %q", tc.delete, tc.expect, got)
+		}
+	}
+}
+
+func TestTarRename(t *testing.T) {
+	testRename(t, Tar{})
+}
+
+func TestTarCopyHeaders(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	headers := []*tar.Header{
+		{
+			Typeflag: tar.TypeReg, Name: "file.txt", Size: 5, Mode: 0640, ModTime: modTime,
+			Uid: 1000, Gid: 1001, Uname: "alice", Gname: "staff",
+			PAXRecords: map[string]string{"ARCHIVER.origin": "test", "SCHILY.xattr.user.note": "kept"},
+			Format:     tar.FormatPAX,
+		},
+		{
+			Typeflag: tar.TypeChar, Name: "dev/null", Mode: 0666, ModTime: modTime,
+			Devmajor: 1, Devminor: 3, Uname: "root", Gname: "root",
+			Format: tar.FormatGNU,
+		},
+		{
+			Typeflag: tar.TypeSymlink, Name: "link", Linkname: "file.txt", Mode: 0777, ModTime: modTime,
+			Format: tar.FormatUSTAR,
+		},
+	}
+	var src bytes.Buffer
+	tw := tar.NewWriter(&src)
+	for _, hdr := range headers {
+		checkErr(t, tw.WriteHeader(hdr), "writing header for %s", hdr.Name)
+		if hdr.Size > 0 {
+			_, err := tw.Write([]byte("hello"))
+			checkErr(t, err, "writing contents of %s", hdr.Name)
+		}
+	}
+	checkErr(t, tw.Close(), "closing source archive")
+
+	var dst bytes.Buffer
+	copyArchive(t, Tar{}, bytes.NewReader(src.Bytes()), Tar{}, &dst, nil)
+
+	readHeaders := func(archive []byte) []*tar.Header {
+		var hdrs []*tar.Header
+		tr := tar.NewReader(bytes.NewReader(archive))
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return hdrs
+			}
+			checkErr(t, err, "reading header")
+			hdrs = append(hdrs, hdr)
+		}
+	}
+	want, got := readHeaders(src.Bytes()), readHeaders(dst.Bytes())
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries but got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("entry %d: expected header %+v but got %+v", i, want[i], got[i])
+		}
+	}
+}
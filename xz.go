@@ -3,7 +3,10 @@ package archiver
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"slices"
 	"strings"
 
 	fastxz "github.com/therootcompany/xz"
@@ -49,6 +52,87 @@ func (Xz) OpenReader(r io.Reader) (io.ReadCloser, error) {
 	return io.NopCloser(xr), err
 }
 
+// members finds the xz streams in ra by working backward from the end,
+// since the index at the end of each stream records the sizes of the
+// blocks in it. See sections 2.1.2 and 4 of the xz file format spec.
+func (Xz) members(ra io.ReaderAt, size int64) ([]int64, error) {
+	const headerLen, footerLen = 12, 12
+
+	var offsets []int64
+	for end := size; end > 0; {
+		var footer [footerLen]byte
+		if end < int64(len(footer)) {
+			return nil, fmt.Errorf("stream ending at offset %d: %w", end, io.ErrUnexpectedEOF)
+		}
+		if _, err := ra.ReadAt(footer[:], end-int64(len(footer))); err != nil {
+			return nil, err
+		}
+		if bytes.Equal(footer[8:], []byte{0, 0, 0, 0}) {
+			end -= 4 // stream padding
+			continue
+		}
+		if !bytes.Equal(footer[10:], xzFooterMagic) {
+			return nil, fmt.Errorf("stream ending at offset %d: invalid stream footer", end)
+		}
+
+		indexLen := (int64(binary.LittleEndian.Uint32(footer[4:8])) + 1) * 4
+		indexStart := end - footerLen - indexLen
+		if indexStart < headerLen {
+			return nil, fmt.Errorf("stream ending at offset %d: invalid index size", end)
+		}
+		index := make([]byte, indexLen)
+		if _, err := ra.ReadAt(index, indexStart); err != nil {
+			return nil, err
+		}
+		blocksLen, err := xzBlocksLen(index)
+		if err != nil {
+			return nil, fmt.Errorf("stream ending at offset %d: %w", end, err)
+		}
+
+		start := indexStart - blocksLen - headerLen
+		header := make([]byte, len(xzHeader))
+		if start >= 0 {
+			if _, err := ra.ReadAt(header, start); err != nil {
+				return nil, err
+			}
+		}
+		if !bytes.Equal(header, xzHeader) {
+			return nil, fmt.Errorf("stream ending at offset %d: stream header not found", end)
+		}
+		offsets = append(offsets, start)
+		end = start
+	}
+	slices.Reverse(offsets)
+	return offsets, nil
+}
+
+// xzBlocksLen returns the total size of the blocks listed in an index.
+func xzBlocksLen(index []byte) (int64, error) {
+	if len(index) == 0 || index[0] != 0 {
+		return 0, fmt.Errorf("invalid index")
+	}
+	r := bytes.NewReader(index[1:])
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, fmt.Errorf("invalid index: %w", err)
+	}
+	var total int64
+	for ; count > 0; count-- {
+		unpadded, err := binary.ReadUvarint(r)
+		if err != nil {
+			return 0, fmt.Errorf("invalid index: %w", err)
+		}
+		if _, err := binary.ReadUvarint(r); err != nil { // uncompressed size
+			return 0, fmt.Errorf("invalid index: %w", err)
+		}
+		total += int64(unpadded+3) &^ 3
+	}
+	return total, nil
+}
+
+// magic number at the end of xz streams
+var xzFooterMagic = []byte{'Y', 'Z'}
+
 // magic number at the beginning of xz files; see section 2.1.1.1
 // of https://tukaani.org/xz/xz-file-format.txt
 var xzHeader = []byte{0xfd, 0x37, 0x7a, 0x58, 0x5a, 0x00}
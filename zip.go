@@ -2,18 +2,25 @@ package archiver
 
 import (
 	"bytes"
+	"cmp"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"log"
+	"math"
 	"path"
+	"slices"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	szip "github.com/STARRY-S/zip"
 
 	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/flate"
 	"github.com/klauspost/compress/zip"
 	"github.com/klauspost/compress/zstd"
 	"github.com/ulikunitz/xz"
@@ -29,38 +36,77 @@ import (
 func init() {
 	RegisterFormat(Zip{})
 
+	for method, comp := range zipCompressors {
+		zip.RegisterCompressor(method, comp)
+	}
+	for method, decomp := range zipDecompressors {
+		zip.RegisterDecompressor(method, decomp)
+	}
+}
+
+// zipCompressors are the compressors for the methods that are
+// not built into the zip package.
+var zipCompressors = map[uint16]zip.Compressor{
 	// TODO: What about custom flate levels too
-	zip.RegisterCompressor(ZipMethodBzip2, func(out io.Writer) (io.WriteCloser, error) {
+	ZipMethodBzip2: func(out io.Writer) (io.WriteCloser, error) {
 		return bzip2.NewWriter(out, &bzip2.WriterConfig{ /*TODO: Level: z.CompressionLevel*/ })
-	})
-	zip.RegisterCompressor(ZipMethodZstd, func(out io.Writer) (io.WriteCloser, error) {
+	},
+	ZipMethodZstd: func(out io.Writer) (io.WriteCloser, error) {
 		return zstd.NewWriter(out)
-	})
-	zip.RegisterCompressor(ZipMethodXz, func(out io.Writer) (io.WriteCloser, error) {
+	},
+	ZipMethodXz: func(out io.Writer) (io.WriteCloser, error) {
 		return xz.NewWriter(out)
-	})
+	},
+}
 
-	zip.RegisterDecompressor(ZipMethodBzip2, func(r io.Reader) io.ReadCloser {
+// zipDecompressors are the decompressors for the methods that
+// are not built into the zip package.
+var zipDecompressors = map[uint16]zip.Decompressor{
+	ZipMethodBzip2: func(r io.Reader) io.ReadCloser {
 		bz2r, err := bzip2.NewReader(r, nil)
 		if err != nil {
 			return nil
 		}
 		return bz2r
-	})
-	zip.RegisterDecompressor(ZipMethodZstd, func(r io.Reader) io.ReadCloser {
+	},
+	ZipMethodZstd: func(r io.Reader) io.ReadCloser {
 		zr, err := zstd.NewReader(r)
 		if err != nil {
 			return nil
 		}
 		return zr.IOReadCloser()
-	})
-	zip.RegisterDecompressor(ZipMethodXz, func(r io.Reader) io.ReadCloser {
+	},
+	ZipMethodXz: func(r io.Reader) io.ReadCloser {
 		xr, err := xz.NewReader(r)
 		if err != nil {
 			return nil
 		}
 		return io.NopCloser(xr)
-	})
+	},
+}
+
+// zipCompressor returns the compressor for method, or nil if there
+// is none. It is for compressing files that the zip package can't
+// compress itself, such as encrypted ones.
+func zipCompressor(method uint16) zip.Compressor {
+	switch method {
+	case zip.Store:
+		return func(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }
+	case zip.Deflate:
+		return func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, 5) }
+	}
+	return zipCompressors[method]
+}
+
+// zipDecompressor returns the decompressor for method, or nil if there is none.
+func zipDecompressor(method uint16) zip.Decompressor {
+	switch method {
+	case zip.Store:
+		return io.NopCloser
+	case zip.Deflate:
+		return flate.NewReader
+	}
+	return zipDecompressors[method]
 }
 
 type Zip struct {
@@ -81,6 +127,14 @@ type Zip struct {
 	// encoded filenames and comments, specify the character
 	// encoding here.
 	TextEncoding string
+
+	// The password for encrypted files. When extracting, files
+	// encrypted with WinZip AES or the traditional PKWARE
+	// encryption (ZipCrypto) can be decrypted with it. When
+	// creating archives, files are encrypted with AES-256; files
+	// from other zip archives that are already encrypted with AES
+	// and the same password are copied without decrypting them.
+	Password string
 }
 
 func (z Zip) Extension() string { return ".zip" }
@@ -134,22 +188,85 @@ func (z Zip) archiveOneFile(ctx context.Context, zw *zip.Writer, idx int, file F
 		return err // honor context cancellation
 	}
 
-	hdr, err := zip.FileInfoHeader(file)
+	hdr, err := z.fileHeader(file)
 	if err != nil {
 		return fmt.Errorf("getting info for file %d: %s: %w", idx, file.Name(), err)
 	}
-	hdr.Name = file.NameInArchive // complete path, since FileInfoHeader() only has base name
-	if hdr.Name == "" {
-		hdr.Name = file.Name() // assume base name of file I guess
+
+	// entries of other zip archives are copied without recompressing them
+	if copied, err := z.copyRawEntry(zw, hdr, file); copied || err != nil {
+		if err != nil {
+			return fmt.Errorf("copying file %d: %s: %w", idx, file.Name(), err)
+		}
+		return nil
 	}
 
-	// customize header based on file properties
+	if z.Password != "" && !file.IsDir() {
+		if err := z.writeEncrypted(zw, hdr, file); err != nil {
+			return fmt.Errorf("writing encrypted file %d: %s: %w", idx, file.Name(), err)
+		}
+		return nil
+	}
+
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return fmt.Errorf("creating header for file %d: %s: %w", idx, file.Name(), err)
+	}
+
+	// directories have no file body
 	if file.IsDir() {
-		if !strings.HasSuffix(hdr.Name, "/") {
-			hdr.Name += "/" // required
+		return nil
+	}
+	if err := writeZipFileBody(file, w); err != nil {
+		return fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), err)
+	}
+
+	return nil
+}
+
+// fileHeader returns the header with which to write file into an archive.
+// If file has a zip header, as files extracted from zip archives do, that
+// header is used (with the name in the archive) so that copying entries
+// between zip archives is lossless; only what depends on how the entry
+// is written, like its sizes and encryption, is left to be redone.
+// Otherwise, the header is made from the file's info.
+func (z Zip) fileHeader(file FileInfo) (*zip.FileHeader, error) {
+	var hdr *zip.FileHeader
+	switch h := file.Header.(type) {
+	case zip.FileHeader:
+		hdr = copyZipHeader(h)
+	case *zip.FileHeader:
+		hdr = copyZipHeader(*h)
+	}
+	copied := hdr != nil
+	if !copied {
+		var err error
+		hdr, err = zip.FileInfoHeader(file)
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	name := file.NameInArchive // complete path, since FileInfoHeader() only has base name
+	if name == "" {
+		name = file.Name() // assume base name of file I guess
+	}
+	if file.IsDir() && !strings.HasSuffix(name, "/") {
+		name += "/" // required
+	}
+	if copied && name != hdr.Name {
+		// a Unicode Path extra field would take precedence over the new name
+		hdr.Extra = withoutZipExtras(hdr.Extra, zipUnicodePathExtraID)
+	}
+	hdr.Name = name
+
+	// customize header based on file properties
+	switch {
+	case file.IsDir():
 		hdr.Method = zip.Store
-	} else if z.SelectiveCompression {
+	case copied && zipWritableMethods[hdr.Method]:
+		// keep the method of the copied entry
+	case z.SelectiveCompression:
 		// only enable compression on compressable files
 		ext := strings.ToLower(path.Ext(hdr.Name))
 		if _, ok := compressedFormats[ext]; ok {
@@ -157,26 +274,197 @@ func (z Zip) archiveOneFile(ctx context.Context, zw *zip.Writer, idx int, file F
 		} else {
 			hdr.Method = z.Compression
 		}
-	} else {
+	default:
 		hdr.Method = z.Compression
 	}
 
-	w, err := zw.CreateHeader(hdr)
+	return hdr, nil
+}
+
+// copyZipHeader returns a copy of hdr, which was read from an archive,
+// that can be written to another. Its modification time is given only by
+// the fields and extra fields it was read from, which are written as they
+// are, except for the zip64 extra field which is written as needed.
+func copyZipHeader(hdr zip.FileHeader) *zip.FileHeader {
+	hdr.Modified = time.Time{}
+	if hdr.Method == zipMethodAES {
+		if aesInfo, err := parseZipAESExtra(hdr.Extra); err == nil {
+			hdr.Method = aesInfo.method
+		}
+	}
+	hdr.Extra = withoutZipExtras(hdr.Extra, zip64ExtraID, zipAESExtraID)
+	hdr.Flags &^= 0x1 | 0x8 | 0x40 // encryption and data descriptor are up to the writer
+	return &hdr
+}
+
+// withoutZipExtras returns a copy of the extra fields, without those
+// with the given IDs.
+func withoutZipExtras(extra []byte, ids ...uint16) []byte {
+	var newExtra []byte
+	for pos := 0; pos+4 <= len(extra); {
+		end := min(pos+4+int(binary.LittleEndian.Uint16(extra[pos+2:])), len(extra))
+		if !slices.Contains(ids, binary.LittleEndian.Uint16(extra[pos:])) {
+			newExtra = append(newExtra, extra[pos:end]...)
+		}
+		pos = end
+	}
+	return newExtra
+}
+
+// zipWritableMethods are the compression methods that can be written.
+var zipWritableMethods = map[uint16]bool{
+	zip.Store:      true,
+	zip.Deflate:    true,
+	ZipMethodBzip2: true,
+	ZipMethodZstd:  true,
+	ZipMethodXz:    true,
+}
+
+// copyRawEntry writes file to zw with the header hdr if file is an
+// entry extracted from another zip archive, as is, by copying its
+// compressed contents. This is much faster than recompressing them,
+// and it keeps them encrypted if they are encrypted with AES, as long as
+// the password is the same as that of the archive they were extracted
+// from. It returns false if file is not such an entry, if its contents
+// were replaced, or if they are to be encrypted differently: contents
+// encrypted with the weak traditional PKWARE encryption (ZipCrypto) are
+// encrypted again with AES-256 if a password is set. (Without one, they
+// can't be decrypted, so they are copied as they are.)
+func (z Zip) copyRawEntry(zw *zip.Writer, hdr *zip.FileHeader, file FileInfo) (bool, error) {
+	switch file.Header.(type) {
+	case zip.FileHeader, *zip.FileHeader:
+	default:
+		return false, nil
+	}
+	if file.IsDir() || file.Open == nil {
+		return false, nil
+	}
+	f, err := file.Open()
 	if err != nil {
-		return fmt.Errorf("creating header for file %d: %s: %w", idx, file.Name(), err)
+		return false, err
+	}
+	defer f.Close()
+	entry, ok := f.(zipEntry)
+	if !ok {
+		return false, nil
+	}
+	src := entry.file.FileHeader
+	if encrypted := src.Flags&0x1 != 0; encrypted && entry.password != z.Password ||
+		encrypted && z.Password != "" && src.Method != zipMethodAES ||
+		!encrypted && z.Password != "" {
+		return false, nil
 	}
 
-	// directories have no file body
-	if file.IsDir() {
-		return nil
+	raw, err := entry.file.OpenRaw()
+	if err != nil {
+		return false, err
 	}
-	if err := openAndCopyFile(file, w); err != nil {
-		return fmt.Errorf("writing file %d: %s: %w", idx, file.Name(), err)
+	// the contents decide how they are to be read
+	hdr.Method = src.Method
+	hdr.Flags = src.Flags
+	if src.Method == zipMethodAES {
+		hdr.Extra = append(hdr.Extra, zipExtraField(src.Extra, zipAESExtraID)...)
+	}
+	setZipUTF8Flag(hdr)
+	hdr.CRC32 = src.CRC32
+	hdr.CompressedSize64 = src.CompressedSize64
+	hdr.UncompressedSize64 = src.UncompressedSize64
+	w, err := zw.CreateRaw(hdr)
+	if err != nil {
+		return true, err
+	}
+	_, err = io.Copy(w, raw)
+	return true, err
+}
+
+// setZipUTF8Flag sets the UTF-8 flag of hdr if its name or comment need it.
+// Unlike CreateHeader, CreateRaw doesn't do this for us.
+func setZipUTF8Flag(hdr *zip.FileHeader) {
+	hdr.Flags &^= 0x800
+	if !hdr.NonUTF8 && (!isASCII(hdr.Name) || !isASCII(hdr.Comment)) &&
+		utf8.ValidString(hdr.Name) && utf8.ValidString(hdr.Comment) {
+		hdr.Flags |= 0x800
 	}
+}
 
+// writeEncrypted writes file to zw with the header hdr, compressed with
+// the method of hdr, then encrypted with WinZip AES-256 (AE-2). Since the
+// zip package can't encrypt, this writes the compressed contents itself.
+func (z Zip) writeEncrypted(zw *zip.Writer, hdr *zip.FileHeader, file FileInfo) error {
+	comp := zipCompressor(hdr.Method)
+	if comp == nil {
+		return zip.ErrAlgorithm
+	}
+	// AE-2 leaves out the CRC, which could give away the contents of small files
+	aesInfo := zipAESExtra{version: 2, strength: 3, method: hdr.Method}
+	hdr.Extra = append(hdr.Extra, aesInfo.encode()...)
+	hdr.Method = zipMethodAES
+	hdr.Flags |= 0x1 | 0x8 // the sizes come after the contents
+	hdr.ReaderVersion = 51 // AES encryption
+	hdr.CRC32 = 0
+	setZipUTF8Flag(hdr)
+	if !hdr.Modified.IsZero() {
+		// as CreateHeader does, but CreateRaw doesn't, add the extended timestamp
+		ext := binary.LittleEndian.AppendUint16(nil, zipExtTimeExtraID)
+		ext = binary.LittleEndian.AppendUint16(ext, 5)
+		ext = append(ext, 1) // only the modification time
+		hdr.Extra = binary.LittleEndian.AppendUint32(append(hdr.Extra, ext...), uint32(hdr.Modified.Unix()))
+	}
+
+	w, err := zw.CreateRaw(hdr)
+	if err != nil {
+		return err
+	}
+	aw, err := newZipAESWriter(w, z.Password)
+	if err != nil {
+		return err
+	}
+	cw, err := comp(aw)
+	if err != nil {
+		return err
+	}
+	body := &writeCounter{w: cw}
+	if err := writeZipFileBody(file, body); err != nil {
+		cw.Close()
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+	if err := aw.Close(); err != nil {
+		return err
+	}
+
+	// the data descriptor is written with these sizes
+	// when the next file is created or zw is closed
+	hdr.CompressedSize64 = uint64(aw.n)
+	hdr.UncompressedSize64 = uint64(body.n)
+	hdr.CompressedSize = uint32(min(hdr.CompressedSize64, math.MaxUint32))
+	hdr.UncompressedSize = uint32(min(hdr.UncompressedSize64, math.MaxUint32))
 	return nil
 }
 
+// zipEntry is a file opened from a zip archive. It keeps the
+// entry so that its compressed contents can be copied as they
+// are, and the password with which they would be decrypted.
+type zipEntry struct {
+	fileInArchive
+	file     *zip.File
+	password string
+}
+
+// writeZipFileBody writes the contents of file to w. Zip stores the
+// target of a symlink as its file contents, so if the target is known,
+// that is written instead of the contents of the file (which, when
+// opened, might be the contents of the file that the link points to).
+func writeZipFileBody(file FileInfo, w io.Writer) error {
+	if isSymlink(file) && file.LinkTarget != "" {
+		_, err := io.WriteString(w, file.LinkTarget)
+		return err
+	}
+	return openAndCopyFile(file, w)
+}
+
 // Extract extracts files from z, implementing the Extractor interface. Uniquely, however,
 // sourceArchive must be an io.ReaderAt and io.Seeker, which are oddly disjoint interfaces
 // from io.Reader which is what the method signature requires. We chose this signature for
@@ -220,15 +508,25 @@ func (z Zip) Extract(ctx context.Context, sourceArchive io.Reader, handleFile Fi
 			FileInfo:      info,
 			Header:        f.FileHeader,
 			NameInArchive: f.Name,
+			Encrypted:     f.Flags&0x1 != 0,
 			Open: func() (fs.File, error) {
-				openedFile, err := f.Open()
+				openedFile, err := z.openFile(f)
 				if err != nil {
 					return nil, err
 				}
-				return fileInArchive{openedFile, info}, nil
+				return zipEntry{fileInArchive{openedFile, info}, f, z.Password}, nil
 			},
 		}
 
+		// zip stores the target of a symlink as its file contents,
+		// which can't be read if they're encrypted without a password
+		if isSymlink(info) && (!file.Encrypted || z.Password != "") {
+			file.LinkTarget, err = z.readLinkTarget(f)
+			if err != nil {
+				return fmt.Errorf("reading link target of file %d: %s: %w", i, f.Name, err)
+			}
+		}
+
 		err := handleFile(ctx, file)
 		if errors.Is(err, fs.SkipAll) {
 			break
@@ -251,26 +549,584 @@ func (z Zip) Extract(ctx context.Context, sourceArchive io.Reader, handleFile Fi
 	return nil
 }
 
+// Delete deletes the named files from the zip archive, implementing the
+// Deleter interface. The entries after the deleted ones are moved up to
+// take their place, without being recompressed, and the central directory
+// is rewritten after them. If the archive has a Truncate method, as
+// *os.File does, it is truncated to its new size; otherwise, the central
+// directory is written at the end of the archive with zeros before it.
+func (z Zip) Delete(ctx context.Context, archive io.ReadWriteSeeker, toDeleteNames []string) error {
+	if len(toDeleteNames) == 0 {
+		return nil
+	}
+
+	dir, names, size, err := z.readDirectory(archive)
+	if err != nil {
+		return err
+	}
+	toDelete := newDeletionList(toDeleteNames)
+	for i, name := range names {
+		dir.records[i].delete = toDelete.includes(name)
+	}
+	if err := toDelete.notFound(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+
+	// move the remaining files up; the archive now gets modified,
+	// so there's no turning back for context cancellation
+	buf := make([]byte, 32*1024)
+	offset := int64(-1)
+	for _, rec := range dir.byOffset() {
+		start, end := dir.base+rec.offset, dir.base+rec.end
+		if rec.delete {
+			if offset < 0 {
+				offset = start
+			}
+			continue
+		}
+		if offset < 0 {
+			continue // nothing to move until the first deleted file
+		}
+		if err := moveData(archive, offset, start, end-start, buf); err != nil {
+			return fmt.Errorf("moving file at offset %d: %w", start, err)
+		}
+		rec.setOffset(offset - dir.base)
+		offset += end - start
+	}
+
+	return dir.write(archive, offset, size)
+}
+
+// Rename renames files in the zip archive, implementing the Renamer
+// interface. The local and central directory headers of the renamed
+// files are rewritten, and the files after the first renamed one are
+// moved to make room for their new names, without being recompressed.
+// If the archive shrinks and has a Truncate method, as *os.File does,
+// it is truncated to its new size; otherwise, the central directory is
+// written at the end of the archive with zeros before it.
+func (z Zip) Rename(ctx context.Context, archive io.ReadWriteSeeker, renames map[string]string) error {
+	if len(renames) == 0 {
+		return nil
+	}
+
+	dir, names, size, err := z.readDirectory(archive)
+	if err != nil {
+		return err
+	}
+	toRename := newRenameList(renames)
+	newNames := make([]string, len(names))
+	renamed := make([]bool, len(names))
+	count := make(map[string]int)
+	for i, name := range names {
+		newNames[i], renamed[i] = toRename.rename(name)
+		dir.records[i].delete = newNames[i] == "" // moved to the root
+		count[strings.TrimSuffix(newNames[i], "/")]++
+	}
+	if err := toRename.notFound(); err != nil {
+		return err
+	}
+	for i, name := range names {
+		if renamed[i] && newNames[i] != "" && count[strings.TrimSuffix(newNames[i], "/")] > 1 {
+			return fmt.Errorf("renaming file: %s to %s: %w", name, newNames[i], fs.ErrExist)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err // honor context cancellation
+	}
+
+	// lay out the files from the first renamed one onward, with new
+	// local headers for the renamed ones
+	byOffset := dir.byOffset()
+	first := slices.IndexFunc(byOffset, func(rec *zipDirRecord) bool { return renamed[rec.index] })
+	offset := dir.base + byOffset[first].offset
+	var segments []segment
+	for _, rec := range byOffset[first:] {
+		if rec.delete {
+			continue
+		}
+		start, end := dir.base+rec.offset, dir.base+rec.end
+		header, err := readZipLocalHeader(archive, start)
+		if err != nil {
+			return fmt.Errorf("reading local file header: %s: %w", names[rec.index], err)
+		}
+		dataFrom := start + int64(len(header))
+		if renamed[rec.index] {
+			header = renameZipHeader(header, false, newNames[rec.index])
+			if err := rec.rename(newNames[rec.index]); err != nil {
+				return fmt.Errorf("renaming file: %s: %w", names[rec.index], err)
+			}
+		}
+		segments = append(segments, segment{
+			header:   header,
+			offset:   offset,
+			dataFrom: dataFrom,
+			dataLen:  end - dataFrom,
+		})
+		rec.setOffset(offset - dir.base)
+		offset += int64(len(header)) + end - dataFrom
+	}
+
+	// the archive now gets modified, so there's no
+	// turning back for context cancellation
+	if err := rearrange(archive, segments); err != nil {
+		return err
+	}
+	return dir.write(archive, offset, size)
+}
+
+// readDirectory reads the central directory of the zip archive and
+// returns it along with the decoded file names of its records, and
+// the size of the archive.
+func (z Zip) readDirectory(archive io.ReadWriteSeeker) (*zipDirectory, []string, int64, error) {
+	size, err := archive.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	ra, ok := archive.(io.ReaderAt)
+	if !ok {
+		ra = seekerReaderAt{archive}
+	}
+
+	// the zip package validates the archive and decodes the file names,
+	// but doesn't expose where the files are, so we read that ourselves
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	dir, err := readZipDirectory(ra, size)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("reading central directory: %w", err)
+	}
+	if len(dir.records) != len(zr.File) {
+		return nil, nil, 0, fmt.Errorf("central directory has %d records, but %d files were read", len(dir.records), len(zr.File))
+	}
+	names := make([]string, len(zr.File))
+	for i, f := range zr.File {
+		z.decodeText(&f.FileHeader)
+		names[i] = f.Name
+	}
+	return dir, names, size, nil
+}
+
+// zipDirectory is the central directory of a zip archive, along with the
+// end of central directory records, parsed only as much as is needed to
+// move the files in the archive.
+type zipDirectory struct {
+	base     int64 // start of the zip archive proper, after any prefix
+	offset   int64 // offset of the central directory, relative to base
+	records  []zipDirRecord
+	end64    []byte // zip64 end of central directory record and locator, if any
+	end64Pos int64  // original offset of end64 in the archive
+	end      []byte // end of central directory record, with the comment
+}
+
+// zipDirRecord is a file header in the central directory.
+type zipDirRecord struct {
+	raw      []byte
+	index    int   // position in the central directory
+	offset   int64 // offset of the local file header, relative to the base
+	end      int64 // offset of the end of the file's data, relative to the base
+	offsetAt int   // position of the offset in raw
+	offset64 bool  // whether the offset is in a zip64 extra field
+	delete   bool
+}
+
+// byOffset returns the records in the order of their files in the
+// archive, with the end of each file set to the start of the next,
+// or the start of the central directory for the last one.
+func (dir *zipDirectory) byOffset() []*zipDirRecord {
+	recs := make([]*zipDirRecord, len(dir.records))
+	for i := range dir.records {
+		recs[i] = &dir.records[i]
+	}
+	slices.SortStableFunc(recs, func(a, b *zipDirRecord) int { return cmp.Compare(a.offset, b.offset) })
+	for i, rec := range recs {
+		rec.end = dir.offset
+		if i < len(recs)-1 {
+			rec.end = recs[i+1].offset
+		}
+	}
+	return recs
+}
+
+// write writes the central directory after the files, which end at
+// offset, in the archive of the given size. If the archive can be
+// truncated, it is; otherwise, the central directory is written at
+// the end with zeros before it, if there is room.
+func (dir *zipDirectory) write(archive io.WriteSeeker, offset, size int64) error {
+	tf, canTruncate := archive.(truncater)
+	dirStart := offset
+	if !canTruncate {
+		dirStart = max(offset, size-int64(dir.len()))
+	}
+	tail := dir.encode(dirStart)
+	if err := zeroData(archive, offset, dirStart); err != nil {
+		return err
+	}
+	if _, err := archive.Seek(dirStart, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := archive.Write(tail); err != nil {
+		return fmt.Errorf("writing central directory: %w", err)
+	}
+	if newSize := dirStart + int64(len(tail)); canTruncate && newSize < size {
+		return tf.Truncate(newSize)
+	}
+	return nil
+}
+
+// readZipLocalHeader reads the local file header at offset.
+func readZipLocalHeader(r io.ReadSeeker, offset int64) ([]byte, error) {
+	const localHeaderLen = 30
+	fixed := make([]byte, localHeaderLen)
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	if string(fixed[:4]) != "PK\x03\x04" {
+		return nil, zip.ErrFormat
+	}
+	nameLen := int(binary.LittleEndian.Uint16(fixed[26:]))
+	extraLen := int(binary.LittleEndian.Uint16(fixed[28:]))
+	header := append(fixed, make([]byte, nameLen+extraLen)...)
+	if _, err := io.ReadFull(r, header[localHeaderLen:]); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// renameZipHeader returns a copy of the local or central directory file
+// header raw with the file name changed to name, which is encoded as
+// UTF-8. Any Info-ZIP Unicode Path extra field is removed, since it
+// would otherwise take precedence over the new name.
+func renameZipHeader(raw []byte, central bool, name string) []byte {
+	fixedLen, flagsAt, nameLenAt := 30, 6, 26
+	if central {
+		fixedLen, flagsAt, nameLenAt = zipDirRecordLen, 8, 28
+	}
+	nameLen := int(binary.LittleEndian.Uint16(raw[nameLenAt:]))
+	extraLen := int(binary.LittleEndian.Uint16(raw[nameLenAt+2:]))
+	extra := raw[fixedLen+nameLen : fixedLen+nameLen+extraLen]
+	rest := raw[fixedLen+nameLen+extraLen:] // the comment, in the central directory
+
+	newExtra := withoutZipExtras(extra, zipUnicodePathExtraID)
+
+	header := make([]byte, 0, fixedLen+len(name)+len(newExtra)+len(rest))
+	header = append(header, raw[:fixedLen]...)
+	if !isASCII(name) {
+		flags := binary.LittleEndian.Uint16(header[flagsAt:])
+		binary.LittleEndian.PutUint16(header[flagsAt:], flags|0x800) // UTF-8
+	}
+	binary.LittleEndian.PutUint16(header[nameLenAt:], uint16(len(name)))
+	binary.LittleEndian.PutUint16(header[nameLenAt+2:], uint16(len(newExtra)))
+	header = append(header, name...)
+	header = append(header, newExtra...)
+	return append(header, rest...)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Zip header constants needed for modifying archives in place.
+const (
+	zipDirRecordLen       = 46
+	zip64ExtraID          = 0x0001
+	zipUnicodePathExtraID = 0x7075
+	zipExtTimeExtraID     = 0x5455
+)
+
+// newZipDirRecord parses the central directory file header raw.
+func newZipDirRecord(raw []byte) (zipDirRecord, error) {
+	nameLen := int(binary.LittleEndian.Uint16(raw[28:]))
+	extraLen := int(binary.LittleEndian.Uint16(raw[30:]))
+	rec := zipDirRecord{
+		raw:      raw,
+		offset:   int64(binary.LittleEndian.Uint32(raw[42:])),
+		offsetAt: 42,
+	}
+	if rec.offset != 0xffffffff {
+		return rec, nil
+	}
+
+	// the offset is in the zip64 extra field, after the sizes if they are there too
+	extraStart := zipDirRecordLen + nameLen
+	extra := raw[extraStart : extraStart+extraLen]
+	for pos := 0; pos+4 <= len(extra); {
+		id, fieldLen := binary.LittleEndian.Uint16(extra[pos:]), int(binary.LittleEndian.Uint16(extra[pos+2:]))
+		field := pos + 4
+		pos = field + fieldLen
+		if id != zip64ExtraID {
+			continue
+		}
+		if binary.LittleEndian.Uint32(raw[24:]) == 0xffffffff {
+			field += 8
+		}
+		if binary.LittleEndian.Uint32(raw[20:]) == 0xffffffff {
+			field += 8
+		}
+		if field+8 > pos || pos > len(extra) {
+			break
+		}
+		rec.offset = int64(binary.LittleEndian.Uint64(extra[field:]))
+		rec.offsetAt = extraStart + field
+		rec.offset64 = true
+		return rec, nil
+	}
+	return rec, zip.ErrFormat
+}
+
+// rename changes the file name in the record to name.
+func (rec *zipDirRecord) rename(name string) error {
+	renamed, err := newZipDirRecord(renameZipHeader(rec.raw, true, name))
+	if err != nil {
+		return err
+	}
+	rec.raw, rec.offsetAt = renamed.raw, renamed.offsetAt
+	return nil
+}
+
+func (rec *zipDirRecord) setOffset(offset int64) {
+	rec.offset = offset
+	if rec.offset64 {
+		binary.LittleEndian.PutUint64(rec.raw[rec.offsetAt:], uint64(offset))
+	} else {
+		binary.LittleEndian.PutUint32(rec.raw[rec.offsetAt:], uint32(offset))
+	}
+}
+
+// readZipDirectory reads the central directory of the zip archive of the
+// given size, following the same rules as the zip package for locating it.
+func readZipDirectory(r io.ReaderAt, size int64) (*zipDirectory, error) {
+	const (
+		endLen   = 22
+		locLen   = 20
+		end64Len = 56
+		max16    = 0xffff
+	)
+
+	// the end of central directory record is followed by a comment of up to 64 KiB
+	tailLen := min(size, endLen+max16)
+	tail := make([]byte, tailLen)
+	if _, err := r.ReadAt(tail, size-tailLen); err != nil {
+		return nil, err
+	}
+	endPos := -1
+	for i := len(tail) - endLen; i >= 0; i-- {
+		if string(tail[i:i+4]) == "PK\x05\x06" {
+			commentLen := int(binary.LittleEndian.Uint16(tail[i+20:]))
+			if i+endLen+commentLen <= len(tail) {
+				endPos = i
+				break
+			}
+		}
+	}
+	if endPos < 0 {
+		return nil, zip.ErrFormat
+	}
+	dir := &zipDirectory{end: bytes.Clone(tail[endPos : endPos+endLen+int(binary.LittleEndian.Uint16(tail[endPos+20:]))])}
+	dirEnd := size - tailLen + int64(endPos)
+	dirSize := int64(binary.LittleEndian.Uint32(dir.end[12:]))
+	dir.offset = int64(binary.LittleEndian.Uint32(dir.end[16:]))
+
+	// a zip64 end of central directory record takes precedence
+	if endPos >= locLen && string(tail[endPos-locLen:endPos-locLen+4]) == "PK\x06\x07" {
+		loc := tail[endPos-locLen : endPos]
+		end64Pos := int64(binary.LittleEndian.Uint64(loc[8:]))
+		end64 := make([]byte, end64Len)
+		if end64Pos < 0 || end64Pos+end64Len > dirEnd {
+			return nil, zip.ErrFormat
+		}
+		if _, err := r.ReadAt(end64, end64Pos); err != nil {
+			return nil, err
+		}
+		if string(end64[:4]) != "PK\x06\x06" {
+			return nil, zip.ErrFormat
+		}
+		// keep any extensible data and the locator after the record
+		end64 = make([]byte, dirEnd-end64Pos)
+		if _, err := r.ReadAt(end64, end64Pos); err != nil {
+			return nil, err
+		}
+		dir.end64, dir.end64Pos = end64, end64Pos
+		dirEnd = end64Pos
+		dirSize = int64(binary.LittleEndian.Uint64(end64[40:]))
+		dir.offset = int64(binary.LittleEndian.Uint64(end64[48:]))
+	}
+
+	dir.base = dirEnd - dirSize - dir.offset
+	if dir.base < 0 || dirSize < 0 || dir.offset < 0 {
+		return nil, zip.ErrFormat
+	}
+	central := make([]byte, dirSize)
+	if _, err := r.ReadAt(central, dir.base+dir.offset); err != nil {
+		return nil, err
+	}
+	for len(central) >= zipDirRecordLen && string(central[:4]) == "PK\x01\x02" {
+		nameLen := int(binary.LittleEndian.Uint16(central[28:]))
+		extraLen := int(binary.LittleEndian.Uint16(central[30:]))
+		commentLen := int(binary.LittleEndian.Uint16(central[32:]))
+		n := zipDirRecordLen + nameLen + extraLen + commentLen
+		if n > len(central) {
+			return nil, zip.ErrFormat
+		}
+		rec, err := newZipDirRecord(central[:n:n])
+		if err != nil {
+			return nil, err
+		}
+		rec.index = len(dir.records)
+		dir.records = append(dir.records, rec)
+		central = central[n:]
+	}
+
+	return dir, nil
+}
+
+// len returns the length of the encoded directory.
+func (dir *zipDirectory) len() int {
+	n := len(dir.end64) + len(dir.end)
+	for _, rec := range dir.records {
+		if !rec.delete {
+			n += len(rec.raw)
+		}
+	}
+	return n
+}
+
+// encode returns the central directory of the files that aren't
+// deleted, followed by the end records, as they would be written at
+// the given offset of the archive.
+func (dir *zipDirectory) encode(offset int64) []byte {
+	const max16, max32 = 0xffff, 0xffffffff
+
+	buf := make([]byte, 0, dir.len())
+	var records int
+	for _, rec := range dir.records {
+		if !rec.delete {
+			buf = append(buf, rec.raw...)
+			records++
+		}
+	}
+	dirSize, dirOffset := len(buf), offset-dir.base
+
+	if dir.end64 != nil {
+		end64 := bytes.Clone(dir.end64)
+		binary.LittleEndian.PutUint64(end64[24:], uint64(records))
+		binary.LittleEndian.PutUint64(end64[32:], uint64(records))
+		binary.LittleEndian.PutUint64(end64[40:], uint64(dirSize))
+		binary.LittleEndian.PutUint64(end64[48:], uint64(dirOffset))
+		// the locator points to the zip64 record, which has moved
+		loc := end64[len(end64)-20:]
+		newPos := int64(binary.LittleEndian.Uint64(loc[8:])) - dir.end64Pos + offset + int64(dirSize)
+		binary.LittleEndian.PutUint64(loc[8:], uint64(newPos))
+		buf = append(buf, end64...)
+	}
+
+	// fields that defer to the zip64 record stay that way
+	end := bytes.Clone(dir.end)
+	for _, f := range []struct {
+		pos, size int
+		val       int64
+	}{
+		{8, 2, int64(records)},
+		{10, 2, int64(records)},
+		{12, 4, int64(dirSize)},
+		{16, 4, dirOffset},
+	} {
+		if f.size == 2 && binary.LittleEndian.Uint16(end[f.pos:]) != max16 {
+			binary.LittleEndian.PutUint16(end[f.pos:], uint16(f.val))
+		}
+		if f.size == 4 && binary.LittleEndian.Uint32(end[f.pos:]) != max32 {
+			binary.LittleEndian.PutUint32(end[f.pos:], uint32(f.val))
+		}
+	}
+	return append(buf, end...)
+}
+
+// openFile opens f for reading its contents, decrypting them if needed.
+// Encrypted files are decrypted once they are read, so that they can be
+// opened, and copied as they are, without the password.
+func (z Zip) openFile(f *zip.File) (io.ReadCloser, error) {
+	if f.Flags&0x1 != 0 {
+		return &zipDecryptingReader{file: f, password: z.Password}, nil
+	}
+	return f.Open()
+}
+
+// zipDecryptingReader reads the decrypted contents of an encrypted
+// file, which is opened on the first read.
+type zipDecryptingReader struct {
+	file     *zip.File
+	password string
+	rc       io.ReadCloser
+	err      error
+}
+
+func (r *zipDecryptingReader) Read(p []byte) (int, error) {
+	if r.rc == nil && r.err == nil {
+		r.rc, r.err = openEncryptedZipFile(r.file, r.password)
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.rc.Read(p)
+}
+
+func (r *zipDecryptingReader) Close() error {
+	if r.rc == nil {
+		return nil
+	}
+	return r.rc.Close()
+}
+
+func (z Zip) readLinkTarget(f *zip.File) (string, error) {
+	rc, err := z.openFile(f)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return linkTargetFromBody(rc)
+}
+
 // decodeText decodes the name and comment fields from hdr into UTF-8.
 // It is a no-op if the text is already UTF-8 encoded or if z.TextEncoding
-// is not specified.
+// is not specified. Once both are decoded, hdr is no longer marked as
+// non-UTF-8, so that it can be written to another archive as it is.
 func (z Zip) decodeText(hdr *zip.FileHeader) {
 	if hdr.NonUTF8 && z.TextEncoding != "" {
 		filename, err := decodeText(hdr.Name, z.TextEncoding)
 		if err == nil {
 			hdr.Name = filename
 		}
+		decoded := err == nil
 		if hdr.Comment != "" {
 			comment, err := decodeText(hdr.Comment, z.TextEncoding)
 			if err == nil {
 				hdr.Comment = comment
 			}
+			decoded = decoded && err == nil
 		}
+		hdr.NonUTF8 = !decoded
 	}
 }
 
 // Insert appends the listed files into the provided Zip archive stream.
+// Encrypted files can't be inserted, so Password must not be set.
 func (z Zip) Insert(ctx context.Context, into io.ReadWriteSeeker, files []FileInfo) error {
+	if z.Password != "" {
+		return fmt.Errorf("inserting encrypted files is not supported")
+	}
+
 	// following very simple example at https://github.com/STARRY-S/zip?tab=readme-ov-file#usage
 	zu, err := szip.NewUpdater(into)
 	if err != nil {
@@ -283,41 +1139,21 @@ func (z Zip) Insert(ctx context.Context, into io.ReadWriteSeeker, files []FileIn
 			return err // honor context cancellation
 		}
 
-		hdr, err := szip.FileInfoHeader(file)
+		hdr, err := z.fileHeader(file)
 		if err != nil {
 			return fmt.Errorf("getting info for file %d: %s: %w", idx, file.NameInArchive, err)
 		}
-		hdr.Name = file.NameInArchive // complete path, since FileInfoHeader() only has base name
-		if hdr.Name == "" {
-			hdr.Name = file.Name() // assume base name of file I guess
-		}
-
-		// customize header based on file properties
-		if file.IsDir() {
-			if !strings.HasSuffix(hdr.Name, "/") {
-				hdr.Name += "/" // required
-			}
-			hdr.Method = zip.Store
-		} else if z.SelectiveCompression {
-			// only enable compression on compressable files
-			ext := strings.ToLower(path.Ext(hdr.Name))
-			if _, ok := compressedFormats[ext]; ok {
-				hdr.Method = zip.Store
-			} else {
-				hdr.Method = z.Compression
-			}
-		}
 
-		w, err := zu.Append(hdr.Name, szip.APPEND_MODE_OVERWRITE)
+		w, err := zu.AppendHeader(szipFileHeader(hdr), szip.APPEND_MODE_OVERWRITE)
 		if err != nil {
 			return fmt.Errorf("inserting file header: %d: %s: %w", idx, file.Name(), err)
 		}
 
 		// directories have no file body
 		if file.IsDir() {
-			return nil
+			continue
 		}
-		if err := openAndCopyFile(file, w); err != nil {
+		if err := writeZipFileBody(file, w); err != nil {
 			if z.ContinueOnError && ctx.Err() == nil {
 				log.Printf("[ERROR] appending file %d into archive: %s: %v", idx, file.Name(), err)
 				continue
@@ -329,6 +1165,30 @@ func (z Zip) Insert(ctx context.Context, into io.ReadWriteSeeker, files []FileIn
 	return nil
 }
 
+// szipFileHeader returns hdr as a header of the zip package that
+// Insert uses, which is a separate type with the same fields.
+func szipFileHeader(hdr *zip.FileHeader) *szip.FileHeader {
+	return &szip.FileHeader{
+		Name:               hdr.Name,
+		Comment:            hdr.Comment,
+		NonUTF8:            hdr.NonUTF8,
+		CreatorVersion:     hdr.CreatorVersion,
+		ReaderVersion:      hdr.ReaderVersion,
+		Flags:              hdr.Flags,
+		Method:             hdr.Method,
+		Modified:           hdr.Modified,
+		ModifiedTime:       hdr.ModifiedTime,
+		ModifiedDate:       hdr.ModifiedDate,
+		CRC32:              hdr.CRC32,
+		CompressedSize:     hdr.CompressedSize,
+		UncompressedSize:   hdr.UncompressedSize,
+		CompressedSize64:   hdr.CompressedSize64,
+		UncompressedSize64: hdr.UncompressedSize64,
+		Extra:              hdr.Extra,
+		ExternalAttrs:      hdr.ExternalAttrs,
+	}
+}
+
 type seekReaderAt interface {
 	io.ReaderAt
 	io.Seeker
@@ -440,4 +1300,6 @@ var (
 	_ Archiver      = Zip{}
 	_ ArchiverAsync = Zip{}
 	_ Extractor     = Zip{}
+	_ Deleter       = Zip{}
+	_ Renamer       = Zip{}
 )
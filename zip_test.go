@@ -0,0 +1,394 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zip"
+)
+
+func TestZipInsert(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	archivePath := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(archivePath)
+	checkErr(t, err, "creating archive")
+	defer f.Close()
+	err = Zip{}.Archive(ctx, f, filesFromMapFS(t, fstest.MapFS{
+		"a.txt": {Data: []byte("a"), Mode: 0644, ModTime: modTime},
+	}))
+	checkErr(t, err, "writing archive")
+
+	// a directory among the inserted files must not end the insertion
+	err = Zip{}.Insert(ctx, f, filesFromMapFS(t, fstest.MapFS{
+		"dir":       {Mode: fs.ModeDir | 0755, ModTime: modTime},
+		"dir/b.txt": {Data: []byte("b"), Mode: 0600, ModTime: modTime},
+	}))
+	checkErr(t, err, "inserting files")
+
+	_, err = f.Seek(0, 0)
+	checkErr(t, err, "seeking")
+	got := make(map[string]fs.FileInfo)
+	err = Zip{}.Extract(ctx, f, func(_ context.Context, fi FileInfo) error {
+		got[fi.NameInArchive] = fi
+		return nil
+	})
+	checkErr(t, err, "extracting")
+
+	for name, mode := range map[string]fs.FileMode{
+		"a.txt":     0644,
+		"dir/":      fs.ModeDir | 0755,
+		"dir/b.txt": 0600,
+	} {
+		fi, ok := got[name]
+		if !ok {
+			t.Errorf("expected %s in archive, but it was not; got: %v", name, got)
+			continue
+		}
+		if fi.Mode() != mode {
+			t.Errorf("%s: expected mode %s but got %s", name, mode, fi.Mode())
+		}
+		if !fi.ModTime().Equal(modTime) {
+			t.Errorf("%s: expected modification time %s but got %s", name, modTime, fi.ModTime())
+		}
+	}
+}
+
+func TestZipSymlinkBody(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"target.txt": {Data: []byte("contents of target"), Mode: 0644},
+		"link":       {Mode: fs.ModeSymlink | 0777},
+	}
+
+	// like files from disk, opening the link opens the file it points to,
+	// but zip stores the target of a symlink as its contents
+	link := func(name string) FileInfo {
+		files := filesFromMapFS(t, fstest.MapFS{name: fsys["link"]})
+		files[0].LinkTarget = "target.txt"
+		files[0].Open = func() (fs.File, error) { return fsys.Open("target.txt") }
+		return files[0]
+	}
+	files := append(filesFromMapFS(t, fstest.MapFS{"target.txt": fsys["target.txt"]}), link("link"))
+
+	archivePath := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(archivePath)
+	checkErr(t, err, "creating archive")
+	defer f.Close()
+	checkErr(t, Zip{}.Archive(ctx, f, files), "writing archive")
+	checkErr(t, Zip{}.Insert(ctx, f, []FileInfo{link("inserted")}), "inserting link")
+
+	got := archiveContents(t, Zip{}, f)
+	for _, name := range []string{"link", "inserted"} {
+		if got[name] != "target.txt" {
+			t.Errorf("%s: expected link target as contents but got %q", name, got[name])
+		}
+	}
+}
+
+func TestZipDelete(t *testing.T) {
+	testDelete(t, Zip{}) // stored, so deleted contents can be looked for
+}
+
+func TestZipRename(t *testing.T) {
+	testRename(t, Zip{Compression: ZipMethodZstd})
+}
+
+func TestZipCopyHeaders(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	extra := []byte{0xfe, 0xca, 4, 0, 'd', 'a', 't', 'a'} // unknown extra field 0xcafe
+	headers := []*zip.FileHeader{
+		{Name: "stored.txt", Method: zip.Store, Comment: "not compressed", Extra: extra, Modified: modTime},
+		{Name: "deflated.txt", Method: zip.Deflate, Comment: "compressed", Modified: modTime},
+	}
+	var src bytes.Buffer
+	zw := zip.NewWriter(&src)
+	for _, hdr := range headers {
+		hdr.SetMode(0600)
+		w, err := zw.CreateHeader(hdr)
+		checkErr(t, err, "writing header for %s", hdr.Name)
+		_, err = w.Write(bytes.Repeat([]byte("hello "), 100))
+		checkErr(t, err, "writing contents of %s", hdr.Name)
+	}
+	checkErr(t, zw.Close(), "closing source archive")
+
+	// entries keep their methods, even though the format has another
+	var dst bytes.Buffer
+	copyArchive(t, Zip{}, bytes.NewReader(src.Bytes()), Zip{Compression: ZipMethodZstd}, &dst, nil)
+
+	readHeaders := func(archive []byte) []zip.FileHeader {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		checkErr(t, err, "reading archive")
+		var hdrs []zip.FileHeader
+		for _, f := range zr.File {
+			hdrs = append(hdrs, f.FileHeader)
+		}
+		return hdrs
+	}
+	want, got := readHeaders(src.Bytes()), readHeaders(dst.Bytes())
+	if len(got) != len(want) {
+		t.Fatalf("expected %d entries but got %d", len(want), len(got))
+	}
+	for i := range want {
+		// the compressed sizes depend on the compressor
+		want[i].CompressedSize, want[i].CompressedSize64 = 0, 0
+		got[i].CompressedSize, got[i].CompressedSize64 = 0, 0
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("entry %d: expected header %+v but got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestZipCopyRaw(t *testing.T) {
+	contents := bytes.Repeat([]byte("hello, raw world\n"), 1000)
+	encrypted := []byte("not really encrypted, but never decrypted either")
+
+	var src bytes.Buffer
+	zw := zip.NewWriter(&src)
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, flate.BestSpeed) // unlike the default, so recompressing would be noticed
+	})
+	w, err := zw.Create("file.txt")
+	checkErr(t, err, "creating file")
+	_, err = w.Write(contents)
+	checkErr(t, err, "writing file")
+	w, err = zw.CreateRaw(&zip.FileHeader{
+		Name:               "secret.txt",
+		Method:             zip.Store,
+		Flags:              0x1, // encrypted
+		CRC32:              crc32.ChecksumIEEE(encrypted),
+		CompressedSize64:   uint64(len(encrypted)),
+		UncompressedSize64: uint64(len(encrypted)),
+	})
+	checkErr(t, err, "creating encrypted file")
+	_, err = w.Write(encrypted)
+	checkErr(t, err, "writing encrypted file")
+	checkErr(t, zw.Close(), "closing source archive")
+
+	var dst bytes.Buffer
+	copyArchive(t, Zip{}, bytes.NewReader(src.Bytes()), Zip{Compression: ZipMethodZstd}, &dst, func(f *FileInfo) {
+		f.NameInArchive = "dïr/" + f.NameInArchive
+	})
+
+	srcReader, err := zip.NewReader(bytes.NewReader(src.Bytes()), int64(src.Len()))
+	checkErr(t, err, "reading source archive")
+	dstReader, err := zip.NewReader(bytes.NewReader(dst.Bytes()), int64(dst.Len()))
+	checkErr(t, err, "reading copied archive")
+	if len(dstReader.File) != len(srcReader.File) {
+		t.Fatalf("expected %d entries but got %d", len(srcReader.File), len(dstReader.File))
+	}
+	for i, got := range dstReader.File {
+		want := srcReader.File[i]
+		if got.Name != "dïr/"+want.Name {
+			t.Errorf("entry %d: expected name %q but got %q", i, "dïr/"+want.Name, got.Name)
+		}
+		if got.Method != want.Method || got.Flags&0x1 != want.Flags&0x1 {
+			t.Errorf("%s: expected method %d and flags %#x but got %d and %#x", got.Name, want.Method, want.Flags, got.Method, got.Flags)
+		}
+		wantRaw, err := want.OpenRaw()
+		checkErr(t, err, "opening %s raw", want.Name)
+		gotRaw, err := got.OpenRaw()
+		checkErr(t, err, "opening %s raw", got.Name)
+		wantData, _ := io.ReadAll(wantRaw)
+		gotData, _ := io.ReadAll(gotRaw)
+		if !bytes.Equal(gotData, wantData) {
+			t.Errorf("%s: compressed contents differ from the original", got.Name)
+		}
+	}
+
+	// the contents still decompress and match their checksum
+	rc, err := dstReader.File[0].Open()
+	checkErr(t, err, "opening copied file")
+	data, err := io.ReadAll(rc)
+	checkErr(t, err, "reading copied file")
+	if !bytes.Equal(data, contents) {
+		t.Error("copied file has different contents")
+	}
+}
+
+//go:generate zip -P secret testdata/zipcrypto.zip LICENSE
+//go:generate bsdtar --format zip --options zip:encryption=aes256 --passphrase secret -cf testdata/aes.zip LICENSE
+
+func TestZipExtractEncrypted(t *testing.T) {
+	license, err := os.ReadFile("LICENSE")
+	checkErr(t, err, "reading license")
+
+	for _, archive := range []string{"testdata/zipcrypto.zip", "testdata/aes.zip"} {
+		for _, tc := range []struct {
+			password string
+			err      error
+		}{
+			{password: "secret"},
+			{password: "wrong", err: ErrPassword},
+			{password: "", err: ErrPassword},
+		} {
+			f, err := os.Open(archive)
+			checkErr(t, err, "opening %s", archive)
+			defer f.Close()
+			err = Zip{Password: tc.password}.Extract(context.Background(), f, func(_ context.Context, fi FileInfo) error {
+				if !fi.Encrypted {
+					t.Errorf("%s: expected %s to be marked as encrypted", archive, fi.NameInArchive)
+				}
+				rc, err := fi.Open()
+				if err != nil {
+					return err
+				}
+				defer rc.Close()
+				data, err := io.ReadAll(rc)
+				if err == nil && !bytes.Equal(data, license) {
+					t.Errorf("%s: decrypted contents differ from the original", archive)
+				}
+				return err
+			})
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s: with password %q, expected error %v but got %v", archive, tc.password, tc.err, err)
+			}
+		}
+	}
+}
+
+func TestZipArchiveEncrypted(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"dir":           {Mode: fs.ModeDir | 0755, ModTime: modTime},
+		"dir/a.txt":     {Data: bytes.Repeat([]byte("secret stuff "), 1000), Mode: 0644, ModTime: modTime},
+		"dir/empty.txt": {Mode: 0644, ModTime: modTime},
+	}
+	files := filesFromMapFS(t, fsys)
+
+	for _, method := range []uint16{zip.Store, zip.Deflate, ZipMethodZstd} {
+		var buf bytes.Buffer
+		err := Zip{Compression: method, Password: "pw"}.Archive(context.Background(), &buf, files)
+		checkErr(t, err, "writing archive with method %d", method)
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		checkErr(t, err, "reading archive")
+		for _, f := range zr.File {
+			encrypted := f.Flags&0x1 != 0
+			if f.Mode().IsDir() == encrypted {
+				t.Errorf("method %d: %s: expected encrypted to be %t", method, f.Name, !encrypted)
+			}
+			if encrypted && !f.Modified.Equal(modTime) {
+				t.Errorf("method %d: %s: expected modification time %s but got %s", method, f.Name, modTime, f.Modified)
+			}
+			if aesInfo, err := parseZipAESExtra(f.Extra); encrypted && (err != nil || f.Method != zipMethodAES || aesInfo.method != method || aesInfo.strength != 3) {
+				t.Errorf("method %d: %s: expected AES-256 with the method, but got method %d and %+v (%v)", method, f.Name, f.Method, aesInfo, err)
+			}
+		}
+
+		contents := archiveContents(t, Zip{Password: "pw"}, bytes.NewReader(buf.Bytes()))
+		for name, file := range fsys {
+			if !file.Mode.IsDir() && contents[name] != string(file.Data) {
+				t.Errorf("method %d: %s: decrypted contents differ from the original", method, name)
+			}
+		}
+
+		// tampering with the encrypted data or with the authentication
+		// code after it fails authentication, even if the decompressor
+		// doesn't read to the end of the data or fails first
+		dataOffset, err := zr.File[1].DataOffset()
+		checkErr(t, err, "getting data offset")
+		for _, offset := range []int64{
+			dataOffset + 20, // after the salt and password verification value
+			dataOffset + int64(zr.File[1].CompressedSize64) - 1, // the last byte of the authentication code
+		} {
+			tampered := bytes.Clone(buf.Bytes())
+			tampered[offset] ^= 0xff
+			err = Zip{Password: "pw"}.Extract(context.Background(), bytes.NewReader(tampered), func(_ context.Context, fi FileInfo) error {
+				if fi.IsDir() {
+					return nil
+				}
+				rc, err := fi.Open()
+				if err != nil {
+					return err
+				}
+				defer rc.Close()
+				_, err = io.ReadAll(rc)
+				return err
+			})
+			if !errors.Is(err, zip.ErrChecksum) {
+				t.Errorf("method %d: expected checksum error from data tampered at offset %d, but got %v", method, offset-dataOffset, err)
+			}
+		}
+	}
+}
+
+func TestZipCopyEncrypted(t *testing.T) {
+	license, err := os.ReadFile("LICENSE")
+	checkErr(t, err, "reading license")
+	src, err := os.ReadFile("testdata/aes.zip")
+	checkErr(t, err, "reading source archive")
+
+	// with the same password, the encrypted contents are copied as they are
+	var same bytes.Buffer
+	copyArchive(t, Zip{Password: "secret"}, bytes.NewReader(src), Zip{Password: "secret"}, &same, nil)
+	rawContents := func(archive []byte) []byte {
+		zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+		checkErr(t, err, "reading archive")
+		r, err := zr.File[0].OpenRaw()
+		checkErr(t, err, "opening raw contents")
+		data, err := io.ReadAll(r)
+		checkErr(t, err, "reading raw contents")
+		return data
+	}
+	if !bytes.Equal(rawContents(same.Bytes()), rawContents(src)) {
+		t.Error("expected the encrypted contents to be copied as they are")
+	}
+	if contents := archiveContents(t, Zip{Password: "secret"}, bytes.NewReader(same.Bytes())); contents["LICENSE"] != string(license) {
+		t.Error("copied contents differ from the original")
+	}
+
+	// with another password, they are decrypted and encrypted again
+	var other bytes.Buffer
+	copyArchive(t, Zip{Password: "secret"}, bytes.NewReader(src), Zip{Password: "other"}, &other, nil)
+	if contents := archiveContents(t, Zip{Password: "other"}, bytes.NewReader(other.Bytes())); contents["LICENSE"] != string(license) {
+		t.Error("contents encrypted with the other password differ from the original")
+	}
+
+	// ZipCrypto is encrypted again with AES, even with the same password
+	src, err = os.ReadFile("testdata/zipcrypto.zip")
+	checkErr(t, err, "reading source archive")
+	var reencrypted bytes.Buffer
+	copyArchive(t, Zip{Password: "secret"}, bytes.NewReader(src), Zip{Password: "secret"}, &reencrypted, nil)
+	zr, err := zip.NewReader(bytes.NewReader(reencrypted.Bytes()), int64(reencrypted.Len()))
+	checkErr(t, err, "reading archive")
+	if method := zr.File[0].Method; method != zipMethodAES {
+		t.Errorf("expected contents to be encrypted with AES (method %d) but got method %d", zipMethodAES, method)
+	}
+	if contents := archiveContents(t, Zip{Password: "secret"}, bytes.NewReader(reencrypted.Bytes())); contents["LICENSE"] != string(license) {
+		t.Error("contents encrypted again with AES differ from the original")
+	}
+}
+
+func TestPBKDF2SHA1(t *testing.T) {
+	// the test vectors of RFC 6070, except for the one with 16777216 rounds
+	for _, tc := range []struct {
+		password, salt string
+		rounds         int
+		key            string
+	}{
+		{"password", "salt", 1, "0c60c80f961f0e71f3a9b524af6012062fe037a6"},
+		{"password", "salt", 2, "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		{"password", "salt", 4096, "4b007901b765489abead49d926f721d065a429c1"},
+		{"passwordPASSWORDpassword", "saltSALTsaltSALTsaltSALTsaltSALTsalt", 4096, "3d2eec4fe41c849b80c8d83662c0e44a8b291a964cf2f07038"},
+		{"pass\x00word", "sa\x00lt", 4096, "56fa6aa75548099dcc37d7f03425e0c3"},
+	} {
+		key := pbkdf2SHA1([]byte(tc.password), []byte(tc.salt), tc.rounds, len(tc.key)/2)
+		if got := hex.EncodeToString(key); got != tc.key {
+			t.Errorf("password %q, salt %q, %d rounds: expected key %s but got %s", tc.password, tc.salt, tc.rounds, tc.key, got)
+		}
+	}
+}
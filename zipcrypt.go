@@ -0,0 +1,410 @@
+package archiver
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/klauspost/compress/zip"
+)
+
+// ErrPassword is returned when opening an encrypted file
+// without a password, or with the wrong password.
+var ErrPassword = errors.New("wrong or missing password")
+
+// openEncryptedZipFile opens the encrypted file f for reading its
+// decrypted and decompressed contents. Files encrypted with WinZip AES
+// (AE-1 or AE-2, with any key size) and with the traditional PKWARE
+// encryption (ZipCrypto) are supported.
+func openEncryptedZipFile(f *zip.File, password string) (io.ReadCloser, error) {
+	if f.Flags&0x40 != 0 {
+		return nil, fmt.Errorf("strong encryption: %w", zip.ErrAlgorithm)
+	}
+	if password == "" {
+		return nil, ErrPassword
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	method := f.Method
+	var r io.Reader
+	checkCRC := true
+	if method == zipMethodAES {
+		var aesInfo zipAESExtra
+		aesInfo, err = parseZipAESExtra(f.Extra)
+		if err != nil {
+			return nil, err
+		}
+		method = aesInfo.method
+		checkCRC = aesInfo.version == 1 // AE-2 doesn't store the CRC, to not leak information
+		r, err = newZipAESReader(raw, f.CompressedSize64, aesInfo.strength, password)
+	} else {
+		// the last byte of the encryption header is a check byte, usually
+		// the high byte of the CRC, but the high byte of the modification
+		// time if the CRC comes after the data, in a data descriptor
+		check := byte(f.CRC32 >> 24)
+		if f.Flags&0x8 != 0 {
+			check = byte(f.ModifiedTime >> 8)
+		}
+		r, err = newZipCryptoReader(raw, f.CompressedSize64, check, password)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decomp := zipDecompressor(method)
+	if decomp == nil {
+		return nil, zip.ErrAlgorithm
+	}
+	rc := decomp(r)
+	if rc == nil {
+		return nil, fmt.Errorf("initializing decompressor for method %d", method)
+	}
+	cr := &zipChecksumReader{
+		rc:     rc,
+		src:    r,
+		hash:   crc32.NewIEEE(),
+		size:   f.UncompressedSize64,
+		crc:    f.CRC32,
+		useCRC: checkCRC,
+	}
+	return cr, nil
+}
+
+// zipChecksumReader reads the decompressed contents of a file, and
+// returns an error at the end if their size or CRC is not as expected.
+type zipChecksumReader struct {
+	rc      io.ReadCloser
+	src     io.Reader // the decrypted data that rc decompresses
+	drained bool
+	hash    hash.Hash32
+	n       uint64
+	size    uint64
+	crc     uint32
+	useCRC  bool
+}
+
+func (r *zipChecksumReader) Read(p []byte) (int, error) {
+	n, err := r.rc.Read(p)
+	r.hash.Write(p[:n])
+	r.n += uint64(n)
+	if r.n > r.size {
+		err = zip.ErrFormat
+	} else if err == io.EOF {
+		if r.n != r.size {
+			err = io.ErrUnexpectedEOF
+		} else if r.useCRC && r.hash.Sum32() != r.crc {
+			err = zip.ErrChecksum
+		}
+	}
+	if err != nil && !r.drained {
+		// decompressors may stop before the end of the decrypted data,
+		// which is where the WinZip AES authentication code is checked;
+		// tampered data also explains any other error, so it comes first
+		r.drained = true
+		if _, authErr := io.Copy(io.Discard, r.src); authErr != nil {
+			return n, authErr
+		}
+	}
+	return n, err
+}
+
+func (r *zipChecksumReader) Close() error { return r.rc.Close() }
+
+// zipCryptoKeys is the state of the traditional PKWARE
+// encryption, which is known as ZipCrypto. It is weak,
+// so it is only supported for reading.
+type zipCryptoKeys [3]uint32
+
+func newZipCryptoKeys(password string) *zipCryptoKeys {
+	keys := &zipCryptoKeys{0x12345678, 0x23456789, 0x34567890}
+	for i := 0; i < len(password); i++ {
+		keys.update(password[i])
+	}
+	return keys
+}
+
+func (k *zipCryptoKeys) update(b byte) {
+	k[0] = crc32.IEEETable[byte(k[0])^b] ^ k[0]>>8
+	k[1] = (k[1]+k[0]&0xff)*134775813 + 1
+	k[2] = crc32.IEEETable[byte(k[2])^byte(k[1]>>24)] ^ k[2]>>8
+}
+
+func (k *zipCryptoKeys) decrypt(p []byte) {
+	for i, c := range p {
+		t := k[2] | 2
+		p[i] = c ^ byte(t*(t^1)>>8)
+		k.update(p[i])
+	}
+}
+
+// zipCryptoHeaderLen is the length of the encryption header
+// before the encrypted data of files encrypted with ZipCrypto.
+const zipCryptoHeaderLen = 12
+
+func newZipCryptoReader(raw io.Reader, size uint64, check byte, password string) (io.Reader, error) {
+	if size < zipCryptoHeaderLen {
+		return nil, zip.ErrFormat
+	}
+	keys := newZipCryptoKeys(password)
+	header := make([]byte, zipCryptoHeaderLen)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	keys.decrypt(header)
+	if header[zipCryptoHeaderLen-1] != check {
+		return nil, ErrPassword
+	}
+	return &zipCryptoReader{r: raw, keys: keys}, nil
+}
+
+type zipCryptoReader struct {
+	r    io.Reader
+	keys *zipCryptoKeys
+}
+
+func (r *zipCryptoReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.keys.decrypt(p[:n])
+	return n, err
+}
+
+// zipMethodAES is the method of files encrypted with WinZip AES;
+// the actual compression method is in the AES extra field.
+// See https://www.winzip.com/en/support/aes-encryption/.
+const zipMethodAES = 99
+
+const (
+	zipAESExtraID   = 0x9901
+	zipAESVerifyLen = 2  // length of the password verification value
+	zipAESMACLen    = 10 // length of the authentication code
+	zipAESRounds    = 1000
+)
+
+// zipAESExtra is the AES extra field of an encrypted file.
+type zipAESExtra struct {
+	version  uint16 // 1 for AE-1, 2 for AE-2
+	strength byte   // 1, 2, or 3 for 128-, 192-, or 256-bit keys
+	method   uint16 // the compression method
+}
+
+func parseZipAESExtra(extra []byte) (zipAESExtra, error) {
+	field := zipExtraField(extra, zipAESExtraID)
+	if len(field) < 4+7 || !bytes.Equal(field[6:8], []byte("AE")) {
+		return zipAESExtra{}, fmt.Errorf("missing or invalid AES extra field: %w", zip.ErrFormat)
+	}
+	info := zipAESExtra{
+		version:  binary.LittleEndian.Uint16(field[4:]),
+		strength: field[8],
+		method:   binary.LittleEndian.Uint16(field[9:]),
+	}
+	if info.strength < 1 || info.strength > 3 {
+		return zipAESExtra{}, fmt.Errorf("AES strength %d: %w", info.strength, zip.ErrAlgorithm)
+	}
+	return info, nil
+}
+
+func (info zipAESExtra) encode() []byte {
+	field := make([]byte, 4+7)
+	binary.LittleEndian.PutUint16(field, zipAESExtraID)
+	binary.LittleEndian.PutUint16(field[2:], 7)
+	binary.LittleEndian.PutUint16(field[4:], info.version)
+	copy(field[6:], "AE")
+	field[8] = info.strength
+	binary.LittleEndian.PutUint16(field[9:], info.method)
+	return field
+}
+
+// zipExtraField returns the extra field with the given ID, including
+// its ID and size, or nil if there is none.
+func zipExtraField(extra []byte, id uint16) []byte {
+	for pos := 0; pos+4 <= len(extra); {
+		end := min(pos+4+int(binary.LittleEndian.Uint16(extra[pos+2:])), len(extra))
+		if binary.LittleEndian.Uint16(extra[pos:]) == id {
+			return extra[pos:end]
+		}
+		pos = end
+	}
+	return nil
+}
+
+// zipAESKeys derives the keys for encrypting with AES and authenticating
+// the encrypted data, and the value for verifying the password, from the
+// password and salt.
+func zipAESKeys(password string, salt []byte, strength byte) (cipher.Stream, hash.Hash, []byte, error) {
+	keyLen := 8 * (int(strength) + 1)
+	key := pbkdf2SHA1([]byte(password), salt, zipAESRounds, 2*keyLen+zipAESVerifyLen)
+	block, err := aes.NewCipher(key[:keyLen])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return newZipAESCTR(block), hmac.New(sha1.New, key[keyLen:2*keyLen]), key[2*keyLen:], nil
+}
+
+func newZipAESReader(raw io.Reader, size uint64, strength byte, password string) (io.Reader, error) {
+	saltLen := 4 * (int(strength) + 1)
+	if size < uint64(saltLen+zipAESVerifyLen+zipAESMACLen) {
+		return nil, zip.ErrFormat
+	}
+	header := make([]byte, saltLen+zipAESVerifyLen)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	stream, mac, verify, err := zipAESKeys(password, header[:saltLen], strength)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(verify, header[saltLen:]) {
+		return nil, ErrPassword
+	}
+	dataLen := int64(size) - int64(len(header)) - zipAESMACLen
+	return &zipAESReader{
+		r:      io.LimitReader(raw, dataLen),
+		raw:    raw,
+		stream: stream,
+		mac:    mac,
+	}, nil
+}
+
+// zipAESReader decrypts the data of a file encrypted with
+// WinZip AES, and authenticates it once it is all read.
+type zipAESReader struct {
+	r      io.Reader // the encrypted data
+	raw    io.Reader // the encrypted data followed by the authentication code
+	stream cipher.Stream
+	mac    hash.Hash
+}
+
+func (r *zipAESReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.mac.Write(p[:n])
+	r.stream.XORKeyStream(p[:n], p[:n])
+	if err == io.EOF {
+		code := make([]byte, zipAESMACLen)
+		if _, err := io.ReadFull(r.raw, code); err != nil {
+			return n, err
+		}
+		if !hmac.Equal(code, r.mac.Sum(nil)[:zipAESMACLen]) {
+			return n, fmt.Errorf("authentication failed: %w", zip.ErrChecksum)
+		}
+	}
+	return n, err
+}
+
+// zipAESWriter encrypts data with WinZip AES, and writes the
+// authentication code after it when closed. It counts the bytes
+// it writes, which are the compressed size of the file.
+type zipAESWriter struct {
+	w      io.Writer
+	stream cipher.Stream
+	mac    hash.Hash
+	n      int64
+	buf    []byte
+}
+
+// newZipAESWriter returns a writer that encrypts with a 256-bit key
+// derived from password, after writing the salt and password
+// verification value that precede the encrypted data.
+func newZipAESWriter(w io.Writer, password string) (*zipAESWriter, error) {
+	const strength = 3
+	salt := make([]byte, 4*(strength+1))
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	stream, mac, verify, err := zipAESKeys(password, salt, strength)
+	if err != nil {
+		return nil, err
+	}
+	aw := &zipAESWriter{w: w, stream: stream, mac: mac}
+	if err := aw.writeRaw(append(salt, verify...)); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+func (w *zipAESWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf[:0], p...)
+	w.stream.XORKeyStream(w.buf, w.buf)
+	w.mac.Write(w.buf)
+	if err := w.writeRaw(w.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *zipAESWriter) Close() error {
+	return w.writeRaw(w.mac.Sum(nil)[:zipAESMACLen])
+}
+
+func (w *zipAESWriter) writeRaw(p []byte) error {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return err
+}
+
+// zipAESCTR is AES in counter mode as WinZip does it, with
+// a little-endian counter starting at 1; unlike the standard
+// library's CTR mode, which has a big-endian counter.
+type zipAESCTR struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	key     [aes.BlockSize]byte
+	used    int // bytes of key used
+}
+
+func newZipAESCTR(block cipher.Block) *zipAESCTR {
+	return &zipAESCTR{block: block, used: aes.BlockSize}
+}
+
+func (c *zipAESCTR) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.used == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.key[:], c.counter[:])
+			c.used = 0
+		}
+		dst[i] = src[i] ^ c.key[c.used]
+		c.used++
+	}
+}
+
+// pbkdf2SHA1 derives a key of keyLen bytes from the
+// password and salt with PBKDF2, using HMAC-SHA1.
+func pbkdf2SHA1(password, salt []byte, rounds, keyLen int) []byte {
+	prf := hmac.New(sha1.New, password)
+	var key []byte
+	u := make([]byte, 0, prf.Size())
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u = prf.Sum(u[:0])
+		t := bytes.Clone(u)
+		for i := 1; i < rounds; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -1,8 +1,11 @@
 package archiver
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
+	"fmt"
 	"io"
 	"strings"
 
@@ -51,6 +54,97 @@ func (zs Zstd) OpenReader(r io.Reader) (io.ReadCloser, error) {
 	return errorCloser{zr}, nil
 }
 
+// members finds the Zstandard frames in ra by reading their headers and
+// the headers of their blocks, without decompressing them.
+func (Zstd) members(ra io.ReaderAt, size int64) ([]int64, error) {
+	var offsets []int64
+	for offset := int64(0); offset < size; {
+		offsets = append(offsets, offset)
+		n, err := zstdFrameLen(io.NewSectionReader(ra, offset, size-offset))
+		if err != nil {
+			return nil, fmt.Errorf("frame at offset %d: %w", offset, err)
+		}
+		offset += n
+	}
+	return offsets, nil
+}
+
+// zstdFrameLen returns the length of the frame, which may be a
+// skippable frame, at the beginning of r. See section 3.1 of
+// https://github.com/facebook/zstd/blob/dev/doc/zstd_compression_format.md
+func zstdFrameLen(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	skip := func(n int) error {
+		_, err := br.Discard(n)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	var buf [4]byte
+	if _, err := io.ReadFull(br, buf[:]); err != nil {
+		return 0, err
+	}
+	magic := binary.LittleEndian.Uint32(buf[:])
+	if magic&0xfffffff0 == zstdSkippableMagic {
+		if _, err := io.ReadFull(br, buf[:]); err != nil {
+			return 0, err
+		}
+		return 8 + int64(binary.LittleEndian.Uint32(buf[:])), nil
+	}
+	if magic != binary.LittleEndian.Uint32(zstdHeader) {
+		return 0, fmt.Errorf("not a Zstandard frame")
+	}
+
+	// frame header
+	descriptor, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	singleSegment := descriptor&0x20 != 0
+	headerLen := [4]int{0, 2, 4, 8}[descriptor>>6] + [4]int{0, 1, 2, 4}[descriptor&0x3]
+	if descriptor>>6 == 0 && singleSegment {
+		headerLen++ // 1-byte frame content size
+	}
+	if !singleSegment {
+		headerLen++ // window descriptor
+	}
+	if err := skip(headerLen); err != nil {
+		return 0, err
+	}
+	n := int64(len(buf) + 1 + headerLen)
+
+	// blocks
+	for last := false; !last; {
+		if _, err := io.ReadFull(br, buf[:3]); err != nil {
+			return 0, err
+		}
+		header := uint32(buf[0]) | uint32(buf[1])<<8 | uint32(buf[2])<<16
+		last = header&1 != 0
+		blockLen := int(header >> 3)
+		switch header >> 1 & 0x3 {
+		case 1: // RLE block
+			blockLen = 1
+		case 3:
+			return 0, fmt.Errorf("reserved block type")
+		}
+		if err := skip(blockLen); err != nil {
+			return 0, err
+		}
+		n += 3 + int64(blockLen)
+	}
+
+	if descriptor&0x4 != 0 {
+		if err := skip(4); err != nil { // content checksum
+			return 0, err
+		}
+		n += 4
+	}
+
+	return n, nil
+}
+
 type errorCloser struct {
 	*zstd.Decoder
 }
@@ -63,3 +157,6 @@ func (ec errorCloser) Close() error {
 // magic number at the beginning of Zstandard files
 // https://github.com/facebook/zstd/blob/6211bfee5ec24dc825c11751c33aa31d618b5f10/doc/zstd_compression_format.md
 var zstdHeader = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// magic number of skippable frames, whose lowest 4 bits may be anything
+const zstdSkippableMagic = 0x184d2a50